@@ -0,0 +1,76 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"story-app-monolith/config"
+	"strings"
+	"sync"
+)
+
+// BlobStore keeps uploaded files under a key and hands out the public url for it
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	// Delete doesn't fail when the key doesn't exist
+	Delete(key string) error
+	URL(key string) string
+}
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+var (
+	store     BlobStore
+	storeErr  error
+	storeOnce sync.Once
+)
+
+// NewBlobStoreFromConfig picks the implementation from the BLOB_STORE env var, "local" or "s3"
+func NewBlobStoreFromConfig() (BlobStore, error) {
+	switch strings.ToLower(config.Config("BLOB_STORE")) {
+	case "local", "":
+		return NewLocalStore(config.Config("BLOB_DIR"), config.Config("BLOB_URL_PREFIX")), nil
+	case "s3":
+		for _, key := range []string{"S3_BUCKET", "S3_ACCESS_KEY", "S3_SECRET_KEY"} {
+			if config.Config(key) == "" {
+				return nil, fmt.Errorf("BLOB_STORE is s3 but %v isn't set", key)
+			}
+		}
+
+		if endpoint := config.Config("S3_ENDPOINT"); endpoint != "" {
+			if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid S3_ENDPOINT %v", endpoint)
+			}
+		}
+
+		return NewS3Store(config.Config("S3_ENDPOINT"), config.Config("S3_REGION"), config.Config("S3_BUCKET"),
+			config.Config("S3_ACCESS_KEY"), config.Config("S3_SECRET_KEY"), config.Config("S3_PUBLIC_URL"),
+			strings.ToLower(config.Config("S3_PATH_STYLE")) == "true"), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store %v", config.Config("BLOB_STORE"))
+	}
+}
+
+// Default is the store from the config, created on first use. A config that doesn't work is an error every time
+// instead of a fallback, uploads must never end up somewhere else than configured.
+func Default() (BlobStore, error) {
+	storeOnce.Do(func() {
+		store, storeErr = NewBlobStoreFromConfig()
+	})
+
+	return store, storeErr
+}
+
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return false
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+
+	return true
+}
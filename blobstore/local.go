@@ -0,0 +1,70 @@
+package blobstore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore writes the blobs under Dir, the app serves them itself under UrlPrefix.
+// It's meant for local development and single instance deployments.
+type LocalStore struct {
+	Dir       string
+	UrlPrefix string
+}
+
+func (l LocalStore) Put(key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	path := filepath.Join(l.Dir, filepath.FromSlash(key))
+
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	// written next to the final file and renamed, so nobody ever reads half an image
+	tmp := path + ".tmp"
+
+	err = ioutil.WriteFile(tmp, data, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (l LocalStore) Delete(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	err := os.Remove(filepath.Join(l.Dir, filepath.FromSlash(key)))
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (l LocalStore) URL(key string) string {
+	return l.UrlPrefix + "/" + key
+}
+
+func NewLocalStore(dir string, urlPrefix string) LocalStore {
+	if dir == "" {
+		dir = "uploads"
+	}
+
+	if urlPrefix == "" {
+		urlPrefix = "/uploads"
+	}
+
+	return LocalStore{Dir: dir, UrlPrefix: strings.TrimSuffix(urlPrefix, "/")}
+}
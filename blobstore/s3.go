@@ -0,0 +1,199 @@
+package blobstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Store talks to anything that speaks the S3 api, AWS itself or a local stand-in like the minio container in
+// setup/docker-compose.yml. Requests are signed with signature version 4.
+type S3Store struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PublicUrl is where the bucket is served from, a CDN for example, the object url when empty
+	PublicUrl string
+	// PathStyle puts the bucket in the path instead of the host, local stand-ins usually need it
+	PathStyle  bool
+	HttpClient *http.Client
+}
+
+func (s S3Store) Put(key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	req, err := s.request(http.MethodPut, key, data)
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return s.do(req, http.StatusOK)
+}
+
+func (s S3Store) Delete(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	req, err := s.request(http.MethodDelete, key, nil)
+
+	if err != nil {
+		return err
+	}
+
+	return s.do(req, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+}
+
+func (s S3Store) URL(key string) string {
+	if s.PublicUrl != "" {
+		return strings.TrimSuffix(s.PublicUrl, "/") + "/" + escapeKey(key)
+	}
+
+	return s.objectUrl(key).String()
+}
+
+func (s S3Store) objectUrl(key string) *url.URL {
+	u, err := url.Parse(s.Endpoint)
+
+	if err != nil || u.Host == "" {
+		u = &url.URL{Scheme: "https", Host: fmt.Sprintf("s3.%v.amazonaws.com", s.Region)}
+	}
+
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + key
+		u.RawPath = "/" + s.Bucket + "/" + escapeKey(key)
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escapeKey(key)
+	}
+
+	return u
+}
+
+func (s S3Store) request(method string, key string, body []byte) (*http.Request, error) {
+	u := s.objectUrl(key)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		"",
+		"host:" + u.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		s.AccessKey, scope, signedHeaders, signature))
+
+	return req, nil
+}
+
+func (s S3Store) do(req *http.Request, expected ...int) error {
+	client := s.HttpClient
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	for _, status := range expected {
+		if res.StatusCode == status {
+			return nil
+		}
+	}
+
+	body, _ := ioutil.ReadAll(res.Body)
+
+	return fmt.Errorf("s3 %v %v responded with %d: %s", req.Method, req.URL.Path, res.StatusCode, body)
+}
+
+// escapeKey encodes every segment of the key the way signature version 4 expects, slashes are kept
+func escapeKey(key string) string {
+	var b strings.Builder
+
+	for _, c := range []byte(key) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
+
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey, publicUrl string, pathStyle bool) S3Store {
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return S3Store{Endpoint: endpoint, Region: region, Bucket: bucket, AccessKey: accessKey, SecretKey: secretKey,
+		PublicUrl: publicUrl, PathStyle: pathStyle, HttpClient: &http.Client{Timeout: 30 * time.Second}}
+}
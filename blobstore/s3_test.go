@@ -0,0 +1,206 @@
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "test-access-key"
+	testSecretKey = "test-secret-key"
+	testRegion    = "eu-test-1"
+	testBucket    = "story-app"
+)
+
+var authorizationRegex = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([a-z0-9;-]+), Signature=([0-9a-f]{64})$`)
+
+// fakeS3 keeps objects in memory and only accepts requests signed with testSecretKey, it checks the signature the
+// way S3 does from what it received rather than trusting anything the client computed
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if msg := verifySignature(r, body); msg != "" {
+		http.Error(w, msg, http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func verifySignature(r *http.Request, body []byte) string {
+	m := authorizationRegex.FindStringSubmatch(r.Header.Get("Authorization"))
+
+	if m == nil {
+		return "malformed authorization"
+	}
+
+	accessKey, date, region, signedHeaders, signature := m[1], m[2], m[3], m[4], m[5]
+
+	if accessKey != testAccessKey || region != testRegion {
+		return "unknown credential"
+	}
+
+	amzDate := r.Header.Get("x-amz-date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+
+	if err != nil || !strings.HasPrefix(amzDate, date) || time.Since(signedAt) > 15*time.Minute {
+		return "bad date"
+	}
+
+	sum := sha256.Sum256(body)
+
+	if r.Header.Get("x-amz-content-sha256") != hex.EncodeToString(sum[:]) {
+		return "payload doesn't match its hash"
+	}
+
+	canonical := []string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery}
+
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+
+		if name == "host" {
+			value = r.Host
+		}
+
+		canonical = append(canonical, name+":"+strings.TrimSpace(value))
+	}
+
+	canonical = append(canonical, "", signedHeaders, r.Header.Get("x-amz-content-sha256"))
+
+	canonicalSum := sha256.Sum256([]byte(strings.Join(canonical, "\n")))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + date + "/" + region + "/s3/aws4_request\n" + hex.EncodeToString(canonicalSum[:])
+
+	key := []byte("AWS4" + testSecretKey)
+
+	for _, part := range []string{date, region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	if !hmac.Equal([]byte(hex.EncodeToString(key)), []byte(signature)) {
+		return "signature doesn't match"
+	}
+
+	return ""
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, S3Store) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store := NewS3Store(server.URL, testRegion, testBucket, testAccessKey, testSecretKey, "", true)
+	store.HttpClient = server.Client()
+
+	return fake, store
+}
+
+func TestS3PutAndDelete(t *testing.T) {
+	fake, store := newFakeS3(t)
+
+	// the space and the plus have to be escaped the same way on both ends
+	key := "users/1/profilePicture/a b+c-400.jpg"
+	path := "/" + testBucket + "/" + key
+
+	if err := store.Put(key, []byte("jpeg bytes"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(fake.objects[path]) != "jpeg bytes" || fake.types[path] != "image/jpeg" {
+		t.Fatalf("expected the object under %v, got %v", path, fake.objects)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.objects[path]; ok {
+		t.Error("expected the object to be deleted")
+	}
+
+	// deleting what isn't there is fine
+	if err := store.Delete(key); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestS3RejectsWrongSecret(t *testing.T) {
+	_, store := newFakeS3(t)
+
+	store.SecretKey = "someone-elses-secret"
+
+	if err := store.Put("users/1/file.png", []byte("png bytes"), "image/png"); err == nil {
+		t.Error("expected a request signed with the wrong secret to fail")
+	}
+
+	if err := store.Delete("users/1/file.png"); err == nil {
+		t.Error("expected a request signed with the wrong secret to fail")
+	}
+}
+
+func TestS3RejectsInvalidKeys(t *testing.T) {
+	_, store := newFakeS3(t)
+
+	for _, key := range []string{"", "/absolute", "users/../secret", "users//file"} {
+		if err := store.Put(key, nil, "image/png"); err != ErrInvalidKey {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestNewBlobStoreFromConfigRejectsIncompleteS3(t *testing.T) {
+	env := map[string]string{"BLOB_STORE": "s3", "S3_BUCKET": testBucket, "S3_ACCESS_KEY": testAccessKey, "S3_SECRET_KEY": testSecretKey}
+
+	for key, value := range env {
+		_ = os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	if _, err := NewBlobStoreFromConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.Setenv("S3_ENDPOINT", "not a url")
+	defer os.Unsetenv("S3_ENDPOINT")
+
+	if _, err := NewBlobStoreFromConfig(); err == nil {
+		t.Error("expected an error for an invalid endpoint")
+	}
+
+	_ = os.Unsetenv("S3_ENDPOINT")
+	_ = os.Unsetenv("S3_SECRET_KEY")
+
+	if _, err := NewBlobStoreFromConfig(); err == nil {
+		t.Error("expected an error without a secret key")
+	}
+}
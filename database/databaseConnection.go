@@ -10,16 +10,27 @@ import (
 
 type Connection struct {
 	*mongo.Client
-	UserCollection         *mongo.Collection
-	FlagCollection         *mongo.Collection
-	StoryCollection        *mongo.Collection
-	ReadLaterCollection    *mongo.Collection
-	CommentsCollection     *mongo.Collection
-	RepliesCollection      *mongo.Collection
-	ConversationCollection *mongo.Collection
-	MessageCollection      *mongo.Collection
-	NotificationCollection *mongo.Collection
-	IdentityCollection     *mongo.Collection
+	UserCollection           *mongo.Collection
+	FlagCollection           *mongo.Collection
+	StoryCollection          *mongo.Collection
+	ReadLaterCollection      *mongo.Collection
+	CommentsCollection       *mongo.Collection
+	RepliesCollection        *mongo.Collection
+	ConversationCollection   *mongo.Collection
+	MessageCollection        *mongo.Collection
+	NotificationCollection   *mongo.Collection
+	IdentityCollection       *mongo.Collection
+	RefreshTokenCollection   *mongo.Collection
+	RevokedTokenCollection   *mongo.Collection
+	LoginAttemptCollection   *mongo.Collection
+	SessionCollection        *mongo.Collection
+	MagicLinkCollection      *mongo.Collection
+	ApiKeyCollection         *mongo.Collection
+	OidcStateCollection      *mongo.Collection
+	FollowCollection         *mongo.Collection
+	MuteCollection           *mongo.Collection
+	DataExportCollection     *mongo.Collection
+	UsernameChangeCollection *mongo.Collection
 	*mongo.Database
 }
 
@@ -30,16 +41,34 @@ func ConnectToDB() {
 	n := config.Config("DB_NAME")
 	h := config.Config("DB_HOST")
 
+	dbConnection, err := Connect(n+h+p, "story-service")
+
+	if err != nil {
+		panic(err)
+	}
+
+	MongoConn = dbConnection
+}
+
+// Connect opens the database and creates its indexes, tests use it with a database of their own
+func Connect(uri string, name string) (*Connection, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(n+h+p))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+
+	err = client.Ping(ctx, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
 	// create database
-	db := client.Database("story-service")
+	db := client.Database(name)
 
 	// create collection
 	userCollection := db.Collection("users")
@@ -52,11 +81,28 @@ func ConnectToDB() {
 	messageCollection := db.Collection("message")
 	notificationCollection := db.Collection("notification")
 	identityCollection := db.Collection("identity")
+	refreshTokenCollection := db.Collection("refreshTokens")
+	revokedTokenCollection := db.Collection("revokedTokens")
+	loginAttemptCollection := db.Collection("loginAttempts")
+	sessionCollection := db.Collection("sessions")
+	magicLinkCollection := db.Collection("magicLinks")
+	apiKeyCollection := db.Collection("apiKeys")
+	oidcStateCollection := db.Collection("oidcStates")
+	followCollection := db.Collection("follows")
+	muteCollection := db.Collection("mutes")
+	dataExportCollection := db.Collection("dataExports")
+	usernameChangeCollection := db.Collection("usernameChanges")
 
 	dbConnection := &Connection{client, userCollection, flagCollection, storiesCollection,
 		commentsCollection, repliesCollection, readLaterCollection,
 		conversationCollection, messageCollection, notificationCollection, identityCollection,
-		db}
+		refreshTokenCollection, revokedTokenCollection, loginAttemptCollection, sessionCollection,
+		magicLinkCollection, apiKeyCollection, oidcStateCollection, followCollection, muteCollection, dataExportCollection,
+		usernameChangeCollection, db}
 
-	MongoConn = dbConnection
+	if err = createIndexes(dbConnection); err != nil {
+		return nil, err
+	}
+
+	return dbConnection, nil
 }
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// createIndexes most indexes only speed up queries and a failure is logged, the ones correctness depends on are an
+// error
+func createIndexes(conn *Connection) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	// expired refresh tokens, revocations, login attempts, sessions, magic links and oidc states are removed by mongo once "expiresAt" has passed
+	_, err := conn.RefreshTokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"tokenHash", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"family", 1}}},
+		{Keys: bson.D{{"userId", 1}}},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.RevokedTokenCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"jti", 1}}},
+		{Keys: bson.D{{"sessionId", 1}}},
+		{Keys: bson.D{{"userId", 1}}},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.LoginAttemptCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"key", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.SessionCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"userId", 1}}},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.MagicLinkCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"tokenHash", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.ApiKeyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"keyHash", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"userId", 1}}},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.OidcStateCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"stateHash", 1}}},
+		{Keys: bson.D{{"signupTokenHash", 1}}},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.FollowCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"followerId", 1}, {"followeeId", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"followeeId", 1}, {"status", 1}, {"createdAt", -1}}},
+		{Keys: bson.D{{"followerId", 1}, {"status", 1}, {"createdAt", -1}}},
+		{Keys: bson.D{{"followerUsername", 1}, {"followeeUsername", 1}}},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	// mutes without "expiresAt" never expire
+	_, err = conn.MuteCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"userId", 1}, {"kind", 1}, {"value", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	// the archive itself is removed by the next export that is built after it expired
+	_, err = conn.DataExportCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"userId", 1}, {"createdAt", -1}}},
+		{Keys: bson.D{{"expiresAt", 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.UserCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"externalIdentities.provider", 1}, {"externalIdentities.subject", 1}}},
+		{Keys: bson.D{{"followerCount", -1}}},
+		{Keys: bson.D{{"reputation", -1}}},
+		// the purge job only looks at accounts waiting to be deleted
+		{Keys: bson.D{{"deletionScheduledAt", 1}}, Options: options.Index().SetPartialFilterExpression(bson.D{{"pendingDeletion", true}})},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	// renames claim a username with a plain update, the index is what stops two users from getting the same one
+	_, err = conn.UserCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"username", 1}}, Options: options.Index().SetUnique(true),
+	})
+
+	// usually duplicate usernames from before the index, they have to be resolved by hand
+	if err != nil {
+		return fmt.Errorf("unique username index: %w", err)
+	}
+
+	// the most recent views of a user drive the suggested authors
+	_, err = conn.IdentityCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"username", 1}, {"_id", -1}},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = conn.UsernameChangeCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"oldUsername", 1}, {"createdAt", -1}}},
+		{Keys: bson.D{{"userId", 1}, {"createdAt", -1}}},
+		{Keys: bson.D{{"migrated", 1}}, Options: options.Index().SetPartialFilterExpression(bson.D{{"migrated", false}})},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	// the review queue and the upheld flags of a user for the reputation
+	_, err = conn.FlagCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"status", 1}, {"createdAt", 1}}},
+		{Keys: bson.D{{"flaggedUsername", 1}, {"status", 1}}},
+	})
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	return nil
+}
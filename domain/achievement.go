@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// activities that can unlock achievements
+const (
+	ActivityStoryCreated = "storyCreated"
+	ActivityLikeReceived = "likeReceived"
+	ActivityFollowed     = "followed"
+)
+
+// metrics the achievement rules are evaluated against
+const (
+	MetricStories        = "stories"
+	MetricLikesReceived  = "likesReceived"
+	MetricFollowers      = "followers"
+	MetricWritingStreak  = "writingStreak"
+	MetricTopStoryOfWeek = "topStoryOfWeek"
+)
+
+// Achievement is unlocked once Metric reaches Threshold, it is only evaluated after one of its Activities.
+// Achievements without Activities are awarded by a scheduled job instead. It unlocks its badge, its tagline or both.
+type Achievement struct {
+	Id          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Metric      string   `json:"-"`
+	Threshold   int      `json:"-"`
+	Activities  []string `json:"-"`
+	BadgeUrl    string   `json:"badgeUrl,omitempty"`
+	TagLine     string   `json:"tagLine,omitempty"`
+}
+
+// Achievements every rule, a user unlocks each one once
+var Achievements = []Achievement{
+	{Id: "first-story", Name: "First story", Description: "Publish your first story",
+		Metric: MetricStories, Threshold: 1, Activities: []string{ActivityStoryCreated},
+		BadgeUrl: "/badges/first-story.png", TagLine: "Storyteller"},
+	{Id: "ten-stories", Name: "Prolific", Description: "Publish 10 stories",
+		Metric: MetricStories, Threshold: 10, Activities: []string{ActivityStoryCreated},
+		BadgeUrl: "/badges/ten-stories.png"},
+	{Id: "hundred-likes", Name: "Crowd pleaser", Description: "Receive 100 likes on your stories",
+		Metric: MetricLikesReceived, Threshold: 100, Activities: []string{ActivityLikeReceived},
+		BadgeUrl: "/badges/hundred-likes.png", TagLine: "Crowd pleaser"},
+	{Id: "hundred-followers", Name: "Following", Description: "Be followed by 100 users",
+		Metric: MetricFollowers, Threshold: 100, Activities: []string{ActivityFollowed},
+		BadgeUrl: "/badges/hundred-followers.png", TagLine: "Trendsetter"},
+	{Id: "thirty-day-streak", Name: "Dedicated", Description: "Publish a story every day for 30 days",
+		Metric: MetricWritingStreak, Threshold: 30, Activities: []string{ActivityStoryCreated},
+		BadgeUrl: "/badges/thirty-day-streak.png", TagLine: "Never misses a day"},
+	{Id: "top-story-of-the-week", Name: "Top story of the week", Description: "Write the most liked story of the last 7 days",
+		Metric: MetricTopStoryOfWeek, Threshold: 1,
+		BadgeUrl: "/badges/top-story-of-the-week.png", TagLine: "Top of the week"},
+}
+
+// TriggeredBy the achievements an activity can unlock
+func TriggeredBy(activity string) []Achievement {
+	achievements := make([]Achievement, 0)
+
+	for _, a := range Achievements {
+		for _, act := range a.Activities {
+			if act == activity {
+				achievements = append(achievements, a)
+				break
+			}
+		}
+	}
+
+	return achievements
+}
+
+// UnlockMessage is the notification sent for an achievement
+func (a Achievement) UnlockMessage() string {
+	return fmt.Sprintf("You unlocked \"%v\": %v", a.Name, a.Description)
+}
+
+// AchievementDto is an achievement as a user sees it
+type AchievementDto struct {
+	Achievement
+	Unlocked bool `json:"unlocked"`
+}
+
+var (
+	// ErrBadgeLocked is returned when a user picks a badge they haven't unlocked
+	ErrBadgeLocked = errors.New("badge is not unlocked")
+	// ErrTagLineLocked is returned when a user picks a tagline they haven't unlocked
+	ErrTagLineLocked = errors.New("tagline is not unlocked")
+)
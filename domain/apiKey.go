@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeReadStories       = "stories:read"
+	ScopeWriteStories      = "stories:write"
+	ScopeWriteComments     = "comments:write"
+	ScopeReadNotifications = "notifications:read"
+	ScopeReadReadLater     = "readlater:read"
+	ScopeWriteReadLater    = "readlater:write"
+)
+
+var allScopes = map[string]bool{
+	ScopeReadStories:       true,
+	ScopeWriteStories:      true,
+	ScopeWriteComments:     true,
+	ScopeReadNotifications: true,
+	ScopeReadReadLater:     true,
+	ScopeWriteReadLater:    true,
+}
+
+// ApiKey is a personal key for scripts and integrations. Only the hash of the key is stored, Prefix is the start of
+// the key so the owner can tell their keys apart.
+type ApiKey struct {
+	Id         primitive.ObjectID `bson:"_id" json:"id"`
+	UserId     primitive.ObjectID `bson:"userId" json:"-"`
+	Username   string             `bson:"username" json:"-"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	KeyHash    string             `bson:"keyHash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	Revoked    bool               `bson:"revoked" json:"-"`
+	Suspended  bool               `bson:"suspended,omitempty" json:"-"`
+	LastUsedAt time.Time          `bson:"lastUsedAt" json:"lastUsedAt"`
+	LastUsedIp string             `bson:"lastUsedIp" json:"lastUsedIp"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// CreateApiKey todo validate struct
+type CreateApiKey struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedApiKey the key is only ever shown in this response
+type CreatedApiKey struct {
+	ApiKey *ApiKey `json:"apiKey"`
+	Key    string  `json:"key"`
+}
+
+func (a CreateApiKey) Validate() error {
+	if strings.TrimSpace(a.Name) == "" || len(a.Name) > 50 {
+		return fmt.Errorf("name must be between 1 and 50 characters")
+	}
+
+	if len(a.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, s := range a.Scopes {
+		if !allScopes[s] {
+			return fmt.Errorf("invalid scope %v", s)
+		}
+	}
+
+	return nil
+}
+
+func (a ApiKey) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
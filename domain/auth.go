@@ -1,13 +1,14 @@
 package domain
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gofiber/fiber/v2/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"story-app-monolith/config"
 	"story-app-monolith/helpers"
+	"story-app-monolith/keyring"
 	"strconv"
 	"strings"
 	"time"
@@ -16,6 +17,14 @@ import (
 type Authentication struct {
 	Id primitive.ObjectID
 	Username string `bson:"username" json:"username"`
+	Jti string `bson:"-" json:"-"`
+	// IssuedAtMs is in milliseconds so a revocation can tell tokens from the same second apart
+	IssuedAtMs int64 `bson:"-" json:"-"`
+	ExpiresAt int64 `bson:"-" json:"-"`
+	Role string `bson:"-" json:"-"`
+	Permissions []string `bson:"-" json:"-"`
+	SessionId string `bson:"-" json:"-"`
+	Reactivate bool `bson:"-" json:"-"`
 }
 
 // LoginDetails todo validate struct
@@ -35,14 +44,54 @@ type ResetPassword struct {
 	Password string `bson:"password" json:"password"`
 }
 
+// Claims the token id is carried in the standard "jti" claim (StandardClaims.Id) so that a single token can be revoked.
+// Purpose is empty for access tokens, any other value marks a single use token that can't be used as one.
 type Claims struct {
 	jwt.StandardClaims
-	Id       primitive.ObjectID
-	Username string
+	Id          primitive.ObjectID
+	Username    string
+	Role        string   `json:"role,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	SessionId   string   `json:"sid,omitempty"`
+	Purpose     string   `json:"purpose,omitempty"`
+	Reactivate  bool     `json:"reactivate,omitempty"`
+	IssuedAtMs  int64    `json:"iatms,omitempty"`
 }
 
-var k = config.Config("SECRET")
+// issuedAtMs tokens from before iatms only have the second they were issued in
+func (c Claims) issuedAtMs() int64 {
+	if c.IssuedAtMs != 0 {
+		return c.IssuedAtMs
+	}
+
+	return c.IssuedAt * 1000
+}
+
+// UnixMs the time in milliseconds, like the iatms claim
+func UnixMs(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
 
+// LoginResult either carries the issued tokens or, when the account has 2FA enabled, only the MfaToken.
+// A login to a deactivated account only carries the ReactivationToken.
+type LoginResult struct {
+	User              *UserDto
+	AccessToken       string
+	RefreshToken      string
+	MfaToken          string
+	ReactivationToken string
+}
+
+const mfaPurpose = "mfa"
+
+var (
+	// ErrAccountLocked is returned by Login while the account is temporarily locked after too many failed attempts
+	ErrAccountLocked = errors.New("account is locked, check your email to unlock it or try again later")
+	// ErrTooManyAttempts is returned by Login while the account or the ip has to wait before trying again
+	ErrTooManyAttempts = errors.New("too many login attempts, try again later")
+)
+
+// GenerateJWT issues an access token for the user, l.SessionId is carried in the "sid" claim
 func (l Authentication) GenerateJWT(msg User) (string, error){
 	e, err := strconv.Atoi(config.Config("EXPIRATION"))
 
@@ -50,16 +99,66 @@ func (l Authentication) GenerateJWT(msg User) (string, error){
 		return "", err
 	}
 
+	now := time.Now()
+
 	claims := Claims{
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Duration(e) * time.Minute).Unix(),
+			Id:        utils.UUIDv4(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(time.Duration(e) * time.Minute).Unix(),
 		},
-		Id:       msg.Id,
-		Username: msg.Username,
+		Id:          msg.Id,
+		Username:    msg.Username,
+		Role:        msg.Role,
+		Permissions: EffectivePermissions(msg.Role, msg.Permissions),
+		SessionId:   l.SessionId,
+		IssuedAtMs:  UnixMs(now),
 	}
 	// always better to use a pointer with JSON
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &claims)
-	signedString, err := token.SignedString([]byte(k))
+	return signJWT(&claims)
+}
+
+// GenerateMfaToken issues the short-lived "mfa pending" token that is exchanged together with a code. reactivate
+// carries a confirmed reactivation along, the account only comes back once the code was accepted.
+func (l Authentication) GenerateMfaToken(msg User, reactivate bool) (string, error) {
+	e, err := strconv.Atoi(config.Config("MFA_TOKEN_EXPIRATION"))
+
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        utils.UUIDv4(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(time.Duration(e) * time.Minute).Unix(),
+		},
+		Id:         msg.Id,
+		Username:   msg.Username,
+		Purpose:    mfaPurpose,
+		Reactivate: reactivate,
+		IssuedAtMs: UnixMs(now),
+	}
+
+	return signJWT(&claims)
+}
+
+// signJWT signs with the primary access token key, its id goes in the "kid" header
+func signJWT(claims *Claims) (string, error) {
+	k, err := keyring.For(keyring.Access)
+
+	if err != nil {
+		return "", err
+	}
+
+	kid, key := k.Primary()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+
+	signedString, err := token.SignedString(key)
 
 	if err != nil {
 		return "", err
@@ -67,25 +166,81 @@ func (l Authentication) GenerateJWT(msg User) (string, error){
 	return signedString, nil
 }
 
+// jwtKey finds the verification key by the "kid" header, tokens from before key ids were signed with the default key
+func jwtKey(t *jwt.Token) (interface{}, error) {
+	if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+
+	kid, _ := t.Header["kid"].(string)
+
+	if kid == "" {
+		kid = keyring.DefaultKid
+	}
+
+	k, err := keyring.For(keyring.Access)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := k.Key(kid)
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+
+	return key, nil
+}
+
+func (l Authentication) ParseMfaToken(tokenValue string) (*Authentication, error) {
+	token, err := jwt.ParseWithClaims(tokenValue, &Claims{}, jwtKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*Claims)
+
+	if !token.Valid || claims.Purpose != mfaPurpose {
+		return nil, fmt.Errorf("token is not valid")
+	}
+
+	l.Id = claims.Id
+	l.Username = strings.ToLower(claims.Username)
+	l.Jti = claims.StandardClaims.Id
+	l.IssuedAtMs = claims.issuedAtMs()
+	l.ExpiresAt = claims.ExpiresAt
+	l.Reactivate = claims.Reactivate
+
+	return &l, nil
+}
+
+// SignToken signs the bearer token with the primary access token key
 func (l Authentication) SignToken(token []byte) ([]byte, error) {
-	// second arg is a private key, key needs to be the same size as hasher
-	// sha512 is 64 bits
-	h := hmac.New(sha256.New, []byte(k))
+	return l.SignTokenFor(keyring.Access, token)
+}
+
+// SignTokenFor signs with the primary key of the purpose, so e.g. reset tokens don't share a key with access tokens
+func (l Authentication) SignTokenFor(purpose keyring.Purpose, token []byte) ([]byte, error) {
+	k, err := keyring.For(purpose)
 
-	// hash is a writer
-	_, err := h.Write(token)
 	if err != nil {
 		return nil, err
 	}
 
-	return []byte(fmt.Sprintf("%x", h.Sum(nil))), nil
+	return k.Sign(token)
 }
 
+// VerifySignature accepts a bearer signature made with any of the access token keys
 func (l Authentication) VerifySignature(token, sig []byte) (bool, error) {
-	// sign message
-	s, err := l.SignToken(token)
-	// compare it
-	return hmac.Equal(sig, s), err
+	k, err := keyring.For(keyring.Access)
+
+	if err != nil {
+		return false, err
+	}
+
+	return k.Verify(token, sig)
 }
 
 func(l Authentication) IsLoggedIn(tokenValue string) (*Authentication, bool, error)  {
@@ -109,19 +264,14 @@ func(l Authentication) IsLoggedIn(tokenValue string) (*Authentication, bool, err
 		return nil, false, err
 	}
 
-	token, err := jwt.ParseWithClaims(data[0], &Claims{},func(t *jwt.Token)(interface{}, error) {
-		if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
-			//verify token(we pass in our key to be verified)
-			return []byte(k), nil
-		}
-		return nil, err
-	})
+	token, err := jwt.ParseWithClaims(data[0], &Claims{}, jwtKey)
 
 	if err != nil {
 		return nil, false, err
 	}
 
-	isEqual := token.Valid
+	// single use tokens (e.g. mfa pending) must never be accepted as access tokens
+	isEqual := token.Valid && token.Claims.(*Claims).Purpose == ""
 
 	if isEqual {
 		// user is logged in at this point
@@ -130,6 +280,12 @@ func(l Authentication) IsLoggedIn(tokenValue string) (*Authentication, bool, err
 
 		l.Id = claims.Id
 		l.Username = strings.ToLower(claims.Username)
+		l.Jti = claims.StandardClaims.Id
+		l.IssuedAtMs = claims.issuedAtMs()
+		l.ExpiresAt = claims.ExpiresAt
+		l.Role = claims.Role
+		l.Permissions = claims.Permissions
+		l.SessionId = claims.SessionId
 		return &l, true, nil
 	}
 
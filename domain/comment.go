@@ -20,6 +20,8 @@ type Comment struct {
 	UpdatedAt      time.Time          `bson:"updatedAt" json:"-"`
 	CreatedDate    string             `bson:"createdDate" json:"-"`
 	UpdatedDate    string             `bson:"updatedDate" json:"-"`
+	// AuthorDeactivated hides the comment while its author is deactivated
+	AuthorDeactivated bool `bson:"authorDeactivated,omitempty" json:"-"`
 }
 
 type CommentDto struct {
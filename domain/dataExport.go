@@ -0,0 +1,27 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// DataExport is a job that collects everything stored about a user into a zip archive. DownloadUrl is only set while
+// the export is ready and is signed, it works without being logged in until ExpiresAt.
+type DataExport struct {
+	Id          primitive.ObjectID `bson:"_id" json:"id"`
+	UserId      primitive.ObjectID `bson:"userId" json:"-"`
+	Status      string             `bson:"status" json:"status"`
+	File        string             `bson:"file" json:"-"`
+	Size        int64              `bson:"size" json:"size"`
+	DownloadUrl string             `bson:"-" json:"downloadUrl,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	CompletedAt time.Time          `bson:"completedAt" json:"completedAt"`
+	ExpiresAt   time.Time          `bson:"expiresAt" json:"expiresAt"`
+}
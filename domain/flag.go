@@ -1,14 +1,55 @@
 package domain
 
 import (
+	"errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// a flag waits for a reviewer, only upheld flags count against the flagged user's reputation
+const (
+	FlagStatusPending   = "pending"
+	FlagStatusUpheld    = "upheld"
+	FlagStatusDismissed = "dismissed"
 )
 
 // Flag todo validate struct
 type Flag struct {
-	Id        primitive.ObjectID `bson:"_id" json:"-"`
-	FlaggerID  primitive.ObjectID `bson:"flaggerID" json:"-"`
-	FlaggedUsername string `bson:"flaggedUsername" json:"-"`
+	Id              primitive.ObjectID `bson:"_id" json:"-"`
+	FlaggerID       primitive.ObjectID `bson:"flaggerID" json:"-"`
+	FlaggedUsername string             `bson:"flaggedUsername" json:"-"`
 	FlaggedResource primitive.ObjectID `bson:"flaggedResource" json:"-"`
-	Reason  string             `bson:"reason" json:"reason"`
+	Reason          string             `bson:"reason" json:"reason"`
+	Status          string             `bson:"status" json:"-"`
+	ReviewedBy      primitive.ObjectID `bson:"reviewedBy,omitempty" json:"-"`
+	ReviewedAt      time.Time          `bson:"reviewedAt,omitempty" json:"-"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"-"`
+}
+
+// FlagDto is a flag as a reviewer sees it, FlaggedResource is empty when a user was flagged
+type FlagDto struct {
+	Id              primitive.ObjectID `bson:"_id" json:"id"`
+	FlaggedUsername string             `bson:"flaggedUsername" json:"flaggedUsername"`
+	FlaggedResource primitive.ObjectID `bson:"flaggedResource" json:"flaggedResource,omitempty"`
+	Reason          string             `bson:"reason" json:"reason"`
+	Status          string             `bson:"status" json:"status"`
+	ReviewedAt      time.Time          `bson:"reviewedAt" json:"reviewedAt,omitempty"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type FlagList struct {
+	Flags         []FlagDto `json:"flags"`
+	NumberOfFlags int64     `json:"numberOfFlags"`
+	CurrentPage   int       `json:"currentPage"`
+	NumberOfPages int       `json:"numberOfPages"`
+}
+
+// ReviewFlag todo validate struct
+type ReviewFlag struct {
+	Status string `json:"status"`
 }
+
+var (
+	ErrInvalidFlagStatus = errors.New("a flag can only be upheld or dismissed")
+	ErrFlagNotFound      = errors.New("flag not found")
+)
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	// FollowStatusPending is a follow request to a private account that hasn't been accepted yet
+	FollowStatusPending  = "pending"
+	FollowStatusAccepted = "accepted"
+)
+
+// Follow is an edge of the follow graph, there is at most one per follower and followee
+type Follow struct {
+	Id               primitive.ObjectID `bson:"_id" json:"-"`
+	FollowerId       primitive.ObjectID `bson:"followerId" json:"-"`
+	FollowerUsername string             `bson:"followerUsername" json:"-"`
+	FolloweeId       primitive.ObjectID `bson:"followeeId" json:"-"`
+	FolloweeUsername string             `bson:"followeeUsername" json:"-"`
+	Status           string             `bson:"status" json:"-"`
+	CreatedAt        time.Time          `bson:"createdAt" json:"-"`
+	AcceptedAt       time.Time          `bson:"acceptedAt" json:"-"`
+}
+
+type FollowDto struct {
+	Username          string    `json:"username"`
+	ProfilePictureUrl string    `json:"profilePictureUrl"`
+	CurrentTagLine    string    `json:"currentTagLine"`
+	Since             time.Time `json:"since"`
+}
+
+type FollowList struct {
+	Users         []FollowDto `json:"users"`
+	NumberOfUsers int64       `json:"numberOfUsers"`
+	CurrentPage   int         `json:"currentPage"`
+	NumberOfPages int         `json:"numberOfPages"`
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// LoginAttempt counts recent failed logins for a key, either "ip:<address>" or "user:<id>".
+// The document expires after a quiet period which resets the count.
+type LoginAttempt struct {
+	Id            primitive.ObjectID `bson:"_id" json:"-"`
+	Key           string             `bson:"key" json:"-"`
+	Failures      int                `bson:"failures" json:"-"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt" json:"-"`
+	ExpiresAt     time.Time          `bson:"expiresAt" json:"-"`
+}
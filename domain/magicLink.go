@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// MagicLink is a single use login link. Only hashes are stored, NonceHash binds the link to the browser that asked
+// for it through the nonce cookie.
+type MagicLink struct {
+	Id        primitive.ObjectID `bson:"_id" json:"-"`
+	UserId    primitive.ObjectID `bson:"userId" json:"-"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	NonceHash string             `bson:"nonceHash" json:"-"`
+	Used      bool               `bson:"used" json:"-"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"-"`
+}
+
+// MagicLinkRequest todo validate struct
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type UpdateMagicLink struct {
+	MagicLinkEnabled bool      `json:"magicLinkEnabled"`
+	UpdatedAt        time.Time `bson:"updatedAt" json:"-"`
+}
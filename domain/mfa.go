@@ -0,0 +1,19 @@
+package domain
+
+// MfaEnrollment is returned once when 2FA enrolment starts, the recovery codes are never shown again
+type MfaEnrollment struct {
+	Secret        string   `json:"secret"`
+	OtpAuthUri    string   `json:"otpAuthUri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// MfaCode todo validate struct
+type MfaCode struct {
+	Code string `json:"code"`
+}
+
+// MfaVerification todo validate struct
+type MfaVerification struct {
+	MfaToken string `json:"mfaToken"`
+	Code     string `json:"code"`
+}
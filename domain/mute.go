@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+const (
+	MuteKindUser    = "user"
+	MuteKindTag     = "tag"
+	MuteKindKeyword = "keyword"
+)
+
+// Mute hides content for the muting user only, the muted user is never told. ExpiresAt is nil for mutes that don't
+// expire.
+type Mute struct {
+	Id        primitive.ObjectID `bson:"_id" json:"id"`
+	UserId    primitive.ObjectID `bson:"userId" json:"-"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Value     string             `bson:"value" json:"value"`
+	ExpiresAt *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+type CreateMute struct {
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (m *CreateMute) Validate() error {
+	m.Kind = strings.ToLower(strings.TrimSpace(m.Kind))
+	m.Value = strings.ToLower(strings.Join(strings.Fields(m.Value), " "))
+
+	switch m.Kind {
+	case MuteKindUser:
+		if len(m.Value) <= 1 {
+			return fmt.Errorf("invalid username")
+		}
+	case MuteKindTag:
+		err := Tag{Value: m.Value}.ValidateTag(&Tag{})
+
+		if err != nil {
+			return err
+		}
+	case MuteKindKeyword:
+		if len(m.Value) < 2 || len(m.Value) > 100 {
+			return fmt.Errorf("keywords must be between 2 and 100 characters")
+		}
+	default:
+		return fmt.Errorf("kind must be one of %v, %v or %v", MuteKindUser, MuteKindTag, MuteKindKeyword)
+	}
+
+	if m.ExpiresAt != nil && !m.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expiresAt must be in the future")
+	}
+
+	return nil
+}
+
+// MuteFilter holds the active mutes of a user, values are lowercase
+type MuteFilter struct {
+	Usernames []string
+	Tags      []string
+	Keywords  []string
+}
+
+func (f *MuteFilter) IsEmpty() bool {
+	return f == nil || len(f.Usernames) == 0 && len(f.Tags) == 0 && len(f.Keywords) == 0
+}
+
+// Hides reports whether content by author is muted, either by the author or by a keyword in one of the texts
+func (f *MuteFilter) Hides(author string, texts ...string) bool {
+	if f == nil {
+		return false
+	}
+
+	for _, username := range f.Usernames {
+		if username == strings.ToLower(author) {
+			return true
+		}
+	}
+
+	for _, text := range texts {
+		text = strings.ToLower(text)
+
+		for _, keyword := range f.Keywords {
+			if strings.Contains(text, keyword) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
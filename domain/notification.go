@@ -8,6 +8,7 @@ import (
 type Notification struct {
 	Id        primitive.ObjectID `bson:"_id" json:"id"`
 	For       string             `bson:"for" json:"-"`
+	From      string             `bson:"from" json:"-"`
 	Content   string             `bson:"content" json:"content"`
 	Path      string             `bson:"path" json:"path"`
 	ReadStatus    bool               `bson:"readStatus" json:"-"`
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ExternalIdentity links an account to the subject of an OpenID Connect provider
+type ExternalIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"-"`
+	Email    string    `bson:"email" json:"email"`
+	LinkedAt time.Time `bson:"linkedAt" json:"linkedAt"`
+}
+
+// OidcState is stored between sending the user to the provider and the callback. When the callback finds no account
+// to sign in to, the same document is kept for the signup with SignupTokenHash set.
+type OidcState struct {
+	Id              primitive.ObjectID `bson:"_id" json:"-"`
+	StateHash       string             `bson:"stateHash" json:"-"`
+	Provider        string             `bson:"provider" json:"-"`
+	Nonce           string             `bson:"nonce" json:"-"`
+	CodeVerifier    string             `bson:"codeVerifier" json:"-"`
+	SignupTokenHash string             `bson:"signupTokenHash" json:"-"`
+	Subject         string             `bson:"subject" json:"-"`
+	Email           string             `bson:"email" json:"-"`
+	ExpiresAt       time.Time          `bson:"expiresAt" json:"-"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"-"`
+}
+
+// OidcLoginResult either signs the user in or asks them to pick a username for a new account
+type OidcLoginResult struct {
+	Login             *LoginResult
+	SignupToken       string
+	Email             string
+	SuggestedUsername string
+}
+
+// OidcSignup todo validate struct
+type OidcSignup struct {
+	SignupToken string `json:"signupToken"`
+	Username    string `json:"username"`
+}
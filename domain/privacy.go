@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"errors"
+)
+
+// who gets to see or do something, followers means accepted followers. The owner is always in their own audience.
+const (
+	AudienceEveryone  = "everyone"
+	AudienceFollowers = "followers"
+	AudienceNobody    = "nobody"
+)
+
+// PrivacySettings picks an audience for each part of the account others can see or use
+type PrivacySettings struct {
+	Profile       string `bson:"profile" json:"profile"`
+	Stories       string `bson:"stories" json:"stories"`
+	FollowerCount string `bson:"followerCount" json:"followerCount"`
+	Messages      string `bson:"messages" json:"messages"`
+	Mentions      string `bson:"mentions" json:"mentions"`
+	ReadActivity  string `bson:"readActivity" json:"readActivity"`
+}
+
+// UpdatePrivacySettings only the fields that are sent are changed
+type UpdatePrivacySettings struct {
+	Profile       *string `json:"profile"`
+	Stories       *string `json:"stories"`
+	FollowerCount *string `json:"followerCount"`
+	Messages      *string `json:"messages"`
+	Mentions      *string `json:"mentions"`
+	ReadActivity  *string `json:"readActivity"`
+}
+
+// ReadActivity is a story the user read, most recent first
+type ReadActivity struct {
+	Stories []StoryPreviewDto `json:"stories"`
+}
+
+// MaxMentions is how many users one comment or reply can notify
+const MaxMentions = 10
+
+var (
+	ErrInvalidAudience = errors.New("audience must be everyone, followers or nobody")
+	// ErrReadActivityNotViewable is returned when the user doesn't share what they read with the viewer
+	ErrReadActivityNotViewable = errors.New("cannot view read activity")
+)
+
+// DefaultPrivacySettings what new accounts start with, what someone reads is kept to themselves until they share it
+func DefaultPrivacySettings() PrivacySettings {
+	return PrivacySettings{
+		Profile:       AudienceEveryone,
+		Stories:       AudienceEveryone,
+		FollowerCount: AudienceEveryone,
+		Messages:      AudienceEveryone,
+		Mentions:      AudienceEveryone,
+		ReadActivity:  AudienceNobody,
+	}
+}
+
+// Fields the bson fields to set, or ErrInvalidAudience when one of them isn't an audience
+func (u UpdatePrivacySettings) Fields() (map[string]string, error) {
+	fields := map[string]*string{
+		"profile":       u.Profile,
+		"stories":       u.Stories,
+		"followerCount": u.FollowerCount,
+		"messages":      u.Messages,
+		"mentions":      u.Mentions,
+		"readActivity":  u.ReadActivity,
+	}
+
+	set := make(map[string]string)
+
+	for field, audience := range fields {
+		if audience == nil {
+			continue
+		}
+
+		if !ValidAudience(*audience) {
+			return nil, ErrInvalidAudience
+		}
+
+		set[field] = *audience
+	}
+
+	return set, nil
+}
+
+func ValidAudience(audience string) bool {
+	return audience == AudienceEveryone || audience == AudienceFollowers || audience == AudienceNobody
+}
+
+// InAudience followStatus is the viewer's follow of the owner, empty when there is none
+func InAudience(audience string, isOwner bool, followStatus string) bool {
+	if isOwner {
+		return true
+	}
+
+	switch audience {
+	case AudienceEveryone:
+		return true
+	case AudienceFollowers:
+		return followStatus == FollowStatusAccepted
+	}
+
+	return false
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RefreshToken is the server side record of a long-lived refresh token. Only the hash of the token is stored,
+// every token issued from the same login shares a Family so that a replayed token can revoke all of them.
+type RefreshToken struct {
+	Id        primitive.ObjectID `bson:"_id" json:"-"`
+	UserId    primitive.ObjectID `bson:"userId" json:"-"`
+	Username  string             `bson:"username" json:"-"`
+	Family    primitive.ObjectID `bson:"family" json:"-"`
+	TokenHash string             `bson:"tokenHash" json:"-"`
+	Used      bool               `bson:"used" json:"-"`
+	Revoked   bool               `bson:"revoked" json:"-"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"-"`
+	CreatedAt time.Time          `bson:"createdAt" json:"-"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"-"`
+}
+
+// RefreshTokenRequest todo validate struct
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
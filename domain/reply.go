@@ -21,6 +21,8 @@ type Reply struct {
 	UpdatedAt           time.Time          `bson:"updatedAt" json:"updatedAt"`
 	CreatedDate         string             `bson:"createdDate" json:"createdDate"`
 	UpdatedDate         string             `bson:"updatedDate" json:"updatedDate"`
+	// AuthorDeactivated hides the reply while its author is deactivated
+	AuthorDeactivated bool `bson:"authorDeactivated,omitempty" json:"-"`
 }
 
 type CreateReply struct {
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// what every like, dislike and upheld flag is worth to the reputation of the author
+const (
+	ReputationStoryLike      = 2.0
+	ReputationStoryDislike   = -1.0
+	ReputationCommentLike    = 1.0
+	ReputationCommentDislike = -0.5
+	ReputationUpheldFlag     = -10.0
+)
+
+// ReputationHalfLife older activity counts for less, after every half life it's worth half as much
+const ReputationHalfLife = 180 * 24 * time.Hour
+
+// SortByReputation lists the users with the best reputation first
+const SortByReputation = "reputation"
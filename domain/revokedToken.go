@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// RevokedToken either revokes a single access token by its jti, every access token of a session, or every access token
+// of a user issued at or before RevokedBeforeMs, in milliseconds. Documents expire once the tokens they cover could no
+// longer be valid.
+type RevokedToken struct {
+	Id              primitive.ObjectID `bson:"_id" json:"-"`
+	Jti             string             `bson:"jti,omitempty" json:"-"`
+	SessionId       primitive.ObjectID `bson:"sessionId,omitempty" json:"-"`
+	UserId          primitive.ObjectID `bson:"userId" json:"-"`
+	RevokedBeforeMs int64              `bson:"revokedBeforeMs,omitempty" json:"-"`
+	ExpiresAt       time.Time          `bson:"expiresAt" json:"-"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"-"`
+}
+
+// LogoutRequest todo validate struct
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
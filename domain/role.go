@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	PermissionModerateStories  = "stories:moderate"
+	PermissionModerateComments = "comments:moderate"
+	PermissionReviewFlags      = "flags:review"
+	PermissionManageUsers      = "users:manage"
+	PermissionManageRoles      = "roles:manage"
+)
+
+// RolePermissions is what every role is granted, a user can be granted extra permissions on top of their role
+var RolePermissions = map[string][]string{
+	RoleUser:      {},
+	RoleModerator: {PermissionModerateStories, PermissionModerateComments, PermissionReviewFlags},
+	RoleAdmin: {PermissionModerateStories, PermissionModerateComments, PermissionReviewFlags,
+		PermissionManageUsers, PermissionManageRoles},
+}
+
+var allPermissions = map[string]bool{
+	PermissionModerateStories:  true,
+	PermissionModerateComments: true,
+	PermissionReviewFlags:      true,
+	PermissionManageUsers:      true,
+	PermissionManageRoles:      true,
+}
+
+// UpdateRole todo validate struct
+type UpdateRole struct {
+	Role        string    `json:"role"`
+	Permissions []string  `json:"permissions"`
+	UpdatedAt   time.Time `bson:"updatedAt" json:"-"`
+}
+
+func (r UpdateRole) Validate() error {
+	if _, ok := RolePermissions[r.Role]; !ok {
+		return fmt.Errorf("invalid role %v", r.Role)
+	}
+
+	for _, p := range r.Permissions {
+		if !allPermissions[p] {
+			return fmt.Errorf("invalid permission %v", p)
+		}
+	}
+
+	return nil
+}
+
+// EffectivePermissions merges the role's permissions with the ones granted to the user directly,
+// users created before roles existed have no role and are treated as RoleUser
+func EffectivePermissions(role string, granted []string) []string {
+	if role == "" {
+		role = RoleUser
+	}
+
+	seen := make(map[string]bool)
+	permissions := make([]string, 0, len(RolePermissions[role])+len(granted))
+
+	for _, list := range [][]string{RolePermissions[role], granted} {
+		for _, p := range list {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+
+	return permissions
+}
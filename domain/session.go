@@ -0,0 +1,21 @@
+package domain
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Session is created on every login, its id is shared with the refresh token family and carried in the
+// access token's "sid" claim so that terminating it signs that device out
+type Session struct {
+	Id         primitive.ObjectID `bson:"_id" json:"id"`
+	UserId     primitive.ObjectID `bson:"userId" json:"-"`
+	UserAgent  string             `bson:"userAgent" json:"userAgent"`
+	Device     string             `bson:"device" json:"device"`
+	Ip         string             `bson:"ip" json:"ip"`
+	Terminated bool               `bson:"terminated" json:"-"`
+	Current    bool               `bson:"-" json:"current"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastSeenAt time.Time          `bson:"lastSeenAt" json:"lastSeenAt"`
+	ExpiresAt  time.Time          `bson:"expiresAt" json:"-"`
+}
@@ -24,6 +24,10 @@ type Story struct {
 	UpdatedAt      time.Time          `bson:"updatedAt" json:"-"`
 	CreatedDate    string             `bson:"createdDate" json:"createdDate"`
 	UpdatedDate    string             `bson:"updatedDate" json:"updatedDate"`
+	// AuthorDeactivated hides the story while its author is deactivated
+	AuthorDeactivated bool `bson:"authorDeactivated,omitempty" json:"-"`
+	// AuthorStoriesAudience the stories audience of the author, empty when it's everyone
+	AuthorStoriesAudience string `bson:"authorStoriesAudience,omitempty" json:"-"`
 }
 
 type StoryList struct {
@@ -35,19 +39,19 @@ type StoryList struct {
 
 type StoryPreviewDto struct {
 	Id                  primitive.ObjectID `bson:"_id" json:"id"`
-	Title               string             `json:"title"`
-	AuthorUsername      string             `json:"authorUsername"`
-	Preview             string             `json:"preview"`
-	LikeCount           int                `json:"likes"`
-	DislikeCount        int                `json:"dislikes"`
-	Tag                 Tag                `json:"tag"`
-	CommentCount        int                `json:"commentCount"`
-	CurrentUserLiked    bool               `json:"currentUserLiked"`
-	CurrentUserDisLiked bool               `json:"currentUserDisLiked"`
-	Views               int                `json:"views"`
-	Updated             bool               `json:"updated"`
-	CreatedAt           time.Time          `json:"createdAt"`
-	UpdatedAt           time.Time          `json:"updatedAt"`
+	Title               string             `bson:"title" json:"title"`
+	AuthorUsername      string             `bson:"authorUsername" json:"authorUsername"`
+	Preview             string             `bson:"preview" json:"preview"`
+	LikeCount           int                `bson:"likeCount" json:"likes"`
+	DislikeCount        int                `bson:"dislikeCount" json:"dislikes"`
+	Tag                 Tag                `bson:"tag" json:"tag"`
+	CommentCount        int                `bson:"commentCount" json:"commentCount"`
+	CurrentUserLiked    bool               `bson:"-" json:"currentUserLiked"`
+	CurrentUserDisLiked bool               `bson:"-" json:"currentUserDisLiked"`
+	Views               int                `bson:"views" json:"views"`
+	Updated             bool               `bson:"updated" json:"updated"`
+	CreatedAt           time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt           time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
 type StoryDto struct {
@@ -70,6 +74,8 @@ type StoryDto struct {
 	UpdatedAt           time.Time          `json:"updatedAt"`
 	CreatedDate         string             `json:"createdDate"`
 	UpdatedDate         string             `json:"updatedDate"`
+	// AuthorStoriesAudience the stories audience of the author, empty when it's everyone
+	AuthorStoriesAudience string `bson:"authorStoriesAudience,omitempty" json:"-"`
 }
 
 type FeaturedStoryDto struct {
@@ -102,6 +108,8 @@ type CreateStoryDto struct {
 	UpdatedAt      time.Time          `bson:"updatedAt" json:"-"`
 	CreatedDate    string             `bson:"createdDate" json:"-"`
 	UpdatedDate    string             `bson:"updatedDate" json:"-"`
+	// AuthorStoriesAudience is copied from the author, see Story
+	AuthorStoriesAudience string `bson:"authorStoriesAudience,omitempty" json:"-"`
 }
 
 type UpdateStoryDto struct {
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
@@ -11,28 +12,60 @@ type User struct {
 	Username                    string               `bson:"username" json:"username"`
 	Email                       string               `bson:"email" json:"email"`
 	Password                    string               `bson:"password" json:"-"`
+	Role                        string               `bson:"role" json:"role"`
+	Permissions                 []string             `bson:"permissions" json:"permissions"`
 	CurrentTagLine              string               `bson:"currentTagLine" json:"CurrentTagLine"`
 	UnlockedTagLine             []string             `bson:"unlockedTagLine" json:"unlockedTagLine"`
 	ProfilePictureUrl           string               `bson:"profilePictureUrl" json:"profilePictureUrl"`
 	ProfileBackgroundPictureUrl string               `bson:"profileBackgroundPictureUrl" json:"profileBackgroundPictureUrl"`
+	ProfilePicture              Image                `bson:"profilePicture" json:"profilePicture"`
+	ProfileBackgroundPicture    Image                `bson:"profileBackgroundPicture" json:"profileBackgroundPicture"`
 	CurrentBadgeUrl             string               `bson:"currentBadgeUrl" json:"currentBadgeUrl"`
 	UnlockedBadgesUrls          []string             `bson:"unlockedBadgesUrls" json:"unlockedBadgesUrls"`
+	Achievements                []string             `bson:"achievements" json:"achievements"`
+	// AchievementsBackfilled the achievements the user qualified for before they were introduced were unlocked
+	AchievementsBackfilled      bool                 `bson:"achievementsBackfilled,omitempty" json:"-"`
 	BlockList                   []string `bson:"blockList" json:"blockList"`
 	BlockByList                 []string `bson:"blockByList" json:"blockByList"`
 	FlagCount                   []primitive.ObjectID `bson:"flagCount" json:"-"`
-	Followers                   []string             `bson:"followers" json:"followers"`
-	Following                   []string             `bson:"following" json:"following"`
 	FollowerCount               int                  `bson:"followerCount" json:"followerCount"`
-	DisplayFollowerCount        bool                 `bson:"displayFollowerCount" json:"displayFollowerCount"`
-	ProfileIsViewable           bool                 `bson:"profileIsViewable" json:"profileIsViewable"`
+	FollowingCount              int                  `bson:"followingCount" json:"followingCount"`
+	Reputation                  int                  `bson:"reputation" json:"reputation"`
+	ReputationUpdatedAt         time.Time            `bson:"reputationUpdatedAt" json:"-"`
+	Privacy                     PrivacySettings      `bson:"privacy" json:"privacy"`
 	IsLocked                    bool                 `bson:"isLocked" json:"-"`
 	IsVerified                  bool                 `bson:"isVerified" json:"isVerified"`
-	AcceptMessages              bool                 `bson:"acceptMessages" json:"acceptMessages"`
 	TokenHash                   string               `bson:"tokenHash" json:"-"`
 	VerificationCode            string               `bson:"verificationCode" json:"-"`
 	TokenExpiresAt              int64                `bson:"tokenExpiresAt" json:"-"`
+	MfaEnabled                  bool                 `bson:"mfaEnabled" json:"mfaEnabled"`
+	MagicLinkEnabled            bool                 `bson:"magicLinkEnabled" json:"magicLinkEnabled"`
+	ExternalIdentities          []ExternalIdentity   `bson:"externalIdentities" json:"-"`
+	PinnedStories               []primitive.ObjectID `bson:"pinnedStories" json:"pinnedStories"`
+	MfaSecret                   string               `bson:"mfaSecret" json:"-"`
+	MfaPendingSecret            string               `bson:"mfaPendingSecret" json:"-"`
+	MfaRecoveryCodes            []string             `bson:"mfaRecoveryCodes" json:"-"`
+	MfaPendingRecoveryCodes     []string             `bson:"mfaPendingRecoveryCodes" json:"-"`
+	MfaLastUsedStep             int64                `bson:"mfaLastUsedStep" json:"-"`
+	MfaFailedAttempts           int                  `bson:"mfaFailedAttempts" json:"-"`
+	MfaLockedUntil              int64                `bson:"mfaLockedUntil" json:"-"`
+	LockedUntil                 int64                `bson:"lockedUntil" json:"-"`
+	UnlockToken                 string               `bson:"unlockToken" json:"-"`
+	UnlockTokenExpiresAt        int64                `bson:"unlockTokenExpiresAt" json:"-"`
+	PendingEmail                string               `bson:"pendingEmail" json:"-"`
+	EmailChangeToken            string               `bson:"emailChangeToken" json:"-"`
+	EmailChangeCancelToken      string               `bson:"emailChangeCancelToken" json:"-"`
+	EmailChangeExpiresAt        int64                `bson:"emailChangeExpiresAt" json:"-"`
+	EmailWasVerified            bool                 `bson:"emailWasVerified" json:"-"`
 	LastLoginIp					string				 `bson:"lastLoginIp" json:"-"`
-	LastLoginIps				[]string			 `bson:"lastLoginIps" json:"-"`
+	LastActiveAt                time.Time            `bson:"lastActiveAt" json:"-"`
+	PendingDeletion             bool                 `bson:"pendingDeletion" json:"pendingDeletion"`
+	Deactivated                 bool                 `bson:"deactivated" json:"deactivated"`
+	DeactivatedAt               time.Time            `bson:"deactivatedAt" json:"-"`
+	ReactivationToken           string               `bson:"reactivationToken" json:"-"`
+	ReactivationTokenExpiresAt  int64                `bson:"reactivationTokenExpiresAt" json:"-"`
+	DeletionScheduledAt         time.Time            `bson:"deletionScheduledAt" json:"deletionScheduledAt"`
+	DeletionRestoreToken        string               `bson:"deletionRestoreToken" json:"-"`
 	CreatedAt                   time.Time            `bson:"createdAt" json:"-"`
 	UpdatedAt                   time.Time            `bson:"updatedAt" json:"-"`
 }
@@ -43,29 +76,15 @@ type CreateUserDto struct {
 	Password string `json:"password,omitempty"`
 }
 
-type UpdateProfileVisibility struct {
-	ProfileIsViewable bool      `json:"profileIsViewable,omitempty"`
-	UpdatedAt         time.Time `bson:"updatedAt" json:"-"`
-}
-
-type UpdateMessageAcceptance struct {
-	AcceptMessages bool      `json:"acceptMessages,omitempty"`
-	UpdatedAt      time.Time `bson:"updatedAt" json:"-"`
-}
-
 type UpdateCurrentBadge struct {
 	CurrentBadgeUrl string    `json:"currentBadgeUrl,omitempty"`
 	UpdatedAt       time.Time `bson:"updatedAt" json:"-"`
 }
 
-type UpdateProfilePicture struct {
-	ProfilePictureUrl string    `json:"profilePictureUrl,omitempty"`
-	UpdatedAt         time.Time `bson:"updatedAt" json:"-"`
-}
-
-type UpdateProfileBackgroundPicture struct {
-	ProfileBackgroundPictureUrl string    `json:"profileBackgroundPictureUrl,omitempty"`
-	UpdatedAt                   time.Time `bson:"updatedAt" json:"-"`
+// Image an uploaded picture, Urls has one entry per width and Keys is where every size lives in the blob store
+type Image struct {
+	Urls map[string]string `bson:"urls" json:"urls"`
+	Keys []string          `bson:"keys" json:"-"`
 }
 
 type UpdateCurrentTagline struct {
@@ -78,27 +97,27 @@ type UpdateVerification struct {
 	UpdatedAt  time.Time `bson:"updatedAt" json:"-"`
 }
 
-type UpdateDisplayFollowerCount struct {
-	DisplayFollowerCount bool      `json:"displayFollowerCount"`
-	UpdatedAt            time.Time `bson:"updatedAt" json:"-"`
+// UpdateEmail the password is required to start an email change
+type UpdateEmail struct {
+	Email     string    `json:"email,omitempty"`
+	Password  string    `json:"password,omitempty"`
+	UpdatedAt time.Time `bson:"updatedAt" json:"-"`
 }
 
 type UserDto struct {
 	Id                          primitive.ObjectID   `bson:"_id" json:"-"`
 	Email                       string               `json:"email"`
 	Username                    string               `json:"username"`
+	Role                        string               `json:"role"`
 	CurrentTagLine              string               `json:"currentTagLine"`
 	UnlockedTagLine             []string             `json:"unlockedTagLine"`
 	ProfilePictureUrl           string               `json:"profilePictureUrl"`
 	ProfileBackgroundPictureUrl string               `json:"profileBackgroundPictureUrl"`
 	CurrentBadgeUrl             string               `json:"currentBadgeUrl"`
 	UnlockedBadgesUrls          []string             `json:"unlockedBadgesUrls"`
-	ProfileIsViewable           bool                 `json:"profileIsViewable"`
-	AcceptMessages              bool                 `json:"acceptMessages"`
+	Privacy                     PrivacySettings      `bson:"privacy" json:"privacy"`
 	FollowerCount               int                  `json:"followerCount"`
-	DisplayFollowerCount        bool                 `json:"displayFollowerCount"`
-	Followers                   []string             `bson:"followers" json:"-"`
-	Following                   []string             `bson:"following" json:"-"`
+	Reputation                  int                  `json:"reputation"`
 	IsVerified                  bool                 `bson:"isVerified" json:"-"`
 	BlockList                   []string `bson:"blockList" json:"-"`
 	BlockByList                 []string `bson:"blockByList" json:"-"`
@@ -108,27 +127,104 @@ type UserDto struct {
 }
 
 type ViewUserProfile struct {
-	Username                    string     `json:"username"`
-	CurrentTagLine              string     `json:"currentTagLine"`
-	ProfilePictureUrl           string     `json:"profilePictureUrl"`
-	ProfileBackgroundPictureUrl string     `json:"profileBackgroundPictureUrl"`
-	CurrentBadgeUrl             string     `json:"currentBadgeUrl"`
-	FollowerCount               int        `json:"followerCount"`
-	ProfileIsViewable           bool       `json:"-"`
-	DisplayFollowerCount        bool       `json:"displayFollowerCount"`
-	IsFollowing                 bool       `json:"isFollowing"`
-	Posts                       []StoryDto `json:"posts"`
-	Followers                   []string   `json:"-"`
+	Username                    string               `bson:"username" json:"username"`
+	CurrentTagLine              string               `bson:"currentTagLine" json:"currentTagLine"`
+	ProfilePictureUrl           string               `bson:"profilePictureUrl" json:"profilePictureUrl"`
+	ProfileBackgroundPictureUrl string               `bson:"profileBackgroundPictureUrl" json:"profileBackgroundPictureUrl"`
+	ProfilePicture              Image                `bson:"profilePicture" json:"profilePicture"`
+	ProfileBackgroundPicture    Image                `bson:"profileBackgroundPicture" json:"profileBackgroundPicture"`
+	CurrentBadgeUrl             string               `bson:"currentBadgeUrl" json:"currentBadgeUrl"`
+	FollowerCount               int                  `bson:"followerCount" json:"followerCount"`
+	FollowingCount              int                  `bson:"followingCount" json:"followingCount"`
+	Reputation                  int                  `bson:"reputation" json:"reputation"`
+	Privacy                     PrivacySettings      `bson:"privacy" json:"-"`
+	IsFollowing                 bool                 `bson:"-" json:"isFollowing"`
+	FollowRequested             bool                 `bson:"-" json:"followRequested"`
+	PinnedStories               []StoryPreviewDto    `bson:"-" json:"pinnedStories"`
+	Stories                     *StoryList           `bson:"-" json:"stories"`
+	Stats                       *AuthorStats         `bson:"-" json:"stats"`
+	PinnedStoryIds              []primitive.ObjectID `bson:"pinnedStories" json:"-"`
+	BlockList                   []string             `bson:"blockList" json:"-"`
+	BlockByList                 []string             `bson:"blockByList" json:"-"`
 }
 
 type CurrentUserProfile struct {
-	Username                    string     `json:"username"`
-	CurrentTagLine              string     `json:"currentTagLine"`
-	ProfilePictureUrl           string     `json:"profilePictureUrl"`
-	ProfileBackgroundPictureUrl string     `json:"profileBackgroundPictureUrl"`
-	CurrentBadgeUrl             string     `json:"currentBadgeUrl"`
-	FollowerCount               int        `json:"followerCount"`
-	Posts                       []StoryDto `json:"posts"`
+	Username                    string               `bson:"username" json:"username"`
+	CurrentTagLine              string               `bson:"currentTagLine" json:"currentTagLine"`
+	ProfilePictureUrl           string               `bson:"profilePictureUrl" json:"profilePictureUrl"`
+	ProfileBackgroundPictureUrl string               `bson:"profileBackgroundPictureUrl" json:"profileBackgroundPictureUrl"`
+	ProfilePicture              Image                `bson:"profilePicture" json:"profilePicture"`
+	ProfileBackgroundPicture    Image                `bson:"profileBackgroundPicture" json:"profileBackgroundPicture"`
+	CurrentBadgeUrl             string               `bson:"currentBadgeUrl" json:"currentBadgeUrl"`
+	FollowerCount               int                  `bson:"followerCount" json:"followerCount"`
+	FollowingCount              int                  `bson:"followingCount" json:"followingCount"`
+	Reputation                  int                  `bson:"reputation" json:"reputation"`
+	Privacy                     PrivacySettings      `bson:"privacy" json:"privacy"`
+	PinnedStories               []StoryPreviewDto    `bson:"-" json:"pinnedStories"`
+	Stories                     *StoryList           `bson:"-" json:"stories"`
+	Stats                       *AuthorStats         `bson:"-" json:"stats"`
+	PinnedStoryIds              []primitive.ObjectID `bson:"pinnedStories" json:"-"`
+}
+
+// AuthorStats are summed over all of an author's stories
+type AuthorStats struct {
+	StoryCount    int `bson:"storyCount" json:"storyCount"`
+	TotalViews    int `bson:"totalViews" json:"totalViews"`
+	TotalLikes    int `bson:"totalLikes" json:"totalLikes"`
+	TotalDislikes int `bson:"totalDislikes" json:"totalDislikes"`
+}
+
+// MaxPinnedStories is how many stories can be pinned to a profile
+const MaxPinnedStories = 3
+
+const (
+	// DeletionGracePeriod is how long a deleted account can still be restored before it is purged
+	DeletionGracePeriod = 30 * 24 * time.Hour
+	// DeletedUsername replaces the username on content of purged accounts that is kept for others
+	DeletedUsername = "[deleted]"
+	// ReactivationTokenExpiration is how long a deactivated user has to confirm the reactivation after logging in
+	ReactivationTokenExpiration = 15 * time.Minute
+)
+
+var (
+	// ErrUserNotFound is also returned for profiles hidden by a block, so a block can't be detected
+	ErrUserNotFound = errors.New("user not found")
+	// ErrProfileNotViewable is returned for profiles the viewer isn't in the audience of
+	ErrProfileNotViewable = errors.New("cannot view user")
+	// ErrAccountPendingDeletion is returned by the logins while the account waits to be purged
+	ErrAccountPendingDeletion = errors.New("account is scheduled for deletion, use the link in the email we sent to restore it")
+	// ErrAccountDeactivated is returned when a deactivated account is deactivated again
+	ErrAccountDeactivated = errors.New("account is already deactivated")
+)
+
+// Deactivate the password is required to deactivate an account
+type Deactivate struct {
+	Password string `json:"password"`
+}
+
+// Reactivate carries the token a login to a deactivated account returns
+type Reactivate struct {
+	ReactivationToken string `json:"reactivationToken"`
+}
+
+// UserSearchResult is a user as shown in search results and suggestions, FollowerCount is -1 when hidden
+type UserSearchResult struct {
+	Username          string          `bson:"username" json:"username"`
+	CurrentTagLine    string          `bson:"currentTagLine" json:"currentTagLine"`
+	ProfilePictureUrl string          `bson:"profilePictureUrl" json:"profilePictureUrl"`
+	CurrentBadgeUrl   string          `bson:"currentBadgeUrl" json:"currentBadgeUrl"`
+	FollowerCount     int             `bson:"followerCount" json:"followerCount"`
+	IsPrivate         bool            `bson:"-" json:"isPrivate"`
+	Tags              []string        `bson:"-" json:"tags,omitempty"`
+	Privacy           PrivacySettings `bson:"privacy" json:"-"`
+	LastActiveAt      time.Time       `bson:"lastActiveAt" json:"-"`
+}
+
+type UserSearchList struct {
+	Users         []UserSearchResult `json:"users"`
+	NumberOfUsers int                `json:"numberOfUsers"`
+	CurrentPage   int                `json:"currentPage"`
+	NumberOfPages int                `json:"numberOfPages"`
 }
 
 type UserResponse struct {
@@ -5,17 +5,15 @@ func UserMapper(user *User) *UserDto {
 	userDto.Id = user.Id
 	userDto.Email = user.Email
 	userDto.Username = user.Username
+	userDto.Role = user.Role
 	userDto.ProfilePictureUrl = user.ProfilePictureUrl
 	userDto.CurrentTagLine = user.CurrentTagLine
 	userDto.UnlockedTagLine = user.UnlockedTagLine
 	userDto.CurrentBadgeUrl = user.CurrentBadgeUrl
-	userDto.ProfileIsViewable = user.ProfileIsViewable
+	userDto.Privacy = user.Privacy
 	userDto.UnlockedBadgesUrls = user.UnlockedBadgesUrls
-	userDto.AcceptMessages = user.AcceptMessages
-	userDto.DisplayFollowerCount = user.DisplayFollowerCount
 	userDto.FollowerCount = user.FollowerCount
-	userDto.Following = user.Following
-	userDto.Followers = user.Followers
+	userDto.Reputation = user.Reputation
 
 	return userDto
 }
@@ -25,19 +23,17 @@ func UserDtoMapper(dto UserDto) *User {
 	user.Id = dto.Id
 	user.Email = dto.Email
 	user.Username = dto.Username
+	user.Role = dto.Role
 	user.ProfilePictureUrl = dto.ProfilePictureUrl
 	user.CurrentTagLine = dto.CurrentTagLine
 	user.UnlockedTagLine = dto.UnlockedTagLine
 	user.CurrentBadgeUrl = dto.CurrentBadgeUrl
-	user.ProfileIsViewable = dto.ProfileIsViewable
+	user.Privacy = dto.Privacy
 	user.UnlockedBadgesUrls = dto.UnlockedBadgesUrls
 	user.UnlockedBadgesUrls = dto.UnlockedBadgesUrls
-	user.AcceptMessages = dto.AcceptMessages
 	user.IsVerified = dto.IsVerified
-	user.DisplayFollowerCount = dto.DisplayFollowerCount
-	user.Followers = dto.Followers
 	user.FollowerCount = dto.FollowerCount
-	user.Following = dto.Following
+	user.Reputation = dto.Reputation
 
 	return user
 }
\ No newline at end of file
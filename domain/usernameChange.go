@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	// UsernameChangeInterval is how long a user has to wait between two username changes
+	UsernameChangeInterval = 30 * 24 * time.Hour
+	// UsernameReservation is how long an old username can only be taken back by the user who gave it up
+	UsernameReservation = 90 * 24 * time.Hour
+)
+
+// UsernameChange is one rename in a user's history. CurrentUsername follows later renames so an old username
+// resolves to the latest one, Migrated is set once every reference to OldUsername was rewritten.
+type UsernameChange struct {
+	Id              primitive.ObjectID `bson:"_id" json:"-"`
+	UserId          primitive.ObjectID `bson:"userId" json:"-"`
+	OldUsername     string             `bson:"oldUsername" json:"oldUsername"`
+	NewUsername     string             `bson:"newUsername" json:"newUsername"`
+	CurrentUsername string             `bson:"currentUsername" json:"-"`
+	Migrated        bool               `bson:"migrated" json:"migrated"`
+	ReservedUntil   time.Time          `bson:"reservedUntil" json:"reservedUntil"`
+	CreatedAt       time.Time          `bson:"createdAt" json:"createdAt"`
+	MigratedAt      time.Time          `bson:"migratedAt" json:"-"`
+}
+
+// UpdateUsername the password is required to change the username
+type UpdateUsername struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// ErrUsernameTaken is also returned for usernames that are still reserved for the user who gave them up
+var ErrUsernameTaken = errors.New("username is taken")
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/services"
+)
+
+type AchievementHandler struct {
+	AchievementService services.AchievementService
+}
+
+func (ah *AchievementHandler) FindAll(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	achievements, err := ah.AchievementService.FindAll(currentUserId)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": achievements})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/services"
+)
+
+type ApiKeyHandler struct {
+	ApiKeyService services.ApiKeyService
+}
+
+func (akh *ApiKeyHandler) Create(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+	currentUsername := c.Locals("username").(string)
+
+	apiKey := new(domain.CreateApiKey)
+	err := c.BodyParser(apiKey)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = apiKey.Validate()
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	created, err := akh.ApiKeyService.Create(currentUserId, currentUsername, apiKey)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"status": "success", "message": "store the key now, it won't be shown again", "data": created})
+}
+
+func (akh *ApiKeyHandler) FindAll(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	apiKeys, err := akh.ApiKeyService.FindAllByUserId(currentUserId)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": apiKeys})
+}
+
+func (akh *ApiKeyHandler) Revoke(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = akh.ApiKeyService.Revoke(id, currentUserId)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
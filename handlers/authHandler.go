@@ -3,12 +3,21 @@ package handlers
 import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"golang.org/x/crypto/bcrypt"
+	"story-app-monolith/config"
 	"story-app-monolith/domain"
 	"story-app-monolith/services"
+	"story-app-monolith/util"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// magicLinkCookie carries the nonce a magic link is bound to
+const magicLinkCookie = "magic_nonce"
+
 type AuthHandler struct {
 	AuthService services.AuthService
 }
@@ -30,28 +39,208 @@ func (ah *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid password")})
 	}
 
-	var auth domain.Authentication
-
-	_, token, err := ah.AuthService.Login(strings.ToLower(details.Email), details.Password)
+	result, err := ah.AuthService.Login(strings.ToLower(details.Email), details.Password, c.IP(), c.Get(fiber.HeaderUserAgent))
 
 	if err != nil {
+		if err == domain.ErrAccountLocked {
+			return c.Status(423).JSON(fiber.Map{"status": "error", "message": "account locked", "data": fmt.Sprintf("%v", err)})
+		}
+		if err == domain.ErrAccountPendingDeletion {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "account pending deletion", "data": fmt.Sprintf("%v", err)})
+		}
+		if err == domain.ErrTooManyAttempts {
+			return c.Status(429).JSON(fiber.Map{"status": "error", "message": "too many attempts", "data": fmt.Sprintf("%v", err)})
+		}
 		if err == bcrypt.ErrMismatchedHashAndPassword {
 			return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 		}
 		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Authentication failure")})
 	}
 
-	signedToken := make([]byte, 0, 100)
-	signedToken = append(signedToken, []byte("Bearer " + token + "|")...)
-	t, err := auth.SignToken([]byte(token))
+	return loginResponse(c, result)
+}
+
+// RequestMagicLink always answers the same way so it can't be used to find out which emails have an account
+func (ah *AuthHandler) RequestMagicLink(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	r := new(domain.MagicLinkRequest)
+	err := c.BodyParser(r)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	if !util.IsEmail(r.Email) {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid email")})
+	}
+
+	expiration, err := strconv.Atoi(config.Config("MAGIC_LINK_EXPIRATION"))
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	signedToken = append(signedToken, t...)
+	// the link is only accepted together with this cookie, so it can't be used from another device
+	nonce := utils.UUIDv4()
+
+	err = ah.AuthService.RequestMagicLink(r.Email, nonce, c.IP())
 
-	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": string(signedToken)})
+	if err != nil {
+		if err == domain.ErrTooManyAttempts {
+			return c.Status(429).JSON(fiber.Map{"status": "error", "message": "too many attempts", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     magicLinkCookie,
+		Value:    nonce,
+		Path:     "/auth/magic",
+		Expires:  time.Now().Add(time.Duration(expiration) * time.Minute),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+
+	return c.Status(202).JSON(fiber.Map{"status": "success", "message": "success", "data": "if the email belongs to an account with magic links turned on, a link is on its way"})
+}
+
+func (ah *AuthHandler) MagicLinkLogin(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	result, err := ah.AuthService.MagicLinkLogin(token, c.Cookies(magicLinkCookie), c.IP(), c.Get(fiber.HeaderUserAgent))
+
+	if err != nil {
+		if err == domain.ErrAccountLocked {
+			return c.Status(423).JSON(fiber.Map{"status": "error", "message": "account locked", "data": fmt.Sprintf("%v", err)})
+		}
+		if err == domain.ErrAccountPendingDeletion {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "account pending deletion", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	// the cookie was set on the magic link path, it has to be expired on the same one
+	c.Cookie(&fiber.Cookie{Name: magicLinkCookie, Path: "/auth/magic", Expires: time.Unix(0, 0), Secure: true, HTTPOnly: true, SameSite: "Lax"})
+
+	return loginResponse(c, result)
+}
+
+// Reactivate is how a deactivated user accepts the offer their login got, it finishes the login
+func (ah *AuthHandler) Reactivate(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	r := new(domain.Reactivate)
+	err := c.BodyParser(r)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	result, err := ah.AuthService.Reactivate(r.ReactivationToken, c.IP(), c.Get(fiber.HeaderUserAgent))
+
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return loginResponse(c, result)
+}
+
+func (ah *AuthHandler) RefreshToken(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	r := new(domain.RefreshTokenRequest)
+	err := c.BodyParser(r)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	if r.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid refresh token")})
+	}
+
+	result, err := ah.AuthService.RefreshToken(r.RefreshToken, c.IP())
+
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	signedToken, err := signBearerToken(result.AccessToken)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": signedToken, "refreshToken": result.RefreshToken})
+}
+
+func (ah *AuthHandler) Logout(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	l := new(domain.LogoutRequest)
+
+	// the refresh token is optional, an empty body only revokes the access token
+	if len(c.Body()) > 0 {
+		err := c.BodyParser(l)
+
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+	}
+
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+	jti := c.Locals("jti").(string)
+	sessionId := c.Locals("sid").(string)
+	expiresAt := c.Locals("expiresAt").(int64)
+
+	err := ah.AuthService.Logout(jti, sessionId, currentUserId, expiresAt, l.RefreshToken)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (ah *AuthHandler) LogoutAll(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	err := ah.AuthService.LogoutAll(currentUserId)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (ah *AuthHandler) GetSessions(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+	sessionId := c.Locals("sid").(string)
+
+	sessions, err := ah.AuthService.GetSessions(currentUserId, sessionId)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": sessions})
+}
+
+func (ah *AuthHandler) TerminateSession(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = ah.AuthService.TerminateSession(id, currentUserId)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
 func (ah *AuthHandler) ResetPasswordQuery(c *fiber.Ctx) error {
@@ -72,6 +261,18 @@ func (ah *AuthHandler) ResetPasswordQuery(c *fiber.Ctx) error {
 	return nil
 }
 
+func (ah *AuthHandler) Unlock(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	err := ah.AuthService.Unlock(token)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
 func (ah *AuthHandler) ResetPassword(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	p := new(domain.ResetPassword)
@@ -104,4 +305,40 @@ func (ah *AuthHandler) VerifyCode(c *fiber.Ctx) error {
 	}
 
 	return nil
+}
+
+// loginResponse is the body every way of logging in answers with
+func loginResponse(c *fiber.Ctx, result *domain.LoginResult) error {
+	if result.ReactivationToken != "" {
+		return c.Status(200).JSON(fiber.Map{"status": "success", "message": "account deactivated", "data": result.ReactivationToken, "reactivationRequired": true})
+	}
+
+	if result.MfaToken != "" {
+		return c.Status(200).JSON(fiber.Map{"status": "success", "message": "mfa required", "data": result.MfaToken, "mfaRequired": true})
+	}
+
+	signedToken, err := signBearerToken(result.AccessToken)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": signedToken, "refreshToken": result.RefreshToken})
+}
+
+// signBearerToken builds the "Bearer <jwt>|<hmac>" value the client sends back in the Authorization header
+func signBearerToken(token string) (string, error) {
+	var auth domain.Authentication
+
+	signedToken := make([]byte, 0, 100)
+	signedToken = append(signedToken, []byte("Bearer " + token + "|")...)
+	t, err := auth.SignToken([]byte(token))
+
+	if err != nil {
+		return "", err
+	}
+
+	signedToken = append(signedToken, t...)
+
+	return string(signedToken), nil
 }
\ No newline at end of file
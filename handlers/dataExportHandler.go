@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/services"
+)
+
+type DataExportHandler struct {
+	DataExportService services.DataExportService
+}
+
+func (dh *DataExportHandler) Request(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	export, err := dh.DataExportService.Request(currentUserId)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(202).JSON(fiber.Map{"status": "success", "message": "success", "data": export})
+}
+
+func (dh *DataExportHandler) FindById(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	export, err := dh.DataExportService.FindById(id, currentUserId)
+
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": export})
+}
+
+// Download is reached through the signed link, it doesn't need a login
+func (dh *DataExportHandler) Download(c *fiber.Ctx) error {
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	file, username, err := dh.DataExportService.Download(id, c.Query("expires"), c.Query("sig"))
+
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	return c.Download(file, fmt.Sprintf("%v-data.zip", username))
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/services"
+)
+
+type FlagHandler struct {
+	FlagService services.FlagService
+}
+
+func (fh *FlagHandler) FindAll(c *fiber.Ctx) error {
+	page := c.Query("page", "1")
+	status := c.Query("status", domain.FlagStatusPending)
+
+	flags, err := fh.FlagService.FindAll(status, page)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": flags})
+}
+
+func (fh *FlagHandler) Review(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	id, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	review := new(domain.ReviewFlag)
+
+	err = c.BodyParser(review)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = fh.FlagService.Review(id, currentUserId, review)
+
+	if err != nil {
+		if err == domain.ErrFlagNotFound {
+			return c.Status(404).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+		if err == domain.ErrInvalidFlagStatus {
+			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/services"
+)
+
+type FollowHandler struct {
+	FollowService services.FollowService
+}
+
+func (fh *FollowHandler) Follow(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	status, err := fh.FollowService.Follow(currentUserId, c.Params("username"))
+
+	if err != nil {
+		if err == domain.ErrUserNotFound {
+			return c.Status(404).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	if status == domain.FollowStatusPending {
+		return c.Status(202).JSON(fiber.Map{"status": "success", "message": "follow request sent", "data": status})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": status})
+}
+
+func (fh *FollowHandler) Unfollow(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	err := fh.FollowService.Unfollow(currentUserId, c.Params("username"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (fh *FollowHandler) FindFollowers(c *fiber.Ctx) error {
+	currentUsername := c.Locals("username").(string)
+	page := c.Query("page", "1")
+
+	followers, err := fh.FollowService.FindFollowers(c.Params("username"), currentUsername, page)
+
+	if err != nil {
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": followers})
+}
+
+func (fh *FollowHandler) FindFollowing(c *fiber.Ctx) error {
+	currentUsername := c.Locals("username").(string)
+	page := c.Query("page", "1")
+
+	following, err := fh.FollowService.FindFollowing(c.Params("username"), currentUsername, page)
+
+	if err != nil {
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": following})
+}
+
+func (fh *FollowHandler) FindRequests(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+	page := c.Query("page", "1")
+
+	requests, err := fh.FollowService.FindRequests(currentUserId, page)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": requests})
+}
+
+func (fh *FollowHandler) AcceptRequest(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	err := fh.FollowService.AcceptRequest(currentUserId, c.Params("username"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (fh *FollowHandler) DeclineRequest(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	err := fh.FollowService.DeclineRequest(currentUserId, c.Params("username"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
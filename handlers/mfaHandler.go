@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/services"
+)
+
+type MfaHandler struct {
+	MfaService services.MfaService
+}
+
+func (mh *MfaHandler) Enroll(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	enrollment, err := mh.MfaService.Enroll(currentUserId)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": enrollment})
+}
+
+func (mh *MfaHandler) Confirm(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	code := new(domain.MfaCode)
+	err := c.BodyParser(code)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = mh.MfaService.Confirm(currentUserId, code.Code)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (mh *MfaHandler) Disable(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	code := new(domain.MfaCode)
+	err := c.BodyParser(code)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = mh.MfaService.Disable(currentUserId, code.Code)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (mh *MfaHandler) Verify(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	v := new(domain.MfaVerification)
+	err := c.BodyParser(v)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	result, err := mh.MfaService.Verify(v.MfaToken, v.Code, c.IP(), c.Get(fiber.HeaderUserAgent))
+
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	signedToken, err := signBearerToken(result.AccessToken)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": signedToken, "refreshToken": result.RefreshToken})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"story-app-monolith/domain"
+	"story-app-monolith/oidc"
+	"story-app-monolith/services"
+	"story-app-monolith/util"
+	"strings"
+	"time"
+)
+
+// oidcStateCookie binds the callback to the browser that started the sign in
+const oidcStateCookie = "oidc_state"
+
+type OidcHandler struct {
+	OidcService services.OidcService
+}
+
+func (oh *OidcHandler) Providers(c *fiber.Ctx) error {
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": oidc.Names()})
+}
+
+func (oh *OidcHandler) Begin(c *fiber.Ctx) error {
+	authUrl, state, err := oh.OidcService.Begin(c.Params("provider"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth/oidc",
+		Expires:  time.Now().Add(10 * time.Minute),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+
+	return c.Redirect(authUrl, fiber.StatusFound)
+}
+
+func (oh *OidcHandler) Callback(c *fiber.Ctx) error {
+	if e := c.Query("error"); e != "" {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("sign in was cancelled: %v", e)})
+	}
+
+	state := c.Query("state")
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(c.Cookies(oidcStateCookie))) != 1 {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("sign in has to finish in the browser it was started in")})
+	}
+
+	c.Cookie(&fiber.Cookie{Name: oidcStateCookie, Path: "/auth/oidc", Expires: time.Unix(0, 0), Secure: true, HTTPOnly: true, SameSite: "Lax"})
+
+	result, err := oh.OidcService.Callback(c.Params("provider"), state, c.Query("code"), c.IP(), c.Get(fiber.HeaderUserAgent))
+
+	if err != nil {
+		if err == domain.ErrAccountLocked {
+			return c.Status(423).JSON(fiber.Map{"status": "error", "message": "account locked", "data": fmt.Sprintf("%v", err)})
+		}
+		if err == domain.ErrAccountPendingDeletion {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "account pending deletion", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	if result.Login == nil {
+		return c.Status(200).JSON(fiber.Map{"status": "success", "message": "signup required", "signupRequired": true,
+			"data": fiber.Map{"signupToken": result.SignupToken, "email": result.Email, "suggestedUsername": result.SuggestedUsername}})
+	}
+
+	return loginResponse(c, result.Login)
+}
+
+func (oh *OidcHandler) Signup(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	s := new(domain.OidcSignup)
+	err := c.BodyParser(s)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	if !util.IsUsername(strings.ToLower(s.Username)) {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid username")})
+	}
+
+	result, err := oh.OidcService.Signup(s.SignupToken, s.Username, c.IP(), c.Get(fiber.HeaderUserAgent))
+
+	if err != nil {
+		return c.Status(409).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return loginResponse(c, result)
+}
@@ -52,6 +52,7 @@ func (s *StoryHandler) CreateStory(c *fiber.Ctx) error {
 }
 
 func (s *StoryHandler) FindAll(c *fiber.Ctx) error {
+	currentUsername := c.Locals("username").(string)
 	page := c.Query("page", "1")
 	newStoriesQuery := c.Query("new", "false")
 
@@ -61,7 +62,7 @@ func (s *StoryHandler) FindAll(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("must provide a valid value")})
 	}
 
-	stories, err := s.StoryService.FindAll(page, isNew)
+	stories, err := s.StoryService.FindAll(page, isNew, currentUsername)
 
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
@@ -5,7 +5,12 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"io/ioutil"
 	"story-app-monolith/domain"
+	"story-app-monolith/images"
+	"story-app-monolith/passwords"
 	"story-app-monolith/services"
 	"story-app-monolith/util"
 	"strings"
@@ -17,11 +22,12 @@ type UserHandler struct {
 
 func (uh *UserHandler) GetAllUsers(c *fiber.Ctx) error {
 	page := c.Query("page", "1")
+	sort := c.Query("sort")
 
 	currentUsername := c.Locals("username").(string)
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	users, err := uh.UserService.GetAllUsers(currentUserId, page, c.Context(), currentUsername)
+	users, err := uh.UserService.GetAllUsers(currentUserId, page, sort, c.Context(), currentUsername)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
@@ -43,13 +49,39 @@ func (uh *UserHandler) GetAllBlockedUsers(c *fiber.Ctx) error {
 	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": users})
 }
 
+func (uh *UserHandler) Search(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+	page := c.Query("page", "1")
+
+	users, err := uh.UserService.Search(currentUserId, c.Query("q"), page)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": users})
+}
+
+func (uh *UserHandler) SuggestAuthors(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	users, err := uh.UserService.SuggestAuthors(currentUserId)
+
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": users})
+}
+
 func (uh *UserHandler) GetCurrentUserProfile(c *fiber.Ctx) error {
 	currentUsername := c.Locals("username").(string)
+	page := c.Query("page", "1")
 
-	user, err := uh.UserService.GetCurrentUserProfile(currentUsername)
+	user, err := uh.UserService.GetCurrentUserProfile(currentUsername, page)
 
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
 	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": user})
@@ -58,16 +90,85 @@ func (uh *UserHandler) GetCurrentUserProfile(c *fiber.Ctx) error {
 func (uh *UserHandler) GetUserProfile(c *fiber.Ctx) error {
 	username := c.Params("username")
 	currentUsername := c.Locals("username").(string)
+	page := c.Query("page", "1")
+
+	user, err := uh.UserService.GetUserProfile(username, currentUsername, page)
 
-	user, err := uh.UserService.GetUserProfile(username, currentUsername)
+	// old profile urls follow the user to their current username
+	if err == domain.ErrUserNotFound {
+		if current, err := uh.UserService.ResolveUsername(username, currentUsername); err == nil {
+			c.Location("/profile/" + current)
+			return c.Status(301).JSON(fiber.Map{"status": "success", "message": "username changed", "data": fiber.Map{"username": current}})
+		}
+	}
 
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
 	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": user})
 }
 
+func profileErrorStatus(err error) int {
+	switch err {
+	case domain.ErrUserNotFound:
+		return 404
+	case domain.ErrProfileNotViewable, domain.ErrReadActivityNotViewable:
+		return 403
+	}
+	return 400
+}
+
+func (uh *UserHandler) FindReadActivity(c *fiber.Ctx) error {
+	username := c.Params("username")
+	currentUsername := c.Locals("username").(string)
+
+	activity, err := uh.UserService.FindReadActivity(username, currentUsername)
+
+	if err != nil {
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": activity})
+}
+
+func (uh *UserHandler) PinStory(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+	currentUsername := c.Locals("username").(string)
+
+	storyId, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = uh.UserService.PinStory(currentUserId, currentUsername, storyId)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
+func (uh *UserHandler) UnpinStory(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	storyId, err := primitive.ObjectIDFromHex(c.Params("id"))
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = uh.UserService.UnpinStory(currentUserId, storyId)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+}
+
 func (uh *UserHandler) CreateUser(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	createUserDto := new(domain.CreateUserDto)
@@ -82,56 +183,67 @@ func (uh *UserHandler) CreateUser(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid email")})
 	}
 
-	if len(createUserDto.Username) <= 1 {
+	if !util.IsUsername(strings.ToLower(createUserDto.Username)) {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid username")})
 	}
 
 	user := util.CreateUser(createUserDto)
 
-	user.Following = make([]string,0, 0)
-	user.Followers = make([]string,0, 0)
-	user.DisplayFollowerCount = true
-
 	err = uh.UserService.CreateUser(user)
 
 	if err != nil {
+		if passwords.IsPolicyError(err) {
+			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
 		return c.Status(409).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
 	return c.Status(201).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
-func (uh *UserHandler) UpdateProfileVisibility(c *fiber.Ctx) error {
-	c.Accepts("application/json")
+func (uh *UserHandler) GetPrivacySettings(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	settings, err := uh.UserService.GetPrivacySettings(currentUserId)
 
+	if err != nil {
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": settings})
+}
+
+// UpdatePrivacySettings audiences left out of the body stay as they are
+func (uh *UserHandler) UpdatePrivacySettings(c *fiber.Ctx) error {
+	c.Accepts("application/json")
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	userDto := new(domain.UpdateProfileVisibility)
+	update := new(domain.UpdatePrivacySettings)
 
-	err := c.BodyParser(userDto)
+	err := c.BodyParser(update)
 
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	err = uh.UserService.UpdateProfileVisibility(currentUserId, userDto, c.Context())
+	settings, err := uh.UserService.UpdatePrivacySettings(currentUserId, update)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == domain.ErrInvalidAudience {
 			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 		}
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": settings})
 }
 
-func (uh *UserHandler) UpdateDisplayFollowerCount(c *fiber.Ctx) error {
+func (uh *UserHandler) UpdateCurrentBadge(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	userDto := new(domain.UpdateDisplayFollowerCount)
+	userDto := new(domain.UpdateCurrentBadge)
 
 	err := c.BodyParser(userDto)
 
@@ -139,49 +251,105 @@ func (uh *UserHandler) UpdateDisplayFollowerCount(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	err = uh.UserService.UpdateDisplayFollowerCount(currentUserId, userDto)
+	err = uh.UserService.UpdateCurrentBadge(currentUserId, userDto, c.Context())
 
 	if err != nil {
+		if err == domain.ErrBadgeLocked {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
 		if err == mongo.ErrNoDocuments {
 			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 		}
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
-
 	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
-func (uh *UserHandler) UpdateMessageAcceptance(c *fiber.Ctx) error {
-	c.Accepts("application/json")
+func (uh *UserHandler) UploadProfilePicture(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	data, err := readImage(c)
+
+	if err != nil {
+		return c.Status(imageErrorStatus(err, 400)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
 
+	image, err := uh.UserService.UploadProfilePicture(currentUserId, data)
+
+	if err != nil {
+		return c.Status(imageErrorStatus(err, 500)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": image})
+}
+
+func (uh *UserHandler) UploadProfileBackgroundPicture(c *fiber.Ctx) error {
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	userDto := new(domain.UpdateMessageAcceptance)
+	data, err := readImage(c)
 
-	err := c.BodyParser(userDto)
+	if err != nil {
+		return c.Status(imageErrorStatus(err, 400)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	image, err := uh.UserService.UploadProfileBackgroundPicture(currentUserId, data)
 
 	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(imageErrorStatus(err, 500)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": image})
+}
 
-	err = uh.UserService.UpdateMessageAcceptance(currentUserId, userDto, c.Context())
+// readImage reads the "image" field of a multipart form, never more than images.MaxSize
+func readImage(c *fiber.Ctx) ([]byte, error) {
+	header, err := c.FormFile("image")
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
-		}
+		return nil, err
+	}
 
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	if header.Size > images.MaxSize {
+		return nil, images.ErrImageTooLarge
 	}
-	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+
+	file, err := header.Open()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, images.MaxSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > images.MaxSize {
+		return nil, images.ErrImageTooLarge
+	}
+
+	return data, nil
 }
 
-func (uh *UserHandler) UpdateCurrentBadge(c *fiber.Ctx) error {
+func imageErrorStatus(err error, fallback int) int {
+	switch err {
+	case images.ErrImageTooLarge:
+		return 413
+	case images.ErrUnsupportedImage:
+		return 415
+	case mongo.ErrNoDocuments:
+		return 400
+	}
+	return fallback
+}
+
+func (uh *UserHandler) UpdateMagicLink(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	userDto := new(domain.UpdateCurrentBadge)
+	userDto := new(domain.UpdateMagicLink)
 
 	err := c.BodyParser(userDto)
 
@@ -189,23 +357,20 @@ func (uh *UserHandler) UpdateCurrentBadge(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	err = uh.UserService.UpdateCurrentBadge(currentUserId, userDto, c.Context())
+	err = uh.UserService.UpdateMagicLink(currentUserId, userDto)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
-		}
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
-func (uh *UserHandler) UpdateProfilePicture(c *fiber.Ctx) error {
+func (uh *UserHandler) UpdateCurrentTagline(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	userDto := new(domain.UpdateProfilePicture)
+	userDto := new(domain.UpdateCurrentTagline)
 
 	err := c.BodyParser(userDto)
 
@@ -213,9 +378,12 @@ func (uh *UserHandler) UpdateProfilePicture(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	err = uh.UserService.UpdateProfilePicture(currentUserId, userDto, c.Context())
+	err = uh.UserService.UpdateCurrentTagline(currentUserId, userDto, c.Context())
 
 	if err != nil {
+		if err == domain.ErrTagLineLocked {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
 		if err == mongo.ErrNoDocuments {
 			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 		}
@@ -224,52 +392,151 @@ func (uh *UserHandler) UpdateProfilePicture(c *fiber.Ctx) error {
 	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
-func (uh *UserHandler) UpdateProfileBackgroundPicture(c *fiber.Ctx) error {
+func (uh *UserHandler) GetRoles(c *fiber.Ctx) error {
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": domain.RolePermissions})
+}
+
+func (uh *UserHandler) UpdateRole(c *fiber.Ctx) error {
 	c.Accepts("application/json")
+	username := strings.ToLower(c.Params("username"))
+	currentUsername := c.Locals("username").(string)
 
-	currentUserId := c.Locals("id").(primitive.ObjectID)
+	if username == currentUsername {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("you can't change your own role")})
+	}
 
-	userDto := new(domain.UpdateProfileBackgroundPicture)
+	role := new(domain.UpdateRole)
 
-	err := c.BodyParser(userDto)
+	err := c.BodyParser(role)
 
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	err = uh.UserService.UpdateProfileBackgroundPicture(currentUserId, userDto, c.Context())
+	err = role.Validate()
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
-		}
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = uh.UserService.UpdateRole(username, role)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
+
 	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
-func (uh *UserHandler) UpdateCurrentTagline(c *fiber.Ctx) error {
+func (uh *UserHandler) UpdateEmail(c *fiber.Ctx) error {
 	c.Accepts("application/json")
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	email := new(domain.UpdateEmail)
+
+	err := c.BodyParser(email)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	// stored lowercase like at signup, so the availability check compares like with like
+	email.Email = strings.ToLower(strings.TrimSpace(email.Email))
+
+	if !util.IsEmail(email.Email) {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid email")})
+	}
+
+	err = uh.UserService.RequestEmailChange(currentUserId, email)
+
+	if err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
 
+	return c.Status(202).JSON(fiber.Map{"status": "success", "message": "success", "data": "check your new email to confirm the change"})
+}
+
+func (uh *UserHandler) ChangeUsername(c *fiber.Ctx) error {
+	c.Accepts("application/json")
 	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	userDto := new(domain.UpdateCurrentTagline)
+	username := new(domain.UpdateUsername)
 
-	err := c.BodyParser(userDto)
+	err := c.BodyParser(username)
 
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
 
-	err = uh.UserService.UpdateCurrentTagline(currentUserId, userDto, c.Context())
+	if !util.IsUsername(strings.ToLower(username.Username)) {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("invalid username")})
+	}
+
+	result, err := uh.UserService.ChangeUsername(currentUserId, username, c.IP(), c.Get(fiber.HeaderUserAgent))
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 		}
+		if err == domain.ErrUsernameTaken {
+			return c.Status(409).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	// every other session was signed out, this one continues with the new username
+	return loginResponse(c, result)
+}
+
+func (uh *UserHandler) ResolveUsername(c *fiber.Ctx) error {
+	currentUsername := c.Locals("username").(string)
+
+	username, err := uh.UserService.ResolveUsername(c.Params("username"), currentUsername)
+
+	if err != nil {
+		return c.Status(profileErrorStatus(err)).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": fiber.Map{"username": username}})
+}
+
+func (uh *UserHandler) FindUsernameHistory(c *fiber.Ctx) error {
+	currentUserId := c.Locals("id").(primitive.ObjectID)
+
+	history, err := uh.UserService.FindUsernameHistory(currentUserId)
+
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
-	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": history})
+}
+
+func (uh *UserHandler) ConfirmEmailChange(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	err := uh.UserService.ConfirmEmailChange(token)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "email changed"})
+}
+
+func (uh *UserHandler) CancelEmailChange(c *fiber.Ctx) error {
+	token := c.Params("token")
+
+	err := uh.UserService.CancelEmailChange(token)
+
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "email change cancelled"})
 }
 
 func (uh *UserHandler) UpdateFlagCount(c *fiber.Ctx) error {
@@ -312,38 +579,46 @@ func (uh *UserHandler) DeleteByID(c *fiber.Ctx) error {
 		}
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
-	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+	return c.Status(202).JSON(fiber.Map{"status": "success", "message": "success", "data": "your account will be deleted in 30 days, check your email to restore it"})
 }
 
-func (uh *UserHandler) FollowUser(c *fiber.Ctx) error {
-	username := c.Locals("username").(string)
+func (uh *UserHandler) Deactivate(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+	currentUserId := c.Locals("id").(primitive.ObjectID)
 
-	currentUsername := c.Params("username")
+	deactivate := new(domain.Deactivate)
 
-	err := uh.UserService.FollowUser(strings.ToLower(currentUsername), username)
+	err := c.BodyParser(deactivate)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+	}
+
+	err = uh.UserService.Deactivate(currentUserId, deactivate)
+
+	if err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		}
+		if err == domain.ErrAccountDeactivated {
+			return c.Status(409).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 		}
 		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
+
 	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
 }
 
-func (uh *UserHandler) UnfollowUser(c *fiber.Ctx) error {
-	username := c.Locals("username").(string)
-	currentUsername := c.Params("username")
+func (uh *UserHandler) RestoreAccount(c *fiber.Ctx) error {
+	token := c.Params("token")
 
-	err := uh.UserService.UnfollowUser(strings.ToLower(currentUsername), username)
+	err := uh.UserService.RestoreAccount(token)
 
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
-		}
-		return c.Status(500).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
+		return c.Status(400).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("%v", err)})
 	}
-	return c.Status(204).JSON(fiber.Map{"status": "success", "message": "success", "data": "success"})
+
+	return c.Status(200).JSON(fiber.Map{"status": "success", "message": "success", "data": "account restored, sign in again"})
 }
 
 func (uh *UserHandler) BlockUser(c *fiber.Ctx) error {
@@ -0,0 +1,223 @@
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxSize is the largest upload accepted, in bytes
+	MaxSize = 5 << 20
+	// maxPixels keeps small files that decode into huge images out, a decoded image takes 4 bytes per pixel
+	maxPixels = 16_000_000
+	maxSide   = 8000
+	// maxDecodes how many uploads are decoded at the same time, the others wait for their turn
+	maxDecodes = 4
+)
+
+// decodes holds a slot for every upload that is being decoded
+var decodes = make(chan struct{}, maxDecodes)
+
+var (
+	ErrUnsupportedImage = errors.New("only jpeg, png and gif images are supported")
+	ErrImageTooLarge    = fmt.Errorf("images can be at most %v MB and %v pixels on a side", MaxSize>>20, maxSide)
+)
+
+// Spec is how an upload is cropped and which widths it is resized to, the first size is the full one
+type Spec struct {
+	AspectWidth  int
+	AspectHeight int
+	Widths       []int
+}
+
+var (
+	ProfilePicture    = Spec{AspectWidth: 1, AspectHeight: 1, Widths: []int{400, 200, 64}}
+	BackgroundPicture = Spec{AspectWidth: 3, AspectHeight: 1, Widths: []int{1500, 750}}
+)
+
+// Variant is one re-encoded size of an upload
+type Variant struct {
+	Width       int
+	Height      int
+	Data        []byte
+	ContentType string
+	Extension   string
+}
+
+// Process decodes the upload and re-encodes it in every size of the spec. Only the pixels survive re-encoding, so
+// EXIF and any other metadata is dropped, the orientation is applied first.
+func Process(data []byte, spec Spec) ([]Variant, error) {
+	if len(data) > MaxSize {
+		return nil, ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil || "image/"+format != contentType {
+		return nil, ErrUnsupportedImage
+	}
+
+	if config.Width > maxSide || config.Height > maxSide || config.Width*config.Height > maxPixels {
+		return nil, ErrImageTooLarge
+	}
+
+	decodes <- struct{}{}
+	defer func() { <-decodes }()
+
+	var img image.Image
+
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+	case "gif":
+		// only the first frame is kept
+		img, err = gif.Decode(bytes.NewReader(data))
+	}
+
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	src := toRGBA(img)
+
+	if format == "jpeg" {
+		src = orient(src, exifOrientation(data))
+	}
+
+	src = crop(src, spec.AspectWidth, spec.AspectHeight)
+
+	variants := make([]Variant, 0, len(spec.Widths))
+
+	for _, width := range spec.Widths {
+		// never scaled up
+		if width > src.Bounds().Dx() {
+			width = src.Bounds().Dx()
+		}
+
+		height := width * spec.AspectHeight / spec.AspectWidth
+
+		if height < 1 {
+			height = 1
+		}
+
+		resized := resize(src, width, height)
+
+		var buf bytes.Buffer
+		variant := Variant{Width: width, Height: height}
+
+		// photos stay jpeg, anything that could have transparency becomes png
+		if format == "jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+			variant.ContentType = "image/jpeg"
+			variant.Extension = "jpg"
+		} else {
+			err = png.Encode(&buf, resized)
+			variant.ContentType = "image/png"
+			variant.Extension = "png"
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		variant.Data = buf.Bytes()
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+
+	return rgba
+}
+
+// crop cuts the largest centered part with the aspect ratio out of the image
+func crop(img *image.RGBA, aspectWidth int, aspectHeight int) *image.RGBA {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	cw, ch := w, w*aspectHeight/aspectWidth
+
+	if ch > h {
+		cw, ch = h*aspectWidth/aspectHeight, h
+	}
+
+	if cw < 1 {
+		cw = 1
+	}
+
+	if ch < 1 {
+		ch = 1
+	}
+
+	x, y := (w-cw)/2, (h-ch)/2
+
+	return img.SubImage(image.Rect(x, y, x+cw, y+ch)).(*image.RGBA)
+}
+
+// resize averages every source pixel that falls into a destination pixel, good enough for downscaling
+func resize(src *image.RGBA, width int, height int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for dy := 0; dy < height; dy++ {
+		y0 := dy * sh / height
+		y1 := (dy + 1) * sh / height
+
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for dx := 0; dx < width; dx++ {
+			x0 := dx * sw / width
+			x1 := (dx + 1) * sw / width
+
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(b.Min.X+x0, b.Min.Y+y)
+
+				for x := x0; x < x1; x++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					bl += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(dx, dy)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(bl / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
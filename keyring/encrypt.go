@@ -0,0 +1,85 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Encrypt seals plaintext with AES-256-GCM under the primary key, the result is "<kid>:<base64 nonce and ciphertext>"
+// so it can still be opened after the primary key changed
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	kid, key := k.Primary()
+
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(kid))
+
+	return kid + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value made by Encrypt with any of the keys, a value whose key was removed can't be opened anymore
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	parts := strings.SplitN(value, ":", 2)
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	key, ok := k.Key(parts[0])
+
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %v", parts[0])
+	}
+
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	gcm, err := newGCM(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(parts[0]))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+
+	return plaintext, nil
+}
+
+// newGCM keys are configured as any string, they are hashed into an AES-256 key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+
+	block, err := aes.NewCipher(sum[:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,231 @@
+// Package keyring holds the signing and encryption keys, one keyring per purpose so each can be rotated on its own.
+//
+// The keys of a purpose are configured as "<kid>:<secret>" pairs separated by commas, e.g.
+//
+//	ACCESS_TOKEN_KEYS=2021-07:first-secret,2021-09:second-secret
+//	ACCESS_TOKEN_PRIMARY_KEY=2021-09
+//
+// New signatures always use the primary key, every key in the list is still accepted when verifying. Without any keys
+// configured a purpose falls back to SECRET under the kid "default", which is what tokens without a kid were signed with.
+//
+// Rotating a key:
+//  1. add the new key to the list, leaving the primary as it is, and deploy it everywhere
+//  2. make the new key the primary
+//  3. once everything signed with the old key has expired (EXPIRATION for access tokens) remove it from the list
+//
+// Values encrypted with a key, like MFA_SECRET, never expire, its old keys have to stay in the list.
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"story-app-monolith/config"
+	"strings"
+	"sync"
+)
+
+type Purpose string
+
+const (
+	// Access signs access tokens, mfa tokens and the bearer hmac
+	Access Purpose = "ACCESS_TOKEN"
+	// Reset signs password reset, unlock and email change tokens
+	Reset Purpose = "RESET_TOKEN"
+	// Verification signs email verification codes
+	Verification Purpose = "VERIFICATION_CODE"
+	// Identity hashes the ip of a story viewer
+	Identity Purpose = "VIEW_IDENTITY"
+	// MagicLink signs magic link login tokens
+	MagicLink Purpose = "MAGIC_LINK"
+	// DataExport signs the download links of account data exports
+	DataExport Purpose = "DATA_EXPORT"
+	// MfaSecret encrypts the TOTP secrets at rest
+	MfaSecret Purpose = "MFA_SECRET"
+)
+
+// DefaultKid is used for SECRET when a purpose has no keys configured
+const DefaultKid = "default"
+
+type Keyring struct {
+	Purpose Purpose
+	primary string
+	kids    []string
+	keys    map[string][]byte
+}
+
+var (
+	mu       sync.Mutex
+	keyrings = make(map[Purpose]*Keyring)
+)
+
+// purposes every purpose Load reads from the config
+var purposes = []Purpose{Access, Reset, Verification, Identity, MagicLink, DataExport, MfaSecret}
+
+// Load reads the keyring of every purpose from the config, it runs once at startup so a missing or malformed key
+// stops the server instead of failing the first request that needs it
+func Load() error {
+	loaded := make(map[Purpose]*Keyring, len(purposes))
+
+	for _, purpose := range purposes {
+		k, err := Parse(purpose, config.Config(string(purpose)+"_KEYS"), config.Config(string(purpose)+"_PRIMARY_KEY"))
+
+		if err != nil {
+			return err
+		}
+
+		loaded[purpose] = k
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for purpose, k := range loaded {
+		keyrings[purpose] = k
+	}
+
+	return nil
+}
+
+// For returns the keyring of a purpose. Without Load, e.g. in tests, it is read from the config the first time it
+// is needed.
+func For(purpose Purpose) (*Keyring, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	k, ok := keyrings[purpose]
+
+	if !ok {
+		var err error
+		k, err = Parse(purpose, config.Config(string(purpose)+"_KEYS"), config.Config(string(purpose)+"_PRIMARY_KEY"))
+
+		if err != nil {
+			return nil, err
+		}
+
+		keyrings[purpose] = k
+	}
+
+	return k, nil
+}
+
+// Set replaces the keyring of a purpose, e.g. to rotate keys without a restart
+func Set(k *Keyring) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	keyrings[k.Purpose] = k
+}
+
+// Parse builds a keyring from "<kid>:<secret>" pairs, the first pair is the primary key unless primary is set
+func Parse(purpose Purpose, keys string, primary string) (*Keyring, error) {
+	k := &Keyring{Purpose: purpose, keys: make(map[string][]byte)}
+
+	if strings.TrimSpace(keys) == "" {
+		if config.Config("SECRET") == "" {
+			return nil, fmt.Errorf("no keys for %v and SECRET isn't set", purpose)
+		}
+		keys = DefaultKid + ":" + config.Config("SECRET")
+	}
+
+	for _, pair := range strings.Split(keys, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid key for %v, keys must be <kid>:<secret>", purpose)
+		}
+
+		if _, ok := k.keys[parts[0]]; ok {
+			return nil, fmt.Errorf("duplicate kid %v for %v", parts[0], purpose)
+		}
+
+		k.kids = append(k.kids, parts[0])
+		k.keys[parts[0]] = []byte(parts[1])
+	}
+
+	k.primary = k.kids[0]
+
+	if primary != "" {
+		if _, ok := k.keys[primary]; !ok {
+			return nil, fmt.Errorf("primary key %v is not one of the keys of %v", primary, purpose)
+		}
+		k.primary = primary
+	}
+
+	return k, nil
+}
+
+// Primary returns the key new signatures are made with
+func (k *Keyring) Primary() (string, []byte) {
+	return k.primary, k.keys[k.primary]
+}
+
+func (k *Keyring) Key(kid string) ([]byte, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Kids lists every key that is accepted, the primary one first
+func (k *Keyring) Kids() []string {
+	kids := []string{k.primary}
+	for _, kid := range k.kids {
+		if kid != k.primary {
+			kids = append(kids, kid)
+		}
+	}
+	return kids
+}
+
+// Sign hex encoded HMAC-SHA256 of msg with the primary key
+func (k *Keyring) Sign(msg []byte) ([]byte, error) {
+	_, key := k.Primary()
+	return sign(key, msg)
+}
+
+// SignAll signs msg with every key, the primary one first. Stored hashes made with an older key can be looked up
+// with these.
+func (k *Keyring) SignAll(msg []byte) ([][]byte, error) {
+	kids := k.Kids()
+	sigs := make([][]byte, 0, len(kids))
+
+	for _, kid := range kids {
+		s, err := sign(k.keys[kid], msg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		sigs = append(sigs, s)
+	}
+
+	return sigs, nil
+}
+
+// Verify accepts a signature made with any of the keys
+func (k *Keyring) Verify(msg, sig []byte) (bool, error) {
+	for _, kid := range k.Kids() {
+		s, err := sign(k.keys[kid], msg)
+
+		if err != nil {
+			return false, err
+		}
+
+		if hmac.Equal(sig, s) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func sign(key, msg []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, key)
+
+	// hash is a writer
+	_, err := h.Write(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(fmt.Sprintf("%x", h.Sum(nil))), nil
+}
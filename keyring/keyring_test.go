@@ -0,0 +1,107 @@
+package keyring
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseRejectsMalformedKeys(t *testing.T) {
+	_ = os.Setenv("SECRET", "test-secret")
+	defer os.Unsetenv("SECRET")
+
+	for _, keys := range []string{"no-secret", ":secret", "kid:", "a:one,a:two", "a:one,,b:two"} {
+		if _, err := Parse(Access, keys, ""); err == nil {
+			t.Errorf("%q: expected an error", keys)
+		}
+	}
+
+	if _, err := Parse(Access, "a:one,b:two", "c"); err == nil {
+		t.Error("expected an error for a primary key that isn't on the keyring")
+	}
+
+	k, err := Parse(Access, "a:one,b:two", "b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if kid, _ := k.Primary(); kid != "b" {
+		t.Errorf("expected b to be the primary key, got %v", kid)
+	}
+}
+
+func TestLoadFailsWithoutKeys(t *testing.T) {
+	_ = os.Unsetenv("SECRET")
+
+	if err := Load(); err == nil {
+		t.Error("expected an error without keys or SECRET")
+	}
+
+	_ = os.Setenv("SECRET", "test-secret")
+	defer os.Unsetenv("SECRET")
+
+	_ = os.Setenv("MAGIC_LINK_KEYS", "malformed")
+	defer os.Unsetenv("MAGIC_LINK_KEYS")
+
+	if err := Load(); err == nil {
+		t.Error("expected an error for malformed keys")
+	}
+
+	_ = os.Unsetenv("MAGIC_LINK_KEYS")
+
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, purpose := range purposes {
+		if _, err := For(purpose); err != nil {
+			t.Errorf("%v: %v", purpose, err)
+		}
+	}
+}
+
+func TestEncryptSurvivesRotation(t *testing.T) {
+	old, err := Parse(MfaSecret, "a:one", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := old.Encrypt([]byte("JBSWY3DPEHPK3PXP"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := Parse(MfaSecret, "a:one,b:two", "b")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext, err := rotated.Decrypt(value)
+
+	if err != nil || string(plaintext) != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected the old value to decrypt after rotating, got %q %v", plaintext, err)
+	}
+
+	tampered := value[:len(value)-2] + "AA"
+
+	if tampered == value {
+		tampered = value[:len(value)-2] + "BB"
+	}
+
+	if _, err = rotated.Decrypt(tampered); err == nil {
+		t.Error("expected a tampered value to be rejected")
+	}
+
+	removed, err := Parse(MfaSecret, "b:two", "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = removed.Decrypt(value); err == nil {
+		t.Error("expected a value to be unreadable once its key was removed")
+	}
+}
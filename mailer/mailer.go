@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"story-app-monolith/config"
+	"strings"
+	"time"
+)
+
+// Message is a single transactional email with a plain text and an html body
+type Message struct {
+	To      string
+	ToName  string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers a message through a provider
+type Mailer interface {
+	Send(message *Message) error
+}
+
+var queue *Queue
+
+// NewMailerFromConfig picks the implementation from the MAILER env var, "sendgrid", "smtp" or "outbox". It has to be
+// set, otherwise a server without a provider would look like it's sending emails.
+func NewMailerFromConfig() (Mailer, error) {
+	from := config.Config("MAIL_FROM_ADDRESS")
+	fromName := config.Config("MAIL_FROM_NAME")
+
+	switch strings.ToLower(config.Config("MAILER")) {
+	case "sendgrid":
+		if config.Config("SENDGRID_API_KEY") == "" {
+			return nil, fmt.Errorf("SENDGRID_API_KEY isn't set")
+		}
+		return NewSendGridMailer(config.Config("SENDGRID_API_KEY"), from, fromName), nil
+	case "smtp":
+		if config.Config("SMTP_HOST") == "" {
+			return nil, fmt.Errorf("SMTP_HOST isn't set")
+		}
+		return NewSMTPMailer(config.Config("SMTP_HOST"), config.Config("SMTP_PORT"),
+			config.Config("SMTP_USERNAME"), config.Config("SMTP_PASSWORD"), from, fromName), nil
+	case "outbox":
+		log.Println("MAILER is outbox, emails are only kept locally")
+		return NewOutbox(config.Config("OUTBOX_DIR")), nil
+	case "":
+		return nil, fmt.Errorf("MAILER isn't set, use sendgrid, smtp or outbox")
+	default:
+		return nil, fmt.Errorf("unknown mailer %v", config.Config("MAILER"))
+	}
+}
+
+// Start sets up the default queue from the config, it runs once at startup so a missing provider stops the server
+func Start() error {
+	m, err := NewMailerFromConfig()
+
+	if err != nil {
+		return err
+	}
+
+	queue = NewQueue(m, 4, 5, 2*time.Second)
+
+	return nil
+}
+
+// Send queues the message on the default queue, delivery happens in the background
+func Send(message *Message) {
+	if queue == nil {
+		log.Printf("mailer isn't started, dropping email to %v", message.To)
+		return
+	}
+
+	queue.Enqueue(message)
+}
@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestNewMailerFromConfigNeedsMailer(t *testing.T) {
+	for _, mailer := range []string{"", "carrier-pigeon", "sendgrid", "smtp"} {
+		_ = os.Setenv("MAILER", mailer)
+		_ = os.Unsetenv("SENDGRID_API_KEY")
+		_ = os.Unsetenv("SMTP_HOST")
+
+		if _, err := NewMailerFromConfig(); err == nil {
+			t.Errorf("MAILER=%q: expected an error", mailer)
+		}
+	}
+
+	_ = os.Setenv("MAILER", "outbox")
+	defer os.Unsetenv("MAILER")
+
+	if _, err := NewMailerFromConfig(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOutboxKeepsTheLastMessages(t *testing.T) {
+	outbox := NewOutbox("")
+
+	for i := 0; i < outboxSize+10; i++ {
+		if err := outbox.Send(&Message{To: fmt.Sprintf("%d@example.com", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages := outbox.Messages()
+
+	if len(messages) != outboxSize {
+		t.Fatalf("expected %v messages, got %v", outboxSize, len(messages))
+	}
+
+	if messages[0].To != "10@example.com" {
+		t.Errorf("expected the oldest messages to go first, got %v", messages[0].To)
+	}
+}
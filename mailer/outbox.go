@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outboxSize how many messages the outbox keeps in memory, the oldest ones go first
+const outboxSize = 100
+
+// Outbox keeps the last sent messages in memory and, when dir is set, also writes them to files.
+// It's meant for local development and tests.
+type Outbox struct {
+	mu       sync.Mutex
+	dir      string
+	messages []Message
+}
+
+func (o *Outbox) Send(message *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, *message)
+
+	if len(o.messages) > outboxSize {
+		o.messages = o.messages[len(o.messages)-outboxSize:]
+	}
+
+	if o.dir == "" {
+		return nil
+	}
+
+	name := fmt.Sprintf("%d-%v.txt", time.Now().UnixNano(), strings.ReplaceAll(message.To, "@", "_at_"))
+	content := fmt.Sprintf("To: %v\nSubject: %v\n\n%v\n\n----- html -----\n\n%v\n", message.To, message.Subject, message.Text, message.HTML)
+
+	return ioutil.WriteFile(filepath.Join(o.dir, name), []byte(content), 0644)
+}
+
+// Messages returns a copy of the last messages sent
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	messages := make([]Message, len(o.messages))
+	copy(messages, o.messages)
+
+	return messages
+}
+
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{dir: dir, messages: make([]Message, 0)}
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"log"
+	"time"
+)
+
+// Queue sends messages on a pool of workers so that a slow provider never blocks a request.
+// Failed sends are retried with exponential backoff.
+type Queue struct {
+	mailer      Mailer
+	jobs        chan *Message
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func (q *Queue) Enqueue(message *Message) {
+	select {
+	case q.jobs <- message:
+	default:
+		log.Printf("mail queue is full, dropping email to %v", message.To)
+	}
+}
+
+func (q *Queue) work() {
+	for message := range q.jobs {
+		q.deliver(message)
+	}
+}
+
+func (q *Queue) deliver(message *Message) {
+	wait := q.backoff
+
+	for attempt := 1; attempt <= q.maxAttempts; attempt++ {
+		err := q.mailer.Send(message)
+
+		if err == nil {
+			return
+		}
+
+		log.Printf("failed to send email to %v (attempt %d of %d): %v", message.To, attempt, q.maxAttempts, err)
+
+		if attempt < q.maxAttempts {
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+}
+
+func NewQueue(mailer Mailer, workers int, maxAttempts int, backoff time.Duration) *Queue {
+	q := &Queue{mailer: mailer, jobs: make(chan *Message, 256), maxAttempts: maxAttempts, backoff: backoff}
+
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
@@ -0,0 +1,35 @@
+package mailer
+
+import (
+	"fmt"
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+type SendGridMailer struct {
+	client   *sendgrid.Client
+	from     string
+	fromName string
+}
+
+func (s SendGridMailer) Send(message *Message) error {
+	from := mail.NewEmail(s.fromName, s.from)
+	to := mail.NewEmail(message.ToName, message.To)
+	m := mail.NewSingleEmail(from, message.Subject, to, message.Text, message.HTML)
+
+	response, err := s.client.Send(m)
+
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid responded with %d: %v", response.StatusCode, response.Body)
+	}
+
+	return nil
+}
+
+func NewSendGridMailer(apiKey, from, fromName string) SendGridMailer {
+	return SendGridMailer{client: sendgrid.NewSendClient(apiKey), from: from, fromName: fromName}
+}
@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+type SMTPMailer struct {
+	host     string
+	port     string
+	auth     smtp.Auth
+	from     string
+	fromName string
+}
+
+func (s SMTPMailer) Send(message *Message) error {
+	body, err := s.build(message)
+
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.host+":"+s.port, s.auth, s.from, []string{message.To}, body)
+}
+
+// build writes the message as multipart/alternative so clients can pick the html or the plain text part
+func (s SMTPMailer) build(message *Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w := multipart.NewWriter(&buf)
+
+	from := mail.Address{Name: s.fromName, Address: s.from}
+	to := mail.Address{Name: message.ToName, Address: message.To}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	}
+
+	for _, p := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {p.contentType}})
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = pw.Write([]byte(p.content))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := w.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func NewSMTPMailer(host, port, username, password, from, fromName string) SMTPMailer {
+	var auth smtp.Auth
+
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return SMTPMailer{host: host, port: port, auth: auth, from: from, fromName: fromName}
+}
@@ -0,0 +1,163 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"story-app-monolith/config"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFiles, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFiles, "templates/*.txt"))
+)
+
+// EmailData is what every template is rendered with
+type EmailData struct {
+	Username string
+	Link     string
+	Alert    string
+	Email    string
+}
+
+// Render builds a message from the "<name>.html" and "<name>.txt" templates
+func Render(name, subject, to, username string, data EmailData) (*Message, error) {
+	data.Username = username
+
+	var html bytes.Buffer
+	err := htmlTemplates.ExecuteTemplate(&html, name+".html", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var text bytes.Buffer
+	err = textTemplates.ExecuteTemplate(&text, name+".txt", data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{To: to, ToName: username, Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+func SendVerificationEmail(to, username, code string) error {
+	m, err := Render("verification", "Verify your email address", to, username,
+		EmailData{Link: config.Config("APP_URL") + "/auth/account/" + code})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+func SendPasswordResetEmail(to, username, token string) error {
+	m, err := Render("passwordReset", "Reset your password", to, username,
+		EmailData{Link: config.Config("APP_URL") + "/auth/reset/" + token})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+func SendMagicLinkEmail(to, username, token string) error {
+	m, err := Render("magicLink", "Your sign in link", to, username,
+		EmailData{Link: config.Config("APP_URL") + "/auth/magic/" + token})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+func SendAccountLockedEmail(to, username, token string) error {
+	m, err := Render("accountLocked", "Your account has been locked", to, username,
+		EmailData{Link: config.Config("APP_URL") + "/auth/unlock/" + token})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+func SendSecurityAlertEmail(to, username, alert string) error {
+	m, err := Render("securityAlert", "Security alert for your account", to, username, EmailData{Alert: alert})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+func SendEmailChangeConfirmationEmail(to, username, token string) error {
+	m, err := Render("emailChange", "Confirm your new email address", to, username,
+		EmailData{Link: config.Config("APP_URL") + "/users/email/confirm/" + token})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+// SendEmailChangeNoticeEmail goes to the current address, the link cancels the pending change
+func SendEmailChangeNoticeEmail(to, username, newEmail, cancelToken string) error {
+	m, err := Render("emailChangeNotice", "Your email address is being changed", to, username,
+		EmailData{Email: newEmail, Link: config.Config("APP_URL") + "/users/email/cancel/" + cancelToken})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+func SendDataExportEmail(to, username, link string) error {
+	m, err := Render("dataExport", "Your data export is ready", to, username, EmailData{Link: link})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
+
+// SendAccountDeletionEmail the link restores the account until it is purged
+func SendAccountDeletionEmail(to, username, token string) error {
+	m, err := Render("accountDeletion", "Your account will be deleted", to, username,
+		EmailData{Link: config.Config("APP_URL") + "/users/restore/" + token})
+
+	if err != nil {
+		return err
+	}
+
+	Send(m)
+
+	return nil
+}
@@ -6,7 +6,11 @@ import (
 	"os"
 	"os/signal"
 	"story-app-monolith/database"
+	"story-app-monolith/keyring"
+	"story-app-monolith/mailer"
+	"story-app-monolith/repo"
 	"story-app-monolith/router"
+	"time"
 )
 
 func init() {
@@ -16,6 +20,45 @@ func init() {
 func main() {
 	app := router.Setup()
 
+	if err := keyring.Load(); err != nil {
+		log.Fatal("keyring: ", err)
+	}
+
+	if err := mailer.Start(); err != nil {
+		log.Fatal("mailer: ", err)
+	}
+
+	// follows from before the follow graph become edges
+	if err := repo.MigrateFollowArrays(); err != nil {
+		log.Fatal("follow migration: ", err)
+	}
+
+	// users from before the privacy settings keep what their old flags allowed
+	if err := repo.MigratePrivacySettings(); err != nil {
+		log.Fatal("privacy settings migration: ", err)
+	}
+
+	// TOTP secrets from before they were encrypted
+	if err := repo.MigrateMfaSecrets(); err != nil {
+		log.Fatal("mfa secret migration: ", err)
+	}
+
+	// the first admin, every other one is appointed by an admin
+	if err := repo.BootstrapAdmin(); err != nil {
+		log.Fatal("admin bootstrap: ", err)
+	}
+
+	// accounts past their deletion grace period
+	repo.StartAccountPurge(time.Hour)
+	// renames that were interrupted before all references were migrated
+	repo.StartUsernameMigrations(10 * time.Minute)
+	// decays everyone's reputation and backfills the users that never had one
+	repo.StartReputationRecompute(24 * time.Hour)
+	// the most liked story of the last 7 days
+	repo.StartTopStoryOfWeek(7 * 24 * time.Hour)
+	// achievements users qualified for before they were introduced
+	repo.StartAchievementBackfill()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
 
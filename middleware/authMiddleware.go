@@ -3,12 +3,56 @@ package middleware
 import (
 	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+	"strings"
+	"sync"
+	"time"
 )
 
+// RevocationRepo is checked on every request, it can be swapped for repo.NewInMemoryRevocationRepo() in tests
+var RevocationRepo repo.RevocationRepo = repo.NewRevocationRepoImpl()
+
+// SessionRepo keeps the last seen time of sessions, terminated sessions are refused by RevocationRepo
+var SessionRepo repo.SessionRepo = repo.NewSessionRepoImpl()
+
+// seenInterval how out of date the last seen time of a session is allowed to get
+const seenInterval = 5 * time.Minute
+
+var (
+	seenMu sync.Mutex
+	seen   = make(map[string]time.Time)
+)
+
+// ApiKeyRepo looks up the keys sent as "Authorization: ApiKey <key>"
+var ApiKeyRepo repo.ApiKeyRepo = repo.NewApiKeyRepoImpl()
+
+const apiKeyScheme = "ApiKey "
+
+// IsLoggedIn only accepts access tokens, routes that api keys can be used on are guarded by IsLoggedInWithScope
 func IsLoggedIn(c *fiber.Ctx) error {
+	return authenticate(c, "")
+}
+
+// IsLoggedInWithScope accepts an access token, or an api key that was granted the scope
+func IsLoggedInWithScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return authenticate(c, scope)
+	}
+}
+
+func authenticate(c *fiber.Ctx, scope string) error {
 	token := c.Get("Authorization")
 
+	if strings.HasPrefix(token, apiKeyScheme) {
+		if scope == "" {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("api keys can't be used here")})
+		}
+
+		return authenticateApiKey(c, strings.TrimPrefix(token, apiKeyScheme), scope)
+	}
+
 	var auth domain.Authentication
 	u, loggedIn, err := auth.IsLoggedIn(token)
 
@@ -16,8 +60,92 @@ func IsLoggedIn(c *fiber.Ctx) error {
 		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Unauthorized user")})
 	}
 
+	// tokens issued before sessions existed carry no "sid" and stay valid until they expire
+	sid, err := primitive.ObjectIDFromHex(u.SessionId)
+
+	if u.SessionId != "" && err != nil {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Unauthorized user")})
+	}
+
+	// the token, its session and logouts everywhere are checked in one lookup
+	revoked, err := RevocationRepo.IsRevoked(u.Jti, u.SessionId, u.Id, u.IssuedAtMs)
+
+	if err != nil || revoked {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Unauthorized user")})
+	}
+
+	if u.SessionId != "" && markSeen(u.SessionId, time.Now()) {
+		go func() {
+			_ = SessionRepo.Seen(sid)
+		}()
+	}
+
 	c.Locals("username", u.Username)
 	c.Locals("id", u.Id)
+	c.Locals("jti", u.Jti)
+	c.Locals("sid", u.SessionId)
+	c.Locals("expiresAt", u.ExpiresAt)
+	c.Locals("role", u.Role)
+	c.Locals("permissions", u.Permissions)
+
+	err = c.Next()
+
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Unauthorized user")})
+	}
+
+	return nil
+}
+
+// markSeen is true when the session's last seen time should be updated, at most once every seenInterval per
+// session in this process
+func markSeen(sessionId string, now time.Time) bool {
+	seenMu.Lock()
+	defer seenMu.Unlock()
+
+	if last, ok := seen[sessionId]; ok && now.Sub(last) < seenInterval {
+		return false
+	}
+
+	// sessions that weren't used for a while are forgotten so the map doesn't keep growing
+	if len(seen) >= 10000 {
+		for id, last := range seen {
+			if now.Sub(last) >= seenInterval {
+				delete(seen, id)
+			}
+		}
+	}
+
+	seen[sessionId] = now
+
+	return true
+}
+
+// authenticateApiKey sets the same locals as an access token does, an api key never carries any permissions
+func authenticateApiKey(c *fiber.Ctx, key string, scope string) error {
+	apiKey, err := ApiKeyRepo.FindByKey(key)
+
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Unauthorized user")})
+	}
+
+	if !apiKey.HasScope(scope) {
+		return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("api key is missing the %v scope", scope)})
+	}
+
+	ip := c.IP()
+	go func() {
+		_ = ApiKeyRepo.Used(apiKey.Id, ip)
+	}()
+
+	c.Locals("username", apiKey.Username)
+	c.Locals("id", apiKey.UserId)
+	c.Locals("jti", "")
+	c.Locals("sid", "")
+	c.Locals("expiresAt", int64(0))
+	c.Locals("role", domain.RoleUser)
+	c.Locals("permissions", []string{})
+	c.Locals("apiKeyId", apiKey.Id)
 
 	err = c.Next()
 
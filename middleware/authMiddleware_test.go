@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http/httptest"
+	"os"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	_ = os.Setenv("SECRET", "test-secret")
+	_ = os.Setenv("EXPIRATION", "15")
+
+	os.Exit(m.Run())
+}
+
+// bearer signs an access token for the user the way a login hands it out, it has no session
+func bearer(t *testing.T, user domain.User) (string, *domain.Authentication) {
+	t.Helper()
+
+	var auth domain.Authentication
+
+	token, err := auth.GenerateJWT(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := auth.SignToken([]byte(token))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := "Bearer " + token + "|" + string(sig)
+
+	parsed, _, err := auth.IsLoggedIn(value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return value, parsed
+}
+
+func status(t *testing.T, app *fiber.App, token string) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", token)
+
+	res, err := app.Test(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode
+}
+
+func TestIsLoggedInRevocation(t *testing.T) {
+	revocations := repo.NewInMemoryRevocationRepo()
+	RevocationRepo = revocations
+	defer func() { RevocationRepo = repo.NewRevocationRepoImpl() }()
+
+	app := fiber.New()
+	app.Get("/", IsLoggedIn, func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	user := domain.User{Id: primitive.NewObjectID(), Username: "reader", Role: domain.RoleUser}
+
+	token, auth := bearer(t, user)
+
+	if code := status(t, app, token); code != 200 {
+		t.Fatalf("expected a fresh token to be accepted, got %v", code)
+	}
+
+	if code := status(t, app, "Bearer not-a-token|sig"); code != 401 {
+		t.Errorf("expected a malformed token to be refused, got %v", code)
+	}
+
+	// logging out revokes just the one token
+	other, _ := bearer(t, user)
+
+	if err := revocations.Revoke(auth.Jti, user.Id, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := status(t, app, token); code != 401 {
+		t.Errorf("expected a revoked token to be refused, got %v", code)
+	}
+
+	if code := status(t, app, other); code != 200 {
+		t.Errorf("expected the other token to be accepted, got %v", code)
+	}
+
+	// logging out everywhere, e.g. on a password change, followed by a new login in the same second
+	time.Sleep(2 * time.Millisecond)
+
+	if err := revocations.RevokeAllByUserId(user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+
+	fresh, _ := bearer(t, user)
+
+	if code := status(t, app, other); code != 401 {
+		t.Errorf("expected a token from before the logout to be refused, got %v", code)
+	}
+
+	if code := status(t, app, fresh); code != 200 {
+		t.Errorf("expected a token from after the logout to be accepted, got %v", code)
+	}
+}
+
+func TestIsLoggedInTerminatedSession(t *testing.T) {
+	revocations := repo.NewInMemoryRevocationRepo()
+	RevocationRepo = revocations
+	defer func() { RevocationRepo = repo.NewRevocationRepoImpl() }()
+
+	app := fiber.New()
+	app.Get("/", IsLoggedIn, func(c *fiber.Ctx) error {
+		return c.SendStatus(200)
+	})
+
+	user := domain.User{Id: primitive.NewObjectID(), Username: "reader", Role: domain.RoleUser}
+	sid := primitive.NewObjectID()
+
+	auth := domain.Authentication{SessionId: sid.Hex()}
+
+	token, err := auth.GenerateJWT(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := auth.SignToken([]byte(token))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := "Bearer " + token + "|" + string(sig)
+
+	if code := status(t, app, value); code != 200 {
+		t.Fatalf("expected a token of an active session to be accepted, got %v", code)
+	}
+
+	if err := revocations.RevokeSession(sid, user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := status(t, app, value); code != 401 {
+		t.Fatalf("expected a token of a terminated session to be refused, got %v", code)
+	}
+}
+
+func TestMarkSeen(t *testing.T) {
+	now := time.Now()
+	sid := primitive.NewObjectID().Hex()
+
+	if !markSeen(sid, now) {
+		t.Fatal("expected the first request of a session to update last seen")
+	}
+
+	if markSeen(sid, now.Add(seenInterval-time.Second)) {
+		t.Fatal("expected last seen to be left alone within the interval")
+	}
+
+	if !markSeen(sid, now.Add(seenInterval)) {
+		t.Fatal("expected last seen to be updated once the interval passed")
+	}
+
+	if !markSeen(primitive.NewObjectID().Hex(), now) {
+		t.Fatal("expected another session to be tracked on its own")
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePermission must run after IsLoggedIn, the user needs every one of the given permissions
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		granted, ok := c.Locals("permissions").([]string)
+
+		if !ok {
+			return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Forbidden")})
+		}
+
+		for _, p := range permissions {
+			if !hasPermission(granted, p) {
+				return c.Status(403).JSON(fiber.Map{"status": "error", "message": "error...", "data": fmt.Sprintf("Forbidden")})
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+func hasPermission(granted []string, permission string) bool {
+	for _, g := range granted {
+		if g == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package oidc
+
+import (
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// jwksRefreshInterval a token signed with an unknown kid refetches the keys at most this often
+const jwksRefreshInterval = time.Minute
+
+// clockSkew is tolerated on exp, iat and nbf
+const clockSkew = 2 * time.Minute
+
+// IdTokenClaims are the verified claims of an id token
+type IdTokenClaims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type keySet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// VerifyIdToken checks the signature against the provider's keys, the issuer, the audience, the expiry and the nonce
+func (p *Provider) VerifyIdToken(raw, nonce string) (*IdTokenClaims, error) {
+	token, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+		if t.Method.Alg() != jwt.SigningMethodRS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Method.Alg())
+		}
+
+		kid, _ := t.Header["kid"].(string)
+
+		return p.publicKey(kid)
+	})
+
+	// exp, iat and nbf are checked below with some clock skew
+	if err != nil {
+		timing := jwt.ValidationErrorExpired | jwt.ValidationErrorIssuedAt | jwt.ValidationErrorNotValidYet
+
+		if ve, ok := err.(*jwt.ValidationError); !ok || ve.Errors&^timing != 0 {
+			return nil, err
+		}
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+
+	if !ok {
+		return nil, fmt.Errorf("invalid id token")
+	}
+
+	now := time.Now()
+
+	if !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true) {
+		return nil, fmt.Errorf("id token has expired")
+	}
+
+	if !claims.VerifyIssuedAt(now.Add(clockSkew).Unix(), false) || !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), false) {
+		return nil, fmt.Errorf("id token is not valid yet")
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.Issuer {
+		return nil, fmt.Errorf("id token was issued by %v", iss)
+	}
+
+	if !hasAudience(claims["aud"], p.ClientId) {
+		return nil, fmt.Errorf("id token wasn't issued for this client")
+	}
+
+	if n, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(n), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("id token nonce doesn't match")
+	}
+
+	c := &IdTokenClaims{}
+	c.Subject, _ = claims["sub"].(string)
+	c.Email, _ = claims["email"].(string)
+	c.Name, _ = claims["name"].(string)
+	c.PreferredUsername, _ = claims["preferred_username"].(string)
+
+	// some providers send it as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		c.EmailVerified = v
+	case string:
+		c.EmailVerified = v == "true"
+	}
+
+	if c.Subject == "" {
+		return nil, fmt.Errorf("id token has no subject")
+	}
+
+	c.Email = strings.ToLower(c.Email)
+
+	return c, nil
+}
+
+// hasAudience aud is either a string or a list of strings
+func hasAudience(aud interface{}, clientId string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientId
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// publicKey finds the signing key by kid, refetching the keys once in a while so rotated keys are picked up
+func (p *Provider) publicKey(kid string) (*rsa.PublicKey, error) {
+	d, err := p.Discover()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.keys.find(kid); key != nil {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval && p.keys != nil {
+		return nil, fmt.Errorf("unknown signing key %v", kid)
+	}
+
+	keys := new(keySet)
+	err = p.getJSON(d.JwksUri, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key := p.keys.find(kid); key != nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing key %v", kid)
+}
+
+// find a token without a kid can only be checked when the provider has exactly one key
+func (s *keySet) find(kid string) *rsa.PublicKey {
+	if s == nil {
+		return nil
+	}
+
+	candidates := make([]jwk, 0)
+	for _, k := range s.Keys {
+		if k.Kty == "RSA" && (k.Use == "" || k.Use == "sig") {
+			candidates = append(candidates, k)
+		}
+	}
+
+	for _, k := range candidates {
+		if k.Kid == kid || (kid == "" && len(candidates) == 1) {
+			key, err := k.rsaPublicKey()
+
+			if err != nil {
+				return nil
+			}
+
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+
+	if !exponent.IsInt64() || exponent.Int64() < 3 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
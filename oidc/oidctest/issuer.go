@@ -0,0 +1,184 @@
+// Package oidctest is a mock OpenID Connect issuer for tests. It serves discovery, the signing keys and a token
+// endpoint that checks the PKCE verifier, the id tokens it returns can be tampered with per authorization.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"story-app-monolith/oidc"
+	"sync"
+	"time"
+)
+
+const kid = "test-key"
+
+type Issuer struct {
+	Server   *httptest.Server
+	ClientId string
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is what an authorization code stands for until it is exchanged
+type grant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+// NewIssuer starts the issuer, Close stops it
+func NewIssuer(clientId string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Issuer{ClientId: clientId, key: key, codes: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", i.discovery)
+	mux.HandleFunc("/jwks", i.jwks)
+	mux.HandleFunc("/token", i.token)
+
+	i.Server = httptest.NewServer(mux)
+
+	return i, nil
+}
+
+func (i *Issuer) Close() {
+	i.Server.Close()
+}
+
+func (i *Issuer) URL() string {
+	return i.Server.URL
+}
+
+// Provider is a provider for the issuer, register it with oidc.Register to use it by name
+func (i *Issuer) Provider(name string) *oidc.Provider {
+	return &oidc.Provider{
+		Name:        name,
+		Issuer:      i.URL(),
+		ClientId:    i.ClientId,
+		RedirectUrl: "https://app.test/auth/oidc/" + name + "/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+		HttpClient:  i.Server.Client(),
+	}
+}
+
+// Claims are the claims of a valid id token for the subject, without a nonce
+func (i *Issuer) Claims(subject string, email string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            i.URL(),
+		"aud":            i.ClientId,
+		"sub":            subject,
+		"email":          email,
+		"email_verified": true,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// Authorize plays the user signing in at the authorization url and returns the code for the callback. The nonce of
+// the url is added to the claims unless they already have one.
+func (i *Issuer) Authorize(authUrl string, claims jwt.MapClaims) (string, error) {
+	u, err := url.Parse(authUrl)
+
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+
+	if q.Get("client_id") != i.ClientId || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		return "", fmt.Errorf("invalid authorization request %v", authUrl)
+	}
+
+	if _, ok := claims["nonce"]; !ok {
+		claims["nonce"] = q.Get("nonce")
+	}
+
+	code, err := oidc.RandomString()
+
+	if err != nil {
+		return "", err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.codes[code] = grant{challenge: q.Get("code_challenge"), claims: claims}
+
+	return code, nil
+}
+
+// Sign signs the claims with the issuer's key
+func (i *Issuer) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(i.key)
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, oidc.Discovery{
+		Issuer:                i.URL(),
+		AuthorizationEndpoint: i.URL() + "/authorize",
+		TokenEndpoint:         i.URL() + "/token",
+		JwksUri:               i.URL() + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := i.key.PublicKey
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// token codes can only be exchanged once and only with the verifier of their challenge
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	i.mu.Lock()
+	g, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mu.Unlock()
+
+	if !ok || oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := i.Sign(g.claims)
+
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, oidc.TokenResponse{AccessToken: "access", TokenType: "Bearer", IdToken: idToken, ExpiresIn: 3600})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
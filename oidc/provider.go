@@ -0,0 +1,266 @@
+// Package oidc is a small OpenID Connect relying party for the authorization code flow with PKCE.
+//
+// Providers are configured from env, OIDC_PROVIDERS lists their names and every provider has its own keys, e.g.
+//
+//	OIDC_PROVIDERS=google,gitlab
+//	OIDC_GOOGLE_ISSUER=https://accounts.google.com
+//	OIDC_GOOGLE_CLIENT_ID=...
+//	OIDC_GOOGLE_CLIENT_SECRET=...
+//	OIDC_GOOGLE_REDIRECT_URL=https://example.com/auth/oidc/google/callback
+//	OIDC_GOOGLE_SCOPES=openid email profile
+//
+// Everything else (endpoints and signing keys) is read from the issuer's discovery document.
+package oidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"story-app-monolith/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Discovery is the part of /.well-known/openid-configuration that is used
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+	// HttpClient is used for every request to the provider, it can point at a mock issuer
+	HttpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *Discovery
+	keys          *keySet
+	keysFetchedAt time.Time
+}
+
+var (
+	mu        sync.Mutex
+	providers = make(map[string]*Provider)
+)
+
+// For returns a configured provider, unknown names are an error
+func For(name string) (*Provider, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if p, ok := providers[name]; ok {
+		return p, nil
+	}
+
+	if !isConfigured(name) {
+		return nil, fmt.Errorf("unknown provider %v", name)
+	}
+
+	p, err := FromConfig(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	providers[name] = p
+
+	return p, nil
+}
+
+// Register adds or replaces a provider, e.g. one that isn't configured from env
+func Register(p *Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	providers[p.Name] = p
+}
+
+// Names lists the providers from OIDC_PROVIDERS
+func Names() []string {
+	names := make([]string, 0)
+
+	for _, name := range strings.Split(config.Config("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+func isConfigured(name string) bool {
+	for _, n := range Names() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func FromConfig(name string) (*Provider, error) {
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+	p := &Provider{
+		Name:         name,
+		Issuer:       strings.TrimSuffix(config.Config(prefix+"ISSUER"), "/"),
+		ClientId:     config.Config(prefix + "CLIENT_ID"),
+		ClientSecret: config.Config(prefix + "CLIENT_SECRET"),
+		RedirectUrl:  config.Config(prefix + "REDIRECT_URL"),
+		Scopes:       strings.Fields(config.Config(prefix + "SCOPES")),
+		HttpClient:   &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if p.Issuer == "" || p.ClientId == "" || p.RedirectUrl == "" {
+		return nil, fmt.Errorf("provider %v needs an issuer, a client id and a redirect url", name)
+	}
+
+	if len(p.Scopes) == 0 {
+		p.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return p, nil
+}
+
+// Discover fetches the discovery document once, its issuer has to be the configured one
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	d := new(Discovery)
+	err := p.getJSON(p.Issuer+"/.well-known/openid-configuration", d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("issuer %v doesn't match the configured issuer", d.Issuer)
+	}
+
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JwksUri == "" {
+		return nil, fmt.Errorf("discovery document of %v is incomplete", p.Name)
+	}
+
+	p.discovery = d
+
+	return d, nil
+}
+
+// AuthCodeURL is where the user is sent to sign in with the provider
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	d, err := p.Discover()
+
+	if err != nil {
+		return "", err
+	}
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.ClientId)
+	v.Set("redirect_uri", p.RedirectUrl)
+	v.Set("scope", strings.Join(p.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", codeChallenge)
+	v.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return d.AuthorizationEndpoint + separator + v.Encode(), nil
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IdToken     string `json:"id_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Exchange trades the authorization code and the PKCE verifier for tokens
+func (p *Provider) Exchange(code, codeVerifier string) (*TokenResponse, error) {
+	d, err := p.Discover()
+
+	if err != nil {
+		return nil, err
+	}
+
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.RedirectUrl)
+	v.Set("code_verifier", codeVerifier)
+	v.Set("client_id", p.ClientId)
+
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(v.Encode()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	// public clients only send the verifier
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	}
+
+	res, err := p.HttpClient.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint of %v answered with %v", p.Name, res.StatusCode)
+	}
+
+	t := new(TokenResponse)
+	err = json.NewDecoder(res.Body).Decode(t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t.IdToken == "" {
+		return nil, fmt.Errorf("%v didn't return an id token", p.Name)
+	}
+
+	return t, nil
+}
+
+func (p *Provider) getJSON(u string, v interface{}) error {
+	res, err := p.HttpClient.Get(u)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v answered with %v", u, res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -0,0 +1,162 @@
+package oidc_test
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"story-app-monolith/oidc"
+	"story-app-monolith/oidc/oidctest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signIn starts a sign in with the provider and returns the code the issuer sends back and the PKCE verifier
+func signIn(t *testing.T, issuer *oidctest.Issuer, p *oidc.Provider, nonce string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+
+	verifier, err := oidc.RandomString()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authUrl, err := p.AuthCodeURL("state", nonce, oidc.CodeChallenge(verifier))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := issuer.Authorize(authUrl, claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return code, verifier
+}
+
+func newIssuer(t *testing.T) (*oidctest.Issuer, *oidc.Provider) {
+	t.Helper()
+
+	issuer, err := oidctest.NewIssuer("client")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(issuer.Close)
+
+	return issuer, issuer.Provider("test")
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	issuer, p := newIssuer(t)
+
+	code, verifier := signIn(t, issuer, p, "nonce", issuer.Claims("subject", "User@Example.com"))
+
+	tokens, err := p.Exchange(code, verifier)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := p.VerifyIdToken(tokens.IdToken, "nonce")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "subject" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestVerifyIdTokenRejects(t *testing.T) {
+	issuer, p := newIssuer(t)
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		err    string
+	}{
+		{"bad nonce", func(c jwt.MapClaims) { c["nonce"] = "someone else's nonce" }, "nonce"},
+		{"missing nonce", func(c jwt.MapClaims) { c["nonce"] = "" }, "nonce"},
+		{"bad issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }, "issued by"},
+		{"bad audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }, "this client"},
+		{"bad audience list", func(c jwt.MapClaims) { c["aud"] = []string{"another-client"} }, "this client"},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "expired"},
+		{"no expiry", func(c jwt.MapClaims) { delete(c, "exp") }, "expired"},
+		{"issued in the future", func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }, "not valid yet"},
+		{"no subject", func(c jwt.MapClaims) { c["sub"] = "" }, "subject"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.Claims("subject", "user@example.com")
+			claims["nonce"] = "nonce"
+			test.change(claims)
+
+			code, verifier := signIn(t, issuer, p, "nonce", claims)
+
+			tokens, err := p.Exchange(code, verifier)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.VerifyIdToken(tokens.IdToken, "nonce")
+
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected an error about %v, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIdTokenRejectsOtherKeys(t *testing.T) {
+	_, p := newIssuer(t)
+	other, _ := newIssuer(t)
+
+	claims := other.Claims("subject", "user@example.com")
+	claims["iss"] = p.Issuer
+	claims["nonce"] = "nonce"
+
+	raw, err := other.Sign(claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = p.VerifyIdToken(raw, "nonce"); err == nil {
+		t.Error("a token signed by another issuer was accepted")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	issuer, p := newIssuer(t)
+
+	code, _ := signIn(t, issuer, p, "nonce", issuer.Claims("subject", "user@example.com"))
+
+	other, err := oidc.RandomString()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = p.Exchange(code, other); err == nil {
+		t.Error("the code was exchanged with another verifier")
+	}
+}
+
+func TestExchangeCodeOnlyOnce(t *testing.T) {
+	issuer, p := newIssuer(t)
+
+	code, verifier := signIn(t, issuer, p, "nonce", issuer.Claims("subject", "user@example.com"))
+
+	if _, err := p.Exchange(code, verifier); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Exchange(code, verifier); err == nil {
+		t.Error("the code was exchanged twice")
+	}
+}
@@ -0,0 +1,77 @@
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// RangeSource returns the hash suffixes known for a 5 character SHA-1 prefix, the password itself never leaves the
+// process. It matches the range endpoint of the Pwned Passwords API so an online source can replace the bundled one.
+type RangeSource interface {
+	Range(prefix string) ([]string, error)
+}
+
+// BreachedSource is checked by IsBreached
+var BreachedSource RangeSource = NewBundledRangeSource()
+
+//go:embed data/breached.txt
+var bundledBreached []byte
+
+// BundledRangeSource is the offline list in data/breached.txt, one "PREFIX:SUFFIX" per line
+type BundledRangeSource struct {
+	once   sync.Once
+	ranges map[string][]string
+}
+
+func (b *BundledRangeSource) Range(prefix string) ([]string, error) {
+	b.once.Do(func() {
+		b.ranges = make(map[string][]string)
+
+		scanner := bufio.NewScanner(bytes.NewReader(bundledBreached))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			parts := strings.SplitN(line, ":", 2)
+
+			if len(parts) != 2 {
+				continue
+			}
+
+			b.ranges[parts[0]] = append(b.ranges[parts[0]], parts[1])
+		}
+	})
+
+	return b.ranges[strings.ToUpper(prefix)], nil
+}
+
+func NewBundledRangeSource() *BundledRangeSource {
+	return &BundledRangeSource{}
+}
+
+func IsBreached(password string) (bool, error) {
+	hash := strings.ToUpper(fmt.Sprintf("%x", sha1.Sum([]byte(password))))
+
+	suffixes, err := BreachedSource.Range(hash[:5])
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range suffixes {
+		// the api also returns a count after the suffix
+		if strings.ToUpper(strings.SplitN(suffix, ":", 2)[0]) == hash[5:] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,79 @@
+package passwords
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	MinLength = 8
+	// MaxLength bcrypt ignores everything after 72 bytes
+	MaxLength = 72
+	// MinScore is the lowest Strength score that is accepted, see Strength
+	MinScore = 2
+)
+
+var (
+	ErrTooShort         = errors.New("password must be at least 8 characters long")
+	ErrTooLong          = errors.New("password must be at most 72 characters long")
+	ErrTooWeak          = errors.New("password is too easy to guess")
+	ErrContainsIdentity = errors.New("password can't contain your username or email")
+	ErrBreached         = errors.New("password has appeared in a data breach, choose a different one")
+)
+
+// IsPolicyError reports whether err was returned because the password didn't meet the policy
+func IsPolicyError(err error) bool {
+	switch err {
+	case ErrTooShort, ErrTooLong, ErrTooWeak, ErrContainsIdentity, ErrBreached:
+		return true
+	}
+	return false
+}
+
+// Validate applies the policy to a password that is about to be set for the user with the given username and email
+func Validate(password, username, email string) error {
+	if len(password) < MinLength {
+		return ErrTooShort
+	}
+
+	if len(password) > MaxLength {
+		return ErrTooLong
+	}
+
+	lower := strings.ToLower(password)
+	localPart := strings.ToLower(strings.Split(email, "@")[0])
+
+	for _, s := range []string{strings.ToLower(username), localPart, strings.ToLower(email)} {
+		if len(s) >= 3 && strings.Contains(lower, s) {
+			return ErrContainsIdentity
+		}
+	}
+
+	if Strength(password, username, localPart) < MinScore {
+		return ErrTooWeak
+	}
+
+	breached, err := IsBreached(password)
+
+	if err != nil {
+		return err
+	}
+
+	if breached {
+		return ErrBreached
+	}
+
+	return nil
+}
+
+// Hash every password is stored through this
+func Hash(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hashedPassword), nil
+}
@@ -0,0 +1,336 @@
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Strength is a simplified version of the zxcvbn estimate. The password is covered by the sequence of patterns
+// (common words, keyboard walks, sequences, repeats, years and brute force) that needs the fewest guesses, the score
+// is the order of magnitude of those guesses:
+//
+//	0 < 10^3, 1 < 10^6, 2 < 10^8, 3 < 10^10, 4 otherwise
+//
+// userInputs are treated as the most common words, so passwords built around them score low.
+func Strength(password string, userInputs ...string) int {
+	g := guesses(password, userInputs)
+
+	switch {
+	case g < 3:
+		return 0
+	case g < 6:
+		return 1
+	case g < 8:
+		return 2
+	case g < 10:
+		return 3
+	}
+	return 4
+}
+
+const (
+	bruteforceCardinality = 10
+	// minGuessesBeforeGrowingSequence every extra pattern the password is made of costs at least this many guesses
+	minGuessesBeforeGrowingSequence = 10000
+	minSubmatchGuessesSingleChar    = 10
+	minSubmatchGuessesMultiChar     = 50
+	minYearSpace                    = 20
+)
+
+var keyboardRows = []string{
+	"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./",
+	"1qaz", "2wsx", "3edc", "4rfv", "5tgb", "6yhn", "7ujm", "8ik,", "9ol.", "0p;/",
+	"789456123", "147258369",
+}
+
+var l33t = map[rune]rune{'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '1': 'i', '!': 'i', '|': 'l',
+	'0': 'o', '$': 's', '5': 's', '7': 't', '+': 't', '2': 'z'}
+
+//go:embed data/common.txt
+var bundledCommon []byte
+
+var (
+	rankedOnce sync.Once
+	ranked     map[string]int
+)
+
+// rankedWords the position of a word in data/common.txt is its rank, lower means more common
+func rankedWords() map[string]int {
+	rankedOnce.Do(func() {
+		ranked = make(map[string]int)
+
+		scanner := bufio.NewScanner(bytes.NewReader(bundledCommon))
+		for scanner.Scan() {
+			word := strings.TrimSpace(scanner.Text())
+
+			if _, ok := ranked[word]; word != "" && !ok {
+				ranked[word] = len(ranked) + 1
+			}
+		}
+	})
+
+	return ranked
+}
+
+// guesses returns log10 of the guesses needed for the cheapest way to build the password out of matches
+func guesses(password string, userInputs []string) float64 {
+	runes := []rune(password)
+	n := len(runes)
+
+	if n == 0 {
+		return 0
+	}
+
+	// matches[j] holds every match that ends at rune j, as log10 guesses per start index
+	matches := make([]map[int]float64, n)
+	for j := range matches {
+		matches[j] = make(map[int]float64)
+	}
+
+	add := func(i, j int, logGuesses float64) {
+		min := math.Log10(minSubmatchGuessesSingleChar)
+		if j > i {
+			min = math.Log10(minSubmatchGuessesMultiChar)
+		}
+		logGuesses = math.Max(logGuesses, min)
+
+		if old, ok := matches[j][i]; !ok || logGuesses < old {
+			matches[j][i] = logGuesses
+		}
+	}
+
+	dictionaryMatches(runes, userInputs, add)
+	sequenceMatches(runes, add)
+	repeatMatches(runes, add)
+	keyboardMatches(runes, add)
+	yearMatches(runes, add)
+
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			add(i, j, float64(j-i+1)*math.Log10(bruteforceCardinality))
+		}
+	}
+
+	// best[k][e] is the lowest log10 product of guesses covering runes[:e] with k matches
+	best := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for e := range best[k] {
+			best[k][e] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+
+	for e := 1; e <= n; e++ {
+		for i, g := range matches[e-1] {
+			for k := 1; k <= n; k++ {
+				if prev := best[k-1][i]; !math.IsInf(prev, 1) && prev+g < best[k][e] {
+					best[k][e] = prev + g
+				}
+			}
+		}
+	}
+
+	// zxcvbn: guesses = k! * product + minGuessesBeforeGrowingSequence^(k-1)
+	result := math.Inf(1)
+	for k := 1; k <= n; k++ {
+		if math.IsInf(best[k][n], 1) {
+			continue
+		}
+
+		logFactorial, _ := math.Lgamma(float64(k + 1))
+		total := math.Log10(math.Pow(10, logFactorial/math.Ln10+best[k][n]) +
+			math.Pow(minGuessesBeforeGrowingSequence, float64(k-1)))
+
+		if total < result {
+			result = total
+		}
+	}
+
+	return result
+}
+
+func dictionaryMatches(runes []rune, userInputs []string, add func(i, j int, logGuesses float64)) {
+	words := rankedWords()
+	n := len(runes)
+
+	rankOf := func(word string) (int, bool) {
+		for _, input := range userInputs {
+			if len(input) >= 3 && strings.ToLower(input) == word {
+				return 1, true
+			}
+		}
+		rank, ok := words[word]
+		return rank, ok
+	}
+
+	for i := 0; i < n; i++ {
+		for j := i + 2; j < n; j++ {
+			token := runes[i : j+1]
+			lower := strings.ToLower(string(token))
+
+			unl33t := []rune(lower)
+			substituted := false
+			for x, r := range unl33t {
+				if s, ok := l33t[r]; ok {
+					unl33t[x] = s
+					substituted = true
+				}
+			}
+
+			variations := uppercaseVariations(token)
+
+			if rank, ok := rankOf(lower); ok {
+				add(i, j, math.Log10(float64(rank)*variations))
+			}
+
+			if substituted {
+				if rank, ok := rankOf(string(unl33t)); ok {
+					add(i, j, math.Log10(float64(rank)*variations*2))
+				}
+			}
+
+			if rank, ok := rankOf(reverse(lower)); ok {
+				add(i, j, math.Log10(float64(rank)*variations*2))
+			}
+		}
+	}
+}
+
+// uppercaseVariations all lower, all upper or only the first letter upper are tried first
+func uppercaseVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+
+	if upper == 0 {
+		return 1
+	}
+
+	if lower == 0 || (upper == 1 && unicode.IsUpper(token[0])) {
+		return 2
+	}
+
+	return math.Pow(2, math.Min(float64(upper), float64(lower)))
+}
+
+// sequenceMatches runs like "abc", "9876" or "aceg" with a constant step
+func sequenceMatches(runes []rune, add func(i, j int, logGuesses float64)) {
+	n := len(runes)
+
+	for i := 0; i < n-2; i++ {
+		delta := runes[i+1] - runes[i]
+
+		if delta == 0 || delta > 5 || delta < -5 {
+			continue
+		}
+
+		j := i + 1
+		for j+1 < n && runes[j+1]-runes[j] == delta {
+			j++
+		}
+
+		if j-i < 2 {
+			continue
+		}
+
+		first := unicode.ToLower(runes[i])
+		base := 26.0
+		switch {
+		case strings.ContainsRune("az19", first):
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		}
+
+		if delta < 0 {
+			base *= 2
+		}
+
+		add(i, j, math.Log10(base*float64(j-i+1)))
+	}
+}
+
+// repeatMatches the same character three or more times
+func repeatMatches(runes []rune, add func(i, j int, logGuesses float64)) {
+	n := len(runes)
+
+	for i := 0; i < n; {
+		j := i
+		for j+1 < n && runes[j+1] == runes[i] {
+			j++
+		}
+
+		if j-i >= 2 {
+			add(i, j, math.Log10(cardinality(runes[i])*float64(j-i+1)))
+		}
+
+		i = j + 1
+	}
+}
+
+// keyboardMatches walks of four or more keys along a row or a column of the keyboard or the keypad
+func keyboardMatches(runes []rune, add func(i, j int, logGuesses float64)) {
+	lower := []rune(strings.ToLower(string(runes)))
+	n := len(lower)
+
+	for _, row := range keyboardRows {
+		for i := 0; i < n; i++ {
+			for j := i + 3; j < n; j++ {
+				token := string(lower[i : j+1])
+
+				if strings.Contains(row, token) || strings.Contains(row, reverse(token)) {
+					add(i, j, math.Log10(40*float64(j-i+1)))
+				}
+			}
+		}
+	}
+}
+
+// yearMatches 19xx and 20xx
+func yearMatches(runes []rune, add func(i, j int, logGuesses float64)) {
+	for i := 0; i+3 < len(runes); i++ {
+		token := string(runes[i : i+4])
+
+		if (strings.HasPrefix(token, "19") || strings.HasPrefix(token, "20")) && isDigits(token) {
+			add(i, i+3, math.Log10(minYearSpace*2))
+		}
+	}
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLower(r), unicode.IsUpper(r):
+		return 26
+	}
+	return 33
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
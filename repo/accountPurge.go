@@ -0,0 +1,385 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"os"
+	"story-app-monolith/blobstore"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"time"
+)
+
+// StartAccountPurge purges the accounts whose grace period is over every interval, until the process exits
+func StartAccountPurge(interval time.Duration) {
+	go func() {
+		for {
+			err := PurgeDeletedAccounts()
+
+			if err != nil {
+				log.Println("account purge:", err)
+			}
+
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// PurgeDeletedAccounts removes every account whose grace period is over. The user document goes last, so an
+// account that failed halfway is picked up again by the next run and every step can run more than once.
+func PurgeDeletedAccounts() error {
+	conn := database.MongoConn
+
+	filter := bson.M{"pendingDeletion": true, "deletionScheduledAt": bson.M{"$lte": time.Now()}}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), filter, options.Find().SetProjection(bson.D{{"_id", 1}, {"username", 1},
+		{"profilePicture.keys", 1}, {"profileBackgroundPicture.keys", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	var users []domain.User
+
+	if err = cur.All(context.TODO(), &users); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		err = purgeAccount(&user)
+
+		if err != nil {
+			log.Printf("account purge: %v: %v", user.Id.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+func purgeAccount(user *domain.User) error {
+	steps := []func(*domain.User) error{
+		purgeStories,
+		anonymiseContent,
+		purgeReactions,
+		purgeFollows,
+		purgeUserLists,
+		purgeConversations,
+		purgeNotifications,
+		purgeOwnedRecords,
+		purgeDataExports,
+		purgeImages,
+	}
+
+	for _, step := range steps {
+		err := step(user)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	conn := database.MongoConn
+
+	_, err := conn.UserCollection.DeleteOne(context.TODO(), bson.D{{"_id", user.Id}, {"pendingDeletion", true}})
+
+	return err
+}
+
+// purgeStories deletes the user's stories with everything hanging off them, the stories go last
+func purgeStories(user *domain.User) error {
+	conn := database.MongoConn
+
+	storyIds, err := distinctIds(conn.StoryCollection, bson.D{{"authorUsername", user.Username}})
+
+	if err != nil || len(storyIds) == 0 {
+		return err
+	}
+
+	commentIds, err := distinctIds(conn.CommentsCollection, bson.M{"resourceId": bson.M{"$in": storyIds}})
+
+	if err != nil {
+		return err
+	}
+
+	replyIds, err := distinctIds(conn.RepliesCollection, bson.M{"resourceId": bson.M{"$in": commentIds}})
+
+	if err != nil {
+		return err
+	}
+
+	resources := append(append(append([]primitive.ObjectID{}, storyIds...), commentIds...), replyIds...)
+
+	deletes := []struct {
+		Collection *mongo.Collection
+		Filter     bson.M
+	}{
+		{conn.FlagCollection, bson.M{"flaggedResource": bson.M{"$in": resources}}},
+		{conn.ReadLaterCollection, bson.M{"story._id": bson.M{"$in": storyIds}}},
+		{conn.IdentityCollection, bson.M{"storyId": bson.M{"$in": storyIds}}},
+		{conn.RepliesCollection, bson.M{"_id": bson.M{"$in": replyIds}}},
+		{conn.CommentsCollection, bson.M{"_id": bson.M{"$in": commentIds}}},
+		{conn.StoryCollection, bson.M{"_id": bson.M{"$in": storyIds}}},
+	}
+
+	for _, d := range deletes {
+		_, err = d.Collection.DeleteMany(context.TODO(), d.Filter)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// anonymiseContent keeps the user's comments and replies on other stories so the threads stay readable, only the
+// author is replaced
+func anonymiseContent(user *domain.User) error {
+	conn := database.MongoConn
+
+	update := bson.D{{"$set", bson.D{{"authorUsername", domain.DeletedUsername}}}}
+
+	for _, collection := range []*mongo.Collection{conn.CommentsCollection, conn.RepliesCollection} {
+		_, err := collection.UpdateMany(context.TODO(), bson.D{{"authorUsername", user.Username}}, update)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeReactions the pull and the count change are one update per document, so a re-run can't count twice
+func purgeReactions(user *domain.User) error {
+	conn := database.MongoConn
+
+	for _, collection := range []*mongo.Collection{conn.StoryCollection, conn.CommentsCollection, conn.RepliesCollection} {
+		_, err := collection.UpdateMany(context.TODO(), bson.D{{"likes", user.Username}},
+			bson.M{"$pull": bson.M{"likes": user.Username}, "$inc": bson.M{"likeCount": -1}})
+
+		if err != nil {
+			return err
+		}
+
+		_, err = collection.UpdateMany(context.TODO(), bson.D{{"dislikes", user.Username}},
+			bson.M{"$pull": bson.M{"dislikes": user.Username}, "$inc": bson.M{"dislikeCount": -1}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeFollows removes the edges one at a time so the counts of the other users stay right
+func purgeFollows(user *domain.User) error {
+	conn := database.MongoConn
+
+	filter := bson.M{"$or": bson.A{bson.M{"followerId": user.Id}, bson.M{"followeeId": user.Id}}}
+
+	for {
+		err := withTransaction(func(ctx mongo.SessionContext) error {
+			var edge domain.Follow
+
+			err := conn.FollowCollection.FindOneAndDelete(ctx, filter).Decode(&edge)
+
+			if err != nil {
+				return err
+			}
+
+			if edge.Status == domain.FollowStatusAccepted {
+				return changeFollowCounts(ctx, edge.FollowerId, edge.FolloweeId, -1)
+			}
+
+			return nil
+		})
+
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// purgeUserLists takes the username out of the block lists of everyone else
+func purgeUserLists(user *domain.User) error {
+	conn := database.MongoConn
+
+	for _, field := range []string{"blockList", "blockByList"} {
+		_, err := conn.UserCollection.UpdateMany(context.TODO(), bson.D{{field, user.Username}},
+			bson.M{"$pull": bson.M{field: user.Username}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.MuteCollection.DeleteMany(context.TODO(), bson.D{{"kind", domain.MuteKindUser}, {"value", user.Username}})
+
+	return err
+}
+
+// purgeConversations deletes the user's copies, the other side keeps theirs with the username anonymised
+func purgeConversations(user *domain.User) error {
+	conn := database.MongoConn
+
+	_, err := conn.ConversationCollection.DeleteMany(context.TODO(), bson.D{{"owner", user.Username}})
+
+	if err != nil {
+		return err
+	}
+
+	for _, field := range []string{"from", "to"} {
+		_, err = conn.ConversationCollection.UpdateMany(context.TODO(), bson.D{{field, user.Username}},
+			bson.D{{"$set", bson.D{{field, domain.DeletedUsername}}}})
+
+		if err != nil {
+			return err
+		}
+
+		opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"m." + field: user.Username}}})
+
+		_, err = conn.ConversationCollection.UpdateMany(context.TODO(), bson.D{{"messages." + field, user.Username}},
+			bson.D{{"$set", bson.D{{"messages.$[m]." + field, domain.DeletedUsername}}}}, opts)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.MessageCollection.UpdateMany(context.TODO(), bson.D{{field, user.Username}},
+			bson.D{{"$set", bson.D{{field, domain.DeletedUsername}}}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func purgeNotifications(user *domain.User) error {
+	conn := database.MongoConn
+
+	_, err := conn.NotificationCollection.DeleteMany(context.TODO(), bson.D{{"for", user.Username}})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.NotificationCollection.UpdateMany(context.TODO(), bson.D{{"from", user.Username}},
+		bson.D{{"$set", bson.D{{"from", domain.DeletedUsername}}}})
+
+	return err
+}
+
+// purgeOwnedRecords deletes what only the user had a use for
+func purgeOwnedRecords(user *domain.User) error {
+	conn := database.MongoConn
+
+	deletes := []struct {
+		Collection *mongo.Collection
+		Filter     interface{}
+	}{
+		{conn.ReadLaterCollection, bson.D{{"username", user.Username}}},
+		{conn.IdentityCollection, bson.D{{"username", user.Username}}},
+		{conn.FlagCollection, bson.D{{"flaggerID", user.Id}}},
+		{conn.FlagCollection, bson.D{{"flaggedUsername", user.Username}}},
+		{conn.MuteCollection, bson.D{{"userId", user.Id}}},
+		{conn.SessionCollection, bson.D{{"userId", user.Id}}},
+		{conn.RefreshTokenCollection, bson.D{{"userId", user.Id}}},
+		{conn.RevokedTokenCollection, bson.D{{"userId", user.Id}}},
+		{conn.MagicLinkCollection, bson.D{{"userId", user.Id}}},
+		{conn.ApiKeyCollection, bson.D{{"userId", user.Id}}},
+		{conn.UsernameChangeCollection, bson.D{{"userId", user.Id}}},
+		{conn.LoginAttemptCollection, bson.M{"key": bson.M{"$in": bson.A{"user:" + user.Id.Hex(), "magic:user:" + user.Id.Hex()}}}},
+	}
+
+	for _, d := range deletes {
+		_, err := d.Collection.DeleteMany(context.TODO(), d.Filter)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeDataExports removes the archives before the jobs that point at them
+func purgeDataExports(user *domain.User) error {
+	conn := database.MongoConn
+
+	cur, err := conn.DataExportCollection.Find(context.TODO(), bson.D{{"userId", user.Id}})
+
+	if err != nil {
+		return err
+	}
+
+	var exports []domain.DataExport
+
+	if err = cur.All(context.TODO(), &exports); err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.File == "" {
+			continue
+		}
+
+		err = os.Remove(export.File)
+
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	_, err = conn.DataExportCollection.DeleteMany(context.TODO(), bson.D{{"userId", user.Id}})
+
+	return err
+}
+
+// purgeImages removes the uploaded pictures from the blob store
+func purgeImages(user *domain.User) error {
+	store, err := blobstore.Default()
+
+	if err != nil {
+		return err
+	}
+
+	for _, key := range append(append([]string{}, user.ProfilePicture.Keys...), user.ProfileBackgroundPicture.Keys...) {
+		err := store.Delete(key)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func distinctIds(collection *mongo.Collection, filter interface{}) ([]primitive.ObjectID, error) {
+	values, err := collection.Distinct(context.TODO(), "_id", filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(values))
+
+	for _, v := range values {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,10 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type AchievementRepo interface {
+	FindAll(userId primitive.ObjectID) (*[]domain.AchievementDto, error)
+}
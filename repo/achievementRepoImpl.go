@@ -0,0 +1,330 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	helper "story-app-monolith/helpers"
+	"time"
+)
+
+const (
+	// topStoryMinLikes a story needs at least this many likes to be the top story of the week
+	topStoryMinLikes = 10
+	// storyDateLayout is how the story handler formats createdDate
+	storyDateLayout = "January 2, 2006"
+	// topStoryAchievementId is awarded by StartTopStoryOfWeek
+	topStoryAchievementId = "top-story-of-the-week"
+)
+
+type AchievementRepoImpl struct {
+	AchievementList []domain.AchievementDto
+}
+
+func (a AchievementRepoImpl) FindAll(userId primitive.ObjectID) (*[]domain.AchievementDto, error) {
+	conn := database.MongoConn
+
+	var user domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", userId}},
+		options.FindOne().SetProjection(bson.D{{"achievements", 1}})).Decode(&user)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	a.AchievementList = make([]domain.AchievementDto, 0, len(domain.Achievements))
+
+	for _, achievement := range domain.Achievements {
+		a.AchievementList = append(a.AchievementList, domain.AchievementDto{Achievement: achievement,
+			Unlocked: helper.CurrentUserInteraction(user.Achievements, achievement.Id)})
+	}
+
+	return &a.AchievementList, nil
+}
+
+// RecordActivity evaluates the achievements the activity can unlock for the user in the background, it never holds
+// up or fails the request that caused it
+func RecordActivity(username string, activity string) {
+	go func() {
+		err := evaluateAchievements(username, activity)
+
+		if err != nil {
+			log.Printf("achievements %v %v: %v", username, activity, err)
+		}
+	}()
+}
+
+func evaluateAchievements(username string, activity string) error {
+	conn := database.MongoConn
+
+	var user domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}}).Decode(&user)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	return unlockQualified(&user, domain.TriggeredBy(activity))
+}
+
+// unlockQualified unlocks every one of the achievements the user reached the threshold of
+func unlockQualified(user *domain.User, achievements []domain.Achievement) error {
+	var err error
+
+	metrics := make(map[string]int)
+
+	for _, achievement := range achievements {
+		if helper.CurrentUserInteraction(user.Achievements, achievement.Id) {
+			continue
+		}
+
+		value, ok := metrics[achievement.Metric]
+
+		if !ok {
+			value, err = achievementMetric(user, achievement.Metric)
+
+			if err != nil {
+				return err
+			}
+
+			metrics[achievement.Metric] = value
+		}
+
+		if value < achievement.Threshold {
+			continue
+		}
+
+		err = unlockAchievement(user, &achievement)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func achievementMetric(user *domain.User, metric string) (int, error) {
+	conn := database.MongoConn
+
+	switch metric {
+	case domain.MetricStories:
+		count, err := conn.StoryCollection.CountDocuments(context.TODO(), bson.D{{"authorUsername", user.Username}})
+		return int(count), err
+	case domain.MetricLikesReceived:
+		stats, err := StoryRepoImpl{}.AuthorStats(user.Username)
+
+		if err != nil {
+			return 0, err
+		}
+
+		return stats.TotalLikes, nil
+	case domain.MetricFollowers:
+		return user.FollowerCount, nil
+	case domain.MetricWritingStreak:
+		return writingStreak(user.Username)
+	}
+
+	return 0, fmt.Errorf("unknown metric %v", metric)
+}
+
+// writingStreak counts the days in a row, up to today, the user published a story on
+func writingStreak(username string) (int, error) {
+	conn := database.MongoConn
+
+	since := time.Now().AddDate(0, 0, -60)
+
+	days, err := conn.StoryCollection.Distinct(context.TODO(), "createdDate", bson.M{"authorUsername": username, "createdAt": bson.M{"$gte": since}})
+
+	if err != nil {
+		return 0, err
+	}
+
+	published := make(map[string]bool, len(days))
+
+	for _, day := range days {
+		if s, ok := day.(string); ok {
+			published[s] = true
+		}
+	}
+
+	streak := 0
+
+	for day := time.Now(); published[day.Format(storyDateLayout)]; day = day.AddDate(0, 0, -1) {
+		streak++
+	}
+
+	return streak, nil
+}
+
+// StartTopStoryOfWeek awards the top story of the week every interval, until the process exits. It runs on startup
+// as well, the week is always the 7 days before the run.
+func StartTopStoryOfWeek(interval time.Duration) {
+	go func() {
+		for {
+			err := AwardTopStoryOfWeek()
+
+			if err != nil {
+				log.Println("top story of the week:", err)
+			}
+
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// AwardTopStoryOfWeek unlocks the achievement for the author of the most liked story of the last 7 days
+func AwardTopStoryOfWeek() error {
+	conn := database.MongoConn
+
+	var story domain.Story
+
+	filter := bson.M{"createdAt": bson.M{"$gte": time.Now().AddDate(0, 0, -7)}, "likeCount": bson.M{"$gte": topStoryMinLikes},
+		"authorUsername": bson.M{"$ne": domain.DeletedUsername}}
+	opts := options.FindOne().SetSort(bson.D{{"likeCount", -1}, {"createdAt", 1}}).SetProjection(bson.D{{"authorUsername", 1}})
+
+	err := conn.StoryCollection.FindOne(context.TODO(), filter, opts).Decode(&story)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	var user domain.User
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", story.AuthorUsername}},
+		options.FindOne().SetProjection(bson.D{{"username", 1}})).Decode(&user)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return err
+	}
+
+	for _, achievement := range domain.Achievements {
+		if achievement.Id == topStoryAchievementId {
+			return unlockAchievement(&user, &achievement)
+		}
+	}
+
+	return nil
+}
+
+// StartAchievementBackfill unlocks, in the background, the achievements users qualified for before they existed.
+// Every user is only checked once, users created since then have nothing to backfill.
+func StartAchievementBackfill() {
+	go func() {
+		err := BackfillAchievements()
+
+		if err != nil {
+			log.Println("achievement backfill:", err)
+		}
+	}()
+}
+
+// BackfillAchievements checks every achievement that is unlocked by an activity for the users that weren't
+// backfilled yet. A run that fails halfway is picked up again by the next one.
+func BackfillAchievements() error {
+	conn := database.MongoConn
+
+	achievements := make([]domain.Achievement, 0, len(domain.Achievements))
+
+	for _, achievement := range domain.Achievements {
+		if len(achievement.Activities) > 0 {
+			achievements = append(achievements, achievement)
+		}
+	}
+
+	filter := bson.D{{"achievementsBackfilled", bson.D{{"$ne", true}}}, {"username", bson.D{{"$ne", domain.DeletedUsername}}}}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), filter,
+		options.Find().SetProjection(bson.D{{"username", 1}, {"achievements", 1}, {"followerCount", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close(context.TODO())
+
+	for cur.Next(context.TODO()) {
+		var user domain.User
+
+		if err = cur.Decode(&user); err != nil {
+			return err
+		}
+
+		if err = unlockQualified(&user, achievements); err != nil {
+			return err
+		}
+
+		_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}},
+			bson.D{{"$set", bson.D{{"achievementsBackfilled", true}}}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
+
+// unlockAchievement only the update that adds the achievement sends the notification, so unlocking twice is harmless
+func unlockAchievement(user *domain.User, achievement *domain.Achievement) error {
+	conn := database.MongoConn
+
+	// older accounts can have null instead of empty lists, $addToSet only works on arrays
+	for _, field := range []string{"achievements", "unlockedBadgesUrls", "unlockedTagLine"} {
+		_, err := conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}, {field, nil}},
+			bson.D{{"$set", bson.D{{field, bson.A{}}}}})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	unlocked := bson.M{"achievements": achievement.Id}
+
+	if achievement.BadgeUrl != "" {
+		unlocked["unlockedBadgesUrls"] = achievement.BadgeUrl
+	}
+
+	if achievement.TagLine != "" {
+		unlocked["unlockedTagLine"] = achievement.TagLine
+	}
+
+	filter := bson.M{"_id": user.Id, "achievements": bson.M{"$ne": achievement.Id}}
+
+	res, err := conn.UserCollection.UpdateOne(context.TODO(), filter, bson.M{"$addToSet": unlocked})
+
+	if err != nil {
+		return err
+	}
+
+	if res.ModifiedCount == 0 {
+		return nil
+	}
+
+	return NotificationRepoImpl{}.Create(user.Username, "", achievement.UnlockMessage(), "/users/achievements")
+}
+
+func NewAchievementRepoImpl() AchievementRepoImpl {
+	var achievementRepoImpl AchievementRepoImpl
+
+	return achievementRepoImpl
+}
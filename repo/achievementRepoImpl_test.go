@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	helper "story-app-monolith/helpers"
+	"testing"
+	"time"
+)
+
+func insertTestStory(t *testing.T, author string, likes int) {
+	t.Helper()
+
+	_, err := database.MongoConn.StoryCollection.InsertOne(context.TODO(), domain.Story{Id: primitive.NewObjectID(),
+		Title: "title", Content: "content", AuthorUsername: author, LikeCount: likes, CreatedAt: time.Now(),
+		CreatedDate: time.Now().Format(storyDateLayout)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func findTestUser(t *testing.T, username string) domain.User {
+	t.Helper()
+
+	var user domain.User
+
+	err := database.MongoConn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}}).Decode(&user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestBackfillAchievements(t *testing.T) {
+	requireDB(t)
+
+	veteran := createTestUser(t, "veteran", "veteran@example.com", true)
+	createTestUser(t, "newcomer", "newcomer@example.com", true)
+
+	// an account from before achievements existed
+	_, err := database.MongoConn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", veteran.Id}},
+		bson.D{{"$unset", bson.D{{"achievementsBackfilled", ""}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insertTestStory(t, "veteran", 0)
+	insertTestStory(t, "newcomer", 0)
+
+	if err = BackfillAchievements(); err != nil {
+		t.Fatal(err)
+	}
+
+	user := findTestUser(t, "veteran")
+
+	if !helper.CurrentUserInteraction(user.Achievements, "first-story") || !user.AchievementsBackfilled {
+		t.Errorf("expected the existing story to be backfilled, got %v", user.Achievements)
+	}
+
+	if user := findTestUser(t, "newcomer"); len(user.Achievements) != 0 {
+		t.Errorf("expected users created since to be skipped, got %v", user.Achievements)
+	}
+}
+
+func TestAwardTopStoryOfWeek(t *testing.T) {
+	requireDB(t)
+
+	createTestUser(t, "popular", "popular@example.com", true)
+	createTestUser(t, "runnerup", "runnerup@example.com", true)
+
+	insertTestStory(t, "popular", topStoryMinLikes+5)
+	insertTestStory(t, "runnerup", topStoryMinLikes)
+
+	if err := AwardTopStoryOfWeek(); err != nil {
+		t.Fatal(err)
+	}
+
+	if user := findTestUser(t, "popular"); !helper.CurrentUserInteraction(user.Achievements, topStoryAchievementId) {
+		t.Errorf("expected the author of the most liked story to be awarded, got %v", user.Achievements)
+	}
+
+	if user := findTestUser(t, "runnerup"); helper.CurrentUserInteraction(user.Achievements, topStoryAchievementId) {
+		t.Errorf("expected only the top story to be awarded, got %v", user.Achievements)
+	}
+}
@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"strings"
+	"time"
+)
+
+// BootstrapAdmin makes the user named by ADMIN_USERNAME an admin as long as there is no admin yet, every admin after
+// the first one is appointed through the api. The account has to exist and be verified, so the username has to be
+// registered before the first start with it set.
+func BootstrapAdmin() error {
+	conn := database.MongoConn
+
+	username := strings.ToLower(config.Config("ADMIN_USERNAME"))
+
+	if username == "" {
+		return nil
+	}
+
+	count, err := conn.UserCollection.CountDocuments(context.TODO(), bson.D{{"role", domain.RoleAdmin}}, options.Count().SetLimit(1))
+
+	if err != nil || count > 0 {
+		return err
+	}
+
+	var user domain.User
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}},
+		options.FindOne().SetProjection(bson.D{{"isVerified", 1}, {"permissions", 1}})).Decode(&user)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			log.Printf("ADMIN_USERNAME %v isn't registered yet, register it and restart to make it an admin", username)
+			return nil
+		}
+		return err
+	}
+
+	if !user.IsVerified {
+		return fmt.Errorf("ADMIN_USERNAME %v has to verify its email before it can become an admin", username)
+	}
+
+	// accounts from before roles existed have no permissions list
+	if user.Permissions == nil {
+		user.Permissions = []string{}
+	}
+
+	err = UserRepoImpl{}.UpdateRole(username, &domain.UpdateRole{Role: domain.RoleAdmin, Permissions: user.Permissions,
+		UpdatedAt: time.Now()})
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%v is now an admin", username)
+
+	return nil
+}
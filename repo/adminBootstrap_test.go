@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"os"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"testing"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	requireDB(t)
+
+	_ = os.Setenv("ADMIN_USERNAME", "Owner")
+	defer os.Unsetenv("ADMIN_USERNAME")
+
+	if err := BootstrapAdmin(); err != nil {
+		t.Fatalf("expected an unregistered admin username to be skipped, got %v", err)
+	}
+
+	createTestUser(t, "owner", "owner@example.com", false)
+
+	if err := BootstrapAdmin(); err == nil {
+		t.Fatal("expected an unverified account to be refused")
+	}
+
+	_, err := database.MongoConn.UserCollection.UpdateOne(context.TODO(), bson.D{{"username", "owner"}},
+		bson.D{{"$set", bson.D{{"isVerified", true}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := BootstrapAdmin(); err != nil {
+		t.Fatal(err)
+	}
+
+	if user := findTestUser(t, "owner"); user.Role != domain.RoleAdmin {
+		t.Fatalf("expected owner to be an admin, got %v", user.Role)
+	}
+
+	// once there is an admin the variable no longer promotes anyone
+	createTestUser(t, "squatter", "squatter@example.com", true)
+	_ = os.Setenv("ADMIN_USERNAME", "squatter")
+
+	if err := BootstrapAdmin(); err != nil {
+		t.Fatal(err)
+	}
+
+	if user := findTestUser(t, "squatter"); user.Role == domain.RoleAdmin {
+		t.Fatal("expected only the first admin to be bootstrapped")
+	}
+}
@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type ApiKeyRepo interface {
+	Create(userId primitive.ObjectID, username string, apiKey *domain.CreateApiKey) (*domain.CreatedApiKey, error)
+	FindAllByUserId(userId primitive.ObjectID) (*[]domain.ApiKey, error)
+	FindByKey(key string) (*domain.ApiKey, error)
+	Used(id primitive.ObjectID, ip string) error
+	Revoke(id primitive.ObjectID, userId primitive.ObjectID) error
+}
@@ -0,0 +1,147 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"strings"
+	"time"
+)
+
+const (
+	// apiKeyPrefix makes keys easy to spot, e.g. by secret scanners
+	apiKeyPrefix  = "sk_"
+	maxApiKeys    = 10
+	apiKeyShownAs = 8
+)
+
+type ApiKeyRepoImpl struct {
+	ApiKey     domain.ApiKey
+	ApiKeyList []domain.ApiKey
+}
+
+// Create returns the key in plain text, it can't be recovered afterwards
+func (a ApiKeyRepoImpl) Create(userId primitive.ObjectID, username string, apiKey *domain.CreateApiKey) (*domain.CreatedApiKey, error) {
+	conn := database.MongoConn
+
+	count, err := conn.ApiKeyCollection.CountDocuments(context.TODO(), bson.M{"userId": userId, "revoked": false})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if count >= maxApiKeys {
+		return nil, fmt.Errorf("you can't have more than %v api keys, revoke one first", maxApiKeys)
+	}
+
+	random, err := generateRefreshToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := apiKeyPrefix + random
+
+	a.ApiKey.Id = primitive.NewObjectID()
+	a.ApiKey.UserId = userId
+	a.ApiKey.Username = username
+	a.ApiKey.Name = strings.TrimSpace(apiKey.Name)
+	a.ApiKey.Prefix = key[:len(apiKeyPrefix)+apiKeyShownAs]
+	a.ApiKey.KeyHash = hashRefreshToken(key)
+	a.ApiKey.Scopes = apiKey.Scopes
+	a.ApiKey.CreatedAt = time.Now()
+
+	_, err = conn.ApiKeyCollection.InsertOne(context.TODO(), &a.ApiKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &domain.CreatedApiKey{ApiKey: &a.ApiKey, Key: key}, nil
+}
+
+func (a ApiKeyRepoImpl) FindAllByUserId(userId primitive.ObjectID) (*[]domain.ApiKey, error) {
+	conn := database.MongoConn
+
+	findOptions := options.Find().SetSort(bson.D{{"createdAt", -1}})
+
+	cur, err := conn.ApiKeyCollection.Find(context.TODO(), bson.M{"userId": userId, "revoked": false}, findOptions)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	a.ApiKeyList = make([]domain.ApiKey, 0)
+	if err = cur.All(context.TODO(), &a.ApiKeyList); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &a.ApiKeyList, nil
+}
+
+// FindByKey returns the key if it exists and wasn't revoked
+func (a ApiKeyRepoImpl) FindByKey(key string) (*domain.ApiKey, error) {
+	conn := database.MongoConn
+
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, fmt.Errorf("invalid api key")
+	}
+
+	err := conn.ApiKeyCollection.FindOne(context.TODO(), bson.D{{"keyHash", hashRefreshToken(key)}, {"revoked", false}, {"suspended", bson.D{{"$ne", true}}}}).Decode(&a.ApiKey)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("invalid api key")
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &a.ApiKey, nil
+}
+
+// Used records when and from where the key was last used, at most once every lastSeenPrecision
+func (a ApiKeyRepoImpl) Used(id primitive.ObjectID, ip string) error {
+	conn := database.MongoConn
+
+	filter := bson.M{"_id": id, "lastUsedAt": bson.M{"$lt": time.Now().Add(-lastSeenPrecision)}}
+	update := bson.D{{"$set", bson.D{{"lastUsedAt", time.Now()}, {"lastUsedIp", ip}}}}
+
+	_, err := conn.ApiKeyCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (a ApiKeyRepoImpl) Revoke(id primitive.ObjectID, userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"_id", id}, {"userId", userId}, {"revoked", false}}
+	update := bson.D{{"$set", bson.D{{"revoked", true}}}}
+
+	res, err := conn.ApiKeyCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("api key not found")
+	}
+
+	return nil
+}
+
+func NewApiKeyRepoImpl() ApiKeyRepoImpl {
+	var apiKeyRepoImpl ApiKeyRepoImpl
+
+	return apiKeyRepoImpl
+}
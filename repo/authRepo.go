@@ -1,9 +1,21 @@
 package repo
 
-import "story-app-monolith/domain"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
 
 type AuthRepo interface {
-	Login(username string, password string) (*domain.UserDto, string, error)
+	Login(username string, password string, ip string, userAgent string) (*domain.LoginResult, error)
+	RefreshToken(token string, ip string) (*domain.LoginResult, error)
+	RequestMagicLink(email string, nonce string, ip string) error
+	MagicLinkLogin(token string, nonce string, ip string, userAgent string) (*domain.LoginResult, error)
+	Reactivate(token string, ip string, userAgent string) (*domain.LoginResult, error)
+	Logout(jti string, sessionId string, userId primitive.ObjectID, expiresAt int64, refreshToken string) error
+	LogoutAll(userId primitive.ObjectID) error
+	GetSessions(userId primitive.ObjectID, currentSessionId string) (*[]domain.Session, error)
+	TerminateSession(id primitive.ObjectID, userId primitive.ObjectID) error
+	Unlock(token string) error
 	ResetPassword(token, password string) error
 	ResetPasswordQuery(email string) error
 	VerifyCode(code string) error
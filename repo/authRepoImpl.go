@@ -5,35 +5,56 @@ import (
 	"fmt"
 	"github.com/gofiber/fiber/v2/utils"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 	"story-app-monolith/config"
 	"story-app-monolith/database"
 	"story-app-monolith/domain"
+	"story-app-monolith/keyring"
+	"story-app-monolith/mailer"
 	"story-app-monolith/util"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	maxFreeIpLoginAttempts   = 20
+	maxFreeUserLoginAttempts = 3
+	maxFailedLogins          = 10
+	accountLockout           = 30 * time.Minute
+	maxFreeIpMagicLinks      = 10
+	maxFreeUserMagicLinks    = 3
+)
+
 type AuthRepoImpl struct {
 	*domain.User
 }
 
-func(a AuthRepoImpl) Login(username string, password string) (*domain.UserDto, string, error) {
-	var login domain.Authentication
+func(a AuthRepoImpl) Login(username string, password string, ip string, userAgent string) (*domain.LoginResult, error) {
 	var user domain.User
 
 	conn := database.MongoConn
 
+	attempts := LoginAttemptRepoImpl{}
+	ipKey := "ip:" + ip
+
+	err := attempts.Check(ipKey)
+
+	if err != nil {
+		return nil, err
+	}
+
 	if util.IsEmail(username) {
 		opts := options.FindOne()
 		err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"email",
 			username}},opts).Decode(&user)
 
 		if err != nil {
-			return nil, "", fmt.Errorf("error finding by email")
+			_, _ = attempts.RecordFailure(ipKey, maxFreeIpLoginAttempts)
+			return nil, fmt.Errorf("error finding by email")
 		}
 	} else {
 		opts := options.FindOne()
@@ -41,25 +62,276 @@ func(a AuthRepoImpl) Login(username string, password string) (*domain.UserDto, s
 			username}},opts).Decode(&user)
 
 		if err != nil {
-			return nil, "", fmt.Errorf("error finding by username")
+			_, _ = attempts.RecordFailure(ipKey, maxFreeIpLoginAttempts)
+			return nil, fmt.Errorf("error finding by username")
+		}
+	}
+
+	// the lock clears itself once the cooldown has passed
+	if user.IsLocked && user.LockedUntil > time.Now().Unix() {
+		return nil, domain.ErrAccountLocked
+	}
+
+	userKey := "user:" + user.Id.Hex()
+
+	err = attempts.Check(userKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+
+	if err != nil {
+		_, _ = attempts.RecordFailure(ipKey, maxFreeIpLoginAttempts)
+
+		failures, err := attempts.RecordFailure(userKey, maxFreeUserLoginAttempts)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if failures >= maxFailedLogins {
+			err = lockAccount(&user)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, domain.ErrAccountLocked
 		}
+
+		return nil, fmt.Errorf("error comparing password")
+	}
+
+	// only told once the password was right
+	if user.PendingDeletion {
+		return nil, domain.ErrAccountPendingDeletion
+	}
+
+	return completeLogin(&user, ip, userAgent)
+}
+
+// RequestMagicLink emails a login link when the address belongs to a user that opted in. Nothing tells the caller
+// whether that was the case.
+func(a AuthRepoImpl) RequestMagicLink(email string, nonce string, ip string) error {
+	var user domain.User
+
+	conn := database.MongoConn
+
+	attempts := LoginAttemptRepoImpl{}
+	ipKey := "magic:ip:" + ip
+
+	err := attempts.Check(ipKey)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = attempts.RecordFailure(ipKey, maxFreeIpMagicLinks)
+
+	if err != nil {
+		return err
+	}
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"email", email}}).Decode(&user)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	if !user.MagicLinkEnabled || user.PendingDeletion || (user.IsLocked && user.LockedUntil > time.Now().Unix()) {
+		return nil
+	}
+
+	// every link is counted so a mailbox can't be flooded
+	userKey := "magic:user:" + user.Id.Hex()
+
+	err = attempts.Check(userKey)
+
+	if err != nil {
+		return nil
+	}
+
+	_, err = attempts.RecordFailure(userKey, maxFreeUserMagicLinks)
+
+	if err != nil {
+		return err
+	}
+
+	token, err := MagicLinkRepoImpl{}.Create(user.Id, nonce)
+
+	if err != nil {
+		return err
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	return mailer.SendMagicLinkEmail(user.Email, user.Username, token)
+}
+
+// MagicLinkLogin exchanges a magic link for the same tokens Login issues
+func(a AuthRepoImpl) MagicLinkLogin(token string, nonce string, ip string, userAgent string) (*domain.LoginResult, error) {
+	var user domain.User
+
+	conn := database.MongoConn
+
+	link, err := MagicLinkRepoImpl{}.Consume(token, nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", link.UserId}}).Decode(&user)
+
+	if err != nil {
+		return nil, fmt.Errorf("error finding user")
+	}
+
+	if !user.MagicLinkEnabled {
+		return nil, fmt.Errorf("magic link login is turned off")
+	}
+
+	if user.IsLocked && user.LockedUntil > time.Now().Unix() {
+		return nil, domain.ErrAccountLocked
+	}
+
+	if user.PendingDeletion {
+		return nil, domain.ErrAccountPendingDeletion
+	}
+
+	return completeLogin(&user, ip, userAgent)
+}
+
+func(a AuthRepoImpl) RefreshToken(token string, ip string) (*domain.LoginResult, error) {
+	var login domain.Authentication
+	var user domain.User
+
+	conn := database.MongoConn
+
+	refreshToken, newRefreshToken, err := RefreshTokenRepoImpl{}.Rotate(token)
 
 	if err != nil {
-		return nil, "", fmt.Errorf("error comparing password")
+		return nil, err
 	}
 
-	token, err := login.GenerateJWT(user)
+	// the refresh token family is the session
+	err = SessionRepoImpl{}.Refresh(refreshToken.Family, ip)
 
 	if err != nil {
-		return nil, "", fmt.Errorf("error generating token")
+		return nil, err
 	}
 
-	userDto := domain.UserMapper(&user)
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", refreshToken.UserId}}).Decode(&user)
 
-	return userDto, token, nil
+	if err != nil {
+		return nil, fmt.Errorf("error finding user")
+	}
+
+	login.SessionId = refreshToken.Family.Hex()
+
+	accessToken, err := login.GenerateJWT(user)
+
+	if err != nil {
+		return nil, fmt.Errorf("error generating token")
+	}
+
+	return &domain.LoginResult{User: domain.UserMapper(&user), AccessToken: accessToken, RefreshToken: newRefreshToken}, nil
+}
+
+func(a AuthRepoImpl) Logout(jti string, sessionId string, userId primitive.ObjectID, expiresAt int64, refreshToken string) error {
+	err := RevocationRepoImpl{}.Revoke(jti, userId, time.Unix(expiresAt, 0))
+
+	if err != nil {
+		return err
+	}
+
+	if sid, err := primitive.ObjectIDFromHex(sessionId); err == nil {
+		err = SessionRepoImpl{}.Terminate(sid, userId)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if refreshToken != "" {
+		err = RefreshTokenRepoImpl{}.RevokeFamilyByToken(refreshToken)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func(a AuthRepoImpl) LogoutAll(userId primitive.ObjectID) error {
+	err := RevocationRepoImpl{}.RevokeAllByUserId(userId)
+
+	if err != nil {
+		return err
+	}
+
+	// also revokes every refresh token of the user
+	err = SessionRepoImpl{}.TerminateAllByUserId(userId)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func(a AuthRepoImpl) GetSessions(userId primitive.ObjectID, currentSessionId string) (*[]domain.Session, error) {
+	sessions, err := SessionRepoImpl{}.FindAllByUserId(userId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].Id.Hex() == currentSessionId
+	}
+
+	return sessions, nil
+}
+
+func(a AuthRepoImpl) TerminateSession(id primitive.ObjectID, userId primitive.ObjectID) error {
+	return SessionRepoImpl{}.Terminate(id, userId)
+}
+
+// Unlock clears a lock with the token from the account locked email
+func(a AuthRepoImpl) Unlock(token string) error {
+	conn := database.MongoConn
+
+	user := new(domain.User)
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"unlockToken", token}}).Decode(user)
+
+	if err != nil || token == "" {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments || token == "" {
+			return fmt.Errorf("no token found")
+		}
+		return err
+	}
+
+	if user.UnlockTokenExpiresAt < time.Now().Unix() {
+		return fmt.Errorf("token has expired")
+	}
+
+	filter := bson.D{{"_id", user.Id}}
+	update := bson.D{{"$set", bson.D{{"isLocked", false}, {"lockedUntil", 0}, {"unlockToken", ""},
+		{"unlockTokenExpiresAt", 0}, {"updatedAt", time.Now()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return LoginAttemptRepoImpl{}.Reset("user:" + user.Id.Hex())
 }
 
 func(a AuthRepoImpl) ResetPasswordQuery(email string) error {
@@ -80,7 +352,7 @@ func(a AuthRepoImpl) ResetPasswordQuery(email string) error {
 	if user.TokenHash == "" || user.TokenExpiresAt < time.Now().Unix() {
 		a := new(domain.Authentication)
 		h := utils.UUIDv4()
-		s, err := a.SignToken([]byte(h))
+		s, err := a.SignTokenFor(keyring.Reset, []byte(h))
 
 		if err != nil {
 			return err
@@ -100,9 +372,11 @@ func(a AuthRepoImpl) ResetPasswordQuery(email string) error {
 	}
 
 	// send token url in email to user
-	fmt.Println("http://127.0.0.1:8080/auth/reset/" + user.TokenHash)
+	err = mailer.SendPasswordResetEmail(user.Email, user.Username, user.TokenHash)
 
-	fmt.Println(user.TokenHash)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -133,6 +407,19 @@ func(a AuthRepoImpl) ResetPassword(token, password string) error {
 		return err
 	}
 
+	// a password change signs the user out everywhere
+	err = a.LogoutAll(user.Id)
+
+	if err != nil {
+		return err
+	}
+
+	err = mailer.SendSecurityAlertEmail(user.Email, user.Username, "Your password was just changed and you were signed out of every device.")
+
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -170,6 +457,181 @@ func (a AuthRepoImpl) VerifyCode(code string) error{
 	return nil
 }
 
+// lockAccount locks the account for accountLockout and emails the owner a link to unlock it early
+func lockAccount(user *domain.User) error {
+	conn := database.MongoConn
+
+	a := new(domain.Authentication)
+	h := utils.UUIDv4()
+	signedHash, err := a.SignTokenFor(keyring.Reset, []byte(h))
+
+	if err != nil {
+		return err
+	}
+
+	token := h + "-" + string(signedHash)
+
+	filter := bson.D{{"_id", user.Id}}
+	update := bson.D{{"$set", bson.D{{"isLocked", true}, {"lockedUntil", time.Now().Add(accountLockout).Unix()},
+		{"unlockToken", token}, {"unlockTokenExpiresAt", time.Now().Add(accountLockout).Unix()}, {"updatedAt", time.Now()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	// the lock itself is the backoff from here on
+	err = LoginAttemptRepoImpl{}.Reset("user:" + user.Id.Hex())
+
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendAccountLockedEmail(user.Email, user.Username, token)
+}
+
+// recordSuccessfulLogin clears the failed attempts and any expired lock and records the login ip, every ip a user
+// signed in from is kept on their sessions. It only runs once every factor was accepted, a right password alone
+// doesn't wipe the failures of someone guessing the second factor.
+func recordSuccessfulLogin(id primitive.ObjectID, ip string) error {
+	conn := database.MongoConn
+
+	err := LoginAttemptRepoImpl{}.Reset("user:" + id.Hex())
+
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{"_id", id}}
+	update := bson.M{"$set": bson.M{"lastLoginIp": ip, "isLocked": false, "lockedUntil": 0, "lastActiveAt": time.Now()}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+// completeLogin runs once the first factor was accepted, users with 2FA get an mfa token instead of a session
+func completeLogin(user *domain.User, ip string, userAgent string) (*domain.LoginResult, error) {
+	// a deactivated user is offered to reactivate first, nothing is issued until they confirm
+	if user.Deactivated {
+		return offerReactivation(user)
+	}
+
+	// the first factor was right but the user still has to prove they have their second factor
+	if user.MfaEnabled {
+		return mfaChallenge(user, false)
+	}
+
+	err := recordSuccessfulLogin(user.Id, ip)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokens(user, ip, userAgent)
+}
+
+// mfaChallenge the mfa token a user with 2FA exchanges for a session in MfaRepoImpl.Verify
+func mfaChallenge(user *domain.User, reactivate bool) (*domain.LoginResult, error) {
+	var login domain.Authentication
+
+	mfaToken, err := login.GenerateMfaToken(*user, reactivate)
+
+	if err != nil {
+		return nil, fmt.Errorf("error generating token")
+	}
+
+	return &domain.LoginResult{User: domain.UserMapper(user), MfaToken: mfaToken}, nil
+}
+
+func offerReactivation(user *domain.User) (*domain.LoginResult, error) {
+	conn := database.MongoConn
+
+	token, err := signedToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	update := bson.D{{"$set", bson.D{{"reactivationToken", token},
+		{"reactivationTokenExpiresAt", time.Now().Add(domain.ReactivationTokenExpiration).Unix()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}}, update)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &domain.LoginResult{User: domain.UserMapper(user), ReactivationToken: token}, nil
+}
+
+// Reactivate brings a deactivated account and its content back with the token its login returned, then carries on
+// with the login. Users with 2FA only get an mfa token that carries the reactivation, their account stays
+// deactivated until MfaRepoImpl.Verify accepted their code.
+func(a AuthRepoImpl) Reactivate(token string, ip string, userAgent string) (*domain.LoginResult, error) {
+	var user domain.User
+
+	conn := database.MongoConn
+
+	filter := bson.M{"reactivationToken": token, "deactivated": true, "reactivationTokenExpiresAt": bson.M{"$gt": time.Now().Unix()}}
+
+	err := conn.UserCollection.FindOne(context.TODO(), filter).Decode(&user)
+
+	if err != nil || token == "" {
+		return nil, fmt.Errorf("no token found")
+	}
+
+	if user.MfaEnabled {
+		return mfaChallenge(&user, true)
+	}
+
+	err = withTransaction(func(ctx mongo.SessionContext) error {
+		return setDeactivated(ctx, &user, false)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	user.Deactivated = false
+
+	return completeLogin(&user, ip, userAgent)
+}
+
+// issueTokens starts a new session for a fully authenticated user, the session id is also the refresh token family
+func issueTokens(user *domain.User, ip string, userAgent string) (*domain.LoginResult, error) {
+	var login domain.Authentication
+
+	sessionId := primitive.NewObjectID()
+
+	err := SessionRepoImpl{}.Create(sessionId, user.Id, ip, userAgent)
+
+	if err != nil {
+		return nil, err
+	}
+
+	login.SessionId = sessionId.Hex()
+
+	token, err := login.GenerateJWT(*user)
+
+	if err != nil {
+		return nil, fmt.Errorf("error generating token")
+	}
+
+	refreshToken, err := RefreshTokenRepoImpl{}.Create(user.Id, user.Username, sessionId)
+
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token")
+	}
+
+	return &domain.LoginResult{User: domain.UserMapper(user), AccessToken: token, RefreshToken: refreshToken}, nil
+}
+
 func NewAuthRepoImpl() AuthRepoImpl {
 	var authRepoImpl AuthRepoImpl
 
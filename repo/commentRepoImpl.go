@@ -44,6 +44,8 @@ func (c CommentRepoImpl) Create(comment *domain.Comment) error {
 		return err
 	}
 
+	NotifyMentions(comment.AuthorUsername, comment.Content, "/stories/"+story.Id.Hex())
+
 	return nil
 }
 
@@ -51,7 +53,7 @@ func (c CommentRepoImpl) FindAllCommentsByResourceId(resourceID primitive.Object
 	conn := database.MongoConn
 
 
-	cur, err := conn.CommentsCollection.Find(context.TODO(), bson.D{{"resourceId", resourceID}})
+	cur, err := conn.CommentsCollection.Find(context.TODO(), bson.M{"resourceId": resourceID, "authorDeactivated": bson.M{"$ne": true}})
 
 	if err != nil {
 		// ErrNoDocuments means that the filter did not match any documents in the collection
@@ -72,9 +74,20 @@ func (c CommentRepoImpl) FindAllCommentsByResourceId(resourceID primitive.Object
 		return nil, fmt.Errorf("error processing data")
 	}
 
+	mutes, err := MuteRepoImpl{}.Filter(username)
+
+	if err != nil {
+		return nil, err
+	}
+
 	comments := make([]domain.CommentDto, 0, len(c.CommentDtoList))
 	var wg sync.WaitGroup
 	for _, v := range c.CommentDtoList {
+		// muted comments are left out together with their replies
+		if mutes.Hides(v.AuthorUsername, v.Content) {
+			continue
+		}
+
 		wg.Add(2)
 
 		go func() {
@@ -93,11 +106,18 @@ func (c CommentRepoImpl) FindAllCommentsByResourceId(resourceID primitive.Object
 
 			replies, err := ReplyRepoImpl{}.FindAllRepliesByResourceId(v.Id, username)
 
-			v.Replies = replies
-
 			if err != nil {
 				panic(fmt.Errorf("error fetching data..."))
 			}
+
+			shown := make([]domain.Reply, 0, len(*replies))
+			for _, reply := range *replies {
+				if !mutes.Hides(reply.AuthorUsername, reply.Content) {
+					shown = append(shown, reply)
+				}
+			}
+
+			v.Replies = &shown
 			return
 		}()
 
@@ -200,6 +220,8 @@ func (c CommentRepoImpl) LikeCommentById(commentId primitive.ObjectID, username
 		return fmt.Errorf("failed to like comment")
 	}
 
+	RefreshReputation(c.Comment.AuthorUsername)
+
 	return nil
 }
 
@@ -276,6 +298,8 @@ func (c CommentRepoImpl) DisLikeCommentById(commentId primitive.ObjectID, userna
 		return fmt.Errorf("failed to dislike comment")
 	}
 
+	RefreshReputation(c.Comment.AuthorUsername)
+
 	return nil
 }
 
@@ -295,7 +319,12 @@ func (c CommentRepoImpl) UpdateFlagCount(flag *domain.Flag) error {
 	}
 
 	if !cur.Next(context.TODO()) {
-		flag.Id = primitive.NewObjectID()
+		err = newFlag(flag, conn.CommentsCollection)
+
+		if err != nil {
+			return err
+		}
+
 		_, err = conn.FlagCollection.InsertOne(context.TODO(), &flag)
 
 		return nil
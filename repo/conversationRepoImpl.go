@@ -51,6 +51,11 @@ func (c ConversationRepoImpl) Create(message domain.Message) error {
 		}
 	}
 
+	// messaging is paused while the account is deactivated
+	if c.User.Deactivated {
+		return fmt.Errorf("user is not receiving messages")
+	}
+
 	c.Conversation.Id = primitive.NewObjectID()
 	c.Conversation.CreatedAt = time.Now()
 	c.Conversation.Owner = message.From
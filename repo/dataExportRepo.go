@@ -0,0 +1,12 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type DataExportRepo interface {
+	Request(userId primitive.ObjectID) (*domain.DataExport, error)
+	FindById(id primitive.ObjectID, userId primitive.ObjectID) (*domain.DataExport, error)
+	Download(id primitive.ObjectID, expires string, sig string) (file string, username string, err error)
+}
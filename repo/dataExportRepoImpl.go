@@ -0,0 +1,483 @@
+package repo
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/keyring"
+	"story-app-monolith/mailer"
+	"strconv"
+	"time"
+)
+
+const (
+	// dataExportInterval a user gets the same export back when asking again within this time
+	dataExportInterval = time.Hour
+	// dataExportUnfinished is how long a job that never finished, e.g. because of a restart, is kept
+	dataExportUnfinished = 24 * time.Hour
+)
+
+type DataExportRepoImpl struct {
+	DataExport domain.DataExport
+}
+
+// exportSection is one JSON file of the archive
+type exportSection struct {
+	File        string
+	Title       string
+	Description string
+	Collection  *mongo.Collection
+	Filter      interface{}
+	Projection  bson.D
+	Count       int
+}
+
+// Request starts building an export in the background, the job can be polled with FindById
+func (d DataExportRepoImpl) Request(userId primitive.ObjectID) (*domain.DataExport, error) {
+	conn := database.MongoConn
+
+	filter := bson.M{"userId": userId, "status": bson.M{"$ne": domain.DataExportFailed}, "createdAt": bson.M{"$gt": time.Now().Add(-dataExportInterval)}}
+
+	err := conn.DataExportCollection.FindOne(context.TODO(), filter, options.FindOne().SetSort(bson.D{{"createdAt", -1}})).Decode(&d.DataExport)
+
+	if err == nil {
+		return d.withDownloadUrl(&d.DataExport)
+	}
+
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	d.DataExport.Id = primitive.NewObjectID()
+	d.DataExport.UserId = userId
+	d.DataExport.Status = domain.DataExportPending
+	d.DataExport.CreatedAt = time.Now()
+	d.DataExport.ExpiresAt = time.Now().Add(dataExportUnfinished)
+
+	_, err = conn.DataExportCollection.InsertOne(context.TODO(), &d.DataExport)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	job := d.DataExport
+
+	go func() {
+		err := buildDataExport(&job)
+
+		if err != nil {
+			log.Println(fmt.Sprintf("data export %v failed: %v", job.Id.Hex(), err))
+
+			_, err = conn.DataExportCollection.UpdateOne(context.TODO(), bson.D{{"_id", job.Id}},
+				bson.D{{"$set", bson.D{{"status", domain.DataExportFailed}, {"completedAt", time.Now()}}}})
+
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
+	return &d.DataExport, nil
+}
+
+func (d DataExportRepoImpl) FindById(id primitive.ObjectID, userId primitive.ObjectID) (*domain.DataExport, error) {
+	conn := database.MongoConn
+
+	err := conn.DataExportCollection.FindOne(context.TODO(), bson.D{{"_id", id}, {"userId", userId}}).Decode(&d.DataExport)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("export not found")
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return d.withDownloadUrl(&d.DataExport)
+}
+
+// Download checks the signed link and returns the archive's path
+func (d DataExportRepoImpl) Download(id primitive.ObjectID, expires string, sig string) (string, string, error) {
+	conn := database.MongoConn
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+
+	if err != nil || time.Now().Unix() > expiresAt {
+		return "", "", fmt.Errorf("download link has expired")
+	}
+
+	k, err := keyring.For(keyring.DataExport)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	valid, err := k.Verify(downloadMessage(id, expiresAt), []byte(sig))
+
+	if err != nil || !valid {
+		return "", "", fmt.Errorf("invalid download link")
+	}
+
+	err = conn.DataExportCollection.FindOne(context.TODO(), bson.D{{"_id", id}, {"status", domain.DataExportReady}}).Decode(&d.DataExport)
+
+	if err != nil || time.Now().After(d.DataExport.ExpiresAt) {
+		return "", "", fmt.Errorf("download link has expired")
+	}
+
+	var user domain.User
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", d.DataExport.UserId}}).Decode(&user)
+
+	if err != nil {
+		return "", "", fmt.Errorf("error processing data")
+	}
+
+	return d.DataExport.File, user.Username, nil
+}
+
+func (d DataExportRepoImpl) withDownloadUrl(export *domain.DataExport) (*domain.DataExport, error) {
+	if export.Status != domain.DataExportReady {
+		return export, nil
+	}
+
+	link, err := downloadUrl(export)
+
+	if err != nil {
+		return nil, err
+	}
+
+	export.DownloadUrl = link
+
+	return export, nil
+}
+
+// downloadUrl the link is signed over the export's id and when the export expires
+func downloadUrl(export *domain.DataExport) (string, error) {
+	k, err := keyring.For(keyring.DataExport)
+
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := k.Sign(downloadMessage(export.Id, export.ExpiresAt.Unix()))
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v/users/export/%v/download?expires=%v&sig=%s", config.Config("APP_URL"), export.Id.Hex(), export.ExpiresAt.Unix(), sig), nil
+}
+
+func downloadMessage(id primitive.ObjectID, expiresAt int64) []byte {
+	return []byte(fmt.Sprintf("%v.%v", id.Hex(), expiresAt))
+}
+
+// dataExportDir is DATA_EXPORT_DIR or a directory in the temp dir
+func dataExportDir() (string, error) {
+	dir := config.Config("DATA_EXPORT_DIR")
+
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "data-exports")
+	}
+
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// removeExpiredExports deletes archives whose download links can't be used anymore
+func removeExpiredExports(dir string, lifetime time.Duration) {
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+
+		if err == nil && !entry.IsDir() && time.Since(info.ModTime()) > lifetime {
+			_ = os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func buildDataExport(job *domain.DataExport) error {
+	conn := database.MongoConn
+
+	_, err := conn.DataExportCollection.UpdateOne(context.TODO(), bson.D{{"_id", job.Id}}, bson.D{{"$set", bson.D{{"status", domain.DataExportRunning}}}})
+
+	if err != nil {
+		return err
+	}
+
+	expiration, err := strconv.Atoi(config.Config("DATA_EXPORT_EXPIRATION"))
+
+	if err != nil {
+		return err
+	}
+
+	lifetime := time.Duration(expiration) * time.Minute
+
+	var user domain.User
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", job.UserId}}).Decode(&user)
+
+	if err != nil {
+		return err
+	}
+
+	dir, err := dataExportDir()
+
+	if err != nil {
+		return err
+	}
+
+	removeExpiredExports(dir, lifetime)
+
+	sections := exportSections(&user)
+
+	file := filepath.Join(dir, job.Id.Hex()+".zip")
+	tmp := file + ".tmp"
+
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(out)
+
+	for i := range sections {
+		sections[i].Count, err = writeExportSection(archive, &sections[i])
+
+		if err != nil {
+			_ = out.Close()
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+
+	err = writeExportIndex(archive, &user, sections)
+
+	if err == nil {
+		err = archive.Close()
+	}
+
+	closeErr := out.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	info, err := os.Stat(file)
+
+	if err != nil {
+		return err
+	}
+
+	job.Status = domain.DataExportReady
+	job.File = file
+	job.Size = info.Size()
+	job.CompletedAt = time.Now()
+	job.ExpiresAt = time.Now().Add(lifetime)
+
+	_, err = conn.DataExportCollection.UpdateOne(context.TODO(), bson.D{{"_id", job.Id}}, bson.D{{"$set", bson.D{
+		{"status", job.Status}, {"file", job.File}, {"size", job.Size}, {"completedAt", job.CompletedAt}, {"expiresAt", job.ExpiresAt}}}})
+
+	if err != nil {
+		return err
+	}
+
+	link, err := downloadUrl(job)
+
+	if err != nil {
+		return err
+	}
+
+	return mailer.SendDataExportEmail(user.Email, user.Username, link)
+}
+
+// exportSections lists everything stored about the user. Secrets, e.g. password and token hashes, are left out.
+func exportSections(user *domain.User) []exportSection {
+	conn := database.MongoConn
+
+	username := user.Username
+	liked := bson.D{{"_id", 1}, {"title", 1}, {"content", 1}, {"authorUsername", 1}, {"resourceId", 1}}
+
+	return []exportSection{
+		{File: "profile.json", Title: "Profile", Description: "Your account and settings",
+			Collection: conn.UserCollection, Filter: bson.D{{"_id", user.Id}},
+			Projection: bson.D{{"password", 0}, {"tokenHash", 0}, {"verificationCode", 0}, {"mfaSecret", 0},
+				{"mfaPendingSecret", 0}, {"mfaRecoveryCodes", 0}, {"mfaPendingRecoveryCodes", 0}, {"unlockToken", 0},
+				{"emailChangeToken", 0}, {"emailChangeCancelToken", 0}, {"deletionRestoreToken", 0},
+				{"reactivationToken", 0}}},
+		{File: "stories.json", Title: "Stories", Description: "Stories you wrote",
+			Collection: conn.StoryCollection, Filter: bson.D{{"authorUsername", username}},
+			Projection: bson.D{{"likes", 0}, {"dislikes", 0}}},
+		{File: "comments.json", Title: "Comments", Description: "Comments you wrote",
+			Collection: conn.CommentsCollection, Filter: bson.D{{"authorUsername", username}},
+			Projection: bson.D{{"likes", 0}, {"dislikes", 0}}},
+		{File: "replies.json", Title: "Replies", Description: "Replies you wrote",
+			Collection: conn.RepliesCollection, Filter: bson.D{{"authorUsername", username}},
+			Projection: bson.D{{"likes", 0}, {"dislikes", 0}}},
+		{File: "read-later.json", Title: "Read later", Description: "Stories you saved to read later",
+			Collection: conn.ReadLaterCollection, Filter: bson.D{{"username", username}}},
+		{File: "likes/stories.json", Title: "Liked stories", Description: "Stories you liked",
+			Collection: conn.StoryCollection, Filter: bson.D{{"likes", username}}, Projection: liked},
+		{File: "dislikes/stories.json", Title: "Disliked stories", Description: "Stories you disliked",
+			Collection: conn.StoryCollection, Filter: bson.D{{"dislikes", username}}, Projection: liked},
+		{File: "likes/comments.json", Title: "Liked comments", Description: "Comments you liked",
+			Collection: conn.CommentsCollection, Filter: bson.D{{"likes", username}}, Projection: liked},
+		{File: "dislikes/comments.json", Title: "Disliked comments", Description: "Comments you disliked",
+			Collection: conn.CommentsCollection, Filter: bson.D{{"dislikes", username}}, Projection: liked},
+		{File: "likes/replies.json", Title: "Liked replies", Description: "Replies you liked",
+			Collection: conn.RepliesCollection, Filter: bson.D{{"likes", username}}, Projection: liked},
+		{File: "dislikes/replies.json", Title: "Disliked replies", Description: "Replies you disliked",
+			Collection: conn.RepliesCollection, Filter: bson.D{{"dislikes", username}}, Projection: liked},
+		{File: "flags.json", Title: "Flags", Description: "Content and users you reported",
+			Collection: conn.FlagCollection, Filter: bson.D{{"flaggerID", user.Id}}},
+		{File: "conversations.json", Title: "Conversations", Description: "Your conversations and their messages",
+			Collection: conn.ConversationCollection, Filter: bson.D{{"owner", username}}},
+		{File: "messages.json", Title: "Messages", Description: "Messages you sent or received",
+			Collection: conn.MessageCollection, Filter: bson.M{"$or": bson.A{bson.M{"from": username}, bson.M{"to": username}}}},
+		{File: "notifications.json", Title: "Notifications", Description: "Notifications sent to you",
+			Collection: conn.NotificationCollection, Filter: bson.D{{"for", username}}},
+		{File: "follows.json", Title: "Follows", Description: "Who you follow, who follows you and follow requests",
+			Collection: conn.FollowCollection, Filter: bson.M{"$or": bson.A{bson.M{"followerId": user.Id}, bson.M{"followeeId": user.Id}}}},
+		{File: "mutes.json", Title: "Mutes", Description: "Users, tags and keywords you muted",
+			Collection: conn.MuteCollection, Filter: bson.D{{"userId", user.Id}}},
+		{File: "sessions.json", Title: "Sessions", Description: "Devices you signed in from",
+			Collection: conn.SessionCollection, Filter: bson.D{{"userId", user.Id}}},
+		{File: "api-keys.json", Title: "Api keys", Description: "Your api keys, without the keys themselves",
+			Collection: conn.ApiKeyCollection, Filter: bson.D{{"userId", user.Id}}, Projection: bson.D{{"keyHash", 0}}},
+	}
+}
+
+// writeExportSection writes the documents as a JSON array and returns how many there were
+func writeExportSection(archive *zip.Writer, section *exportSection) (int, error) {
+	findOptions := options.Find().SetSort(bson.D{{"_id", 1}})
+
+	if len(section.Projection) > 0 {
+		findOptions.SetProjection(section.Projection)
+	}
+
+	cur, err := section.Collection.Find(context.TODO(), section.Filter, findOptions)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer cur.Close(context.TODO())
+
+	w, err := archive.Create(section.File)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = w.Write([]byte("[\n"))
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for cur.Next(context.TODO()) {
+		// relaxed extended JSON keeps ObjectIds and dates readable
+		doc, err := bson.MarshalExtJSON(cur.Current, false, false)
+
+		if err != nil {
+			return 0, err
+		}
+
+		var indented bytes.Buffer
+
+		err = json.Indent(&indented, doc, "  ", "  ")
+
+		if err != nil {
+			return 0, err
+		}
+
+		separator := "  "
+		if count > 0 {
+			separator = ",\n  "
+		}
+
+		_, err = w.Write(append([]byte(separator), indented.Bytes()...))
+
+		if err != nil {
+			return 0, err
+		}
+
+		count++
+	}
+
+	if err = cur.Err(); err != nil {
+		return 0, err
+	}
+
+	_, err = w.Write([]byte("\n]\n"))
+
+	return count, err
+}
+
+var exportIndexTemplate = htmltemplate.Must(htmltemplate.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Account data of {{.Username}}</title>
+</head>
+<body>
+<h1>Account data of {{.Username}}</h1>
+<p>Exported on {{.ExportedAt}}. Every file in this archive is JSON, the table below says what each one holds.</p>
+<table>
+<thead><tr><th>File</th><th>Contents</th><th>Entries</th></tr></thead>
+<tbody>
+{{range .Sections}}<tr><td><a href="{{.File}}">{{.File}}</a></td><td>{{.Title}}: {{.Description}}</td><td>{{.Count}}</td></tr>
+{{end}}</tbody>
+</table>
+</body>
+</html>
+`))
+
+func writeExportIndex(archive *zip.Writer, user *domain.User, sections []exportSection) error {
+	w, err := archive.Create("index.html")
+
+	if err != nil {
+		return err
+	}
+
+	return exportIndexTemplate.Execute(w, struct {
+		Username   string
+		ExportedAt string
+		Sections   []exportSection
+	}{user.Username, time.Now().UTC().Format(time.RFC1123), sections})
+}
+
+func NewDataExportRepoImpl() DataExportRepoImpl {
+	var dataExportRepoImpl DataExportRepoImpl
+
+	return dataExportRepoImpl
+}
@@ -0,0 +1,11 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type FlagRepo interface {
+	FindAll(status string, page string) (*domain.FlagList, error)
+	Review(id primitive.ObjectID, reviewerId primitive.ObjectID, review *domain.ReviewFlag) error
+}
@@ -0,0 +1,124 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"strconv"
+	"time"
+)
+
+const flagsPerPage = 20
+
+type FlagRepoImpl struct {
+	flagList domain.FlagList
+}
+
+// FindAll lists the flags with the given status, oldest first so the queue is worked through in order
+func (f FlagRepoImpl) FindAll(status string, page string) (*domain.FlagList, error) {
+	conn := database.MongoConn
+
+	pageNumber, err := strconv.Atoi(page)
+
+	if err != nil || pageNumber < 1 {
+		return nil, fmt.Errorf("page must be a number")
+	}
+
+	filter := bson.D{{"status", status}}
+
+	// flags from before the review queue have no status and are still waiting
+	if status == domain.FlagStatusPending {
+		filter = bson.D{{"status", bson.D{{"$in", bson.A{domain.FlagStatusPending, nil}}}}}
+	}
+
+	count, err := conn.FlagCollection.CountDocuments(context.TODO(), filter)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	opts := options.Find().SetSort(bson.D{{"createdAt", 1}}).
+		SetSkip(int64(pageNumber-1) * flagsPerPage).SetLimit(flagsPerPage)
+
+	cur, err := conn.FlagCollection.Find(context.TODO(), filter, opts)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	f.flagList.Flags = make([]domain.FlagDto, 0)
+
+	if err = cur.All(context.TODO(), &f.flagList.Flags); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	f.flagList.NumberOfFlags = count
+	f.flagList.CurrentPage = pageNumber
+	f.flagList.NumberOfPages = int(math.Ceil(float64(count) / flagsPerPage))
+
+	return &f.flagList, nil
+}
+
+// Review upholds or dismisses a flag, the flagged user's reputation follows the decision
+func (f FlagRepoImpl) Review(id primitive.ObjectID, reviewerId primitive.ObjectID, review *domain.ReviewFlag) error {
+	conn := database.MongoConn
+
+	if review.Status != domain.FlagStatusUpheld && review.Status != domain.FlagStatusDismissed {
+		return domain.ErrInvalidFlagStatus
+	}
+
+	var flag domain.Flag
+
+	update := bson.D{{"$set", bson.D{{"status", review.Status}, {"reviewedBy", reviewerId}, {"reviewedAt", time.Now()}}}}
+
+	err := conn.FlagCollection.FindOneAndUpdate(context.TODO(), bson.D{{"_id", id}}, update).Decode(&flag)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return domain.ErrFlagNotFound
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	RefreshReputation(flag.FlaggedUsername)
+
+	return nil
+}
+
+// newFlag fills in what a flag starts with, content flags are held against the author of the content
+func newFlag(flag *domain.Flag, content *mongo.Collection) error {
+	flag.Id = primitive.NewObjectID()
+	flag.Status = domain.FlagStatusPending
+	flag.CreatedAt = time.Now()
+
+	if content == nil {
+		return nil
+	}
+
+	var author struct {
+		AuthorUsername string `bson:"authorUsername"`
+	}
+
+	err := content.FindOne(context.TODO(), bson.D{{"_id", flag.FlaggedResource}},
+		options.FindOne().SetProjection(bson.D{{"authorUsername", 1}})).Decode(&author)
+
+	if err != nil {
+		return err
+	}
+
+	flag.FlaggedUsername = author.AuthorUsername
+
+	return nil
+}
+
+func NewFlagRepoImpl() FlagRepoImpl {
+	var flagRepoImpl FlagRepoImpl
+
+	return flagRepoImpl
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"time"
+)
+
+// followMigrationBatch how many edges or counts are written per bulk write
+const followMigrationBatch = 500
+
+// MigrateFollowArrays turns the followers and following arrays users had before the follow graph into accepted edges,
+// recomputes every follower and following count from the edges and only then removes the arrays. Every step can be
+// repeated, so a migration that was interrupted is finished on the next start. Without any arrays left it does nothing.
+func MigrateFollowArrays() error {
+	conn := database.MongoConn
+
+	legacy := bson.D{{"$or", bson.A{
+		bson.D{{"followers", bson.D{{"$exists", true}}}},
+		bson.D{{"following", bson.D{{"$exists", true}}}},
+	}}}
+
+	count, err := conn.UserCollection.CountDocuments(context.TODO(), legacy)
+
+	if err != nil || count == 0 {
+		return err
+	}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), legacy,
+		options.Find().SetProjection(bson.D{{"username", 1}, {"followers", 1}, {"following", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close(context.TODO())
+
+	models := make([]mongo.WriteModel, 0, followMigrationBatch)
+
+	for cur.Next(context.TODO()) {
+		var user struct {
+			Id        primitive.ObjectID `bson:"_id"`
+			Username  string             `bson:"username"`
+			Followers []string           `bson:"followers"`
+			Following []string           `bson:"following"`
+		}
+
+		if err = cur.Decode(&user); err != nil {
+			return err
+		}
+
+		ids, err := userIds(append(append([]string{}, user.Followers...), user.Following...))
+
+		if err != nil {
+			return err
+		}
+
+		// usernames of purged accounts don't resolve and are dropped
+		for _, username := range user.Followers {
+			if id, ok := ids[username]; ok {
+				models = append(models, followEdgeModel(id, username, user.Id, user.Username))
+			}
+		}
+
+		for _, username := range user.Following {
+			if id, ok := ids[username]; ok {
+				models = append(models, followEdgeModel(user.Id, user.Username, id, username))
+			}
+		}
+
+		if len(models) >= followMigrationBatch {
+			if err = bulkWrite(conn.FollowCollection, models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	if err = bulkWrite(conn.FollowCollection, models); err != nil {
+		return err
+	}
+
+	if err = RecomputeFollowCounts(); err != nil {
+		return err
+	}
+
+	_, err = conn.UserCollection.UpdateMany(context.TODO(), legacy, bson.D{{"$unset", bson.D{{"followers", ""}, {"following", ""}}}})
+
+	return err
+}
+
+// followEdgeModel upserts an accepted edge, an edge that is already there is left as it is
+func followEdgeModel(followerId primitive.ObjectID, followerUsername string, followeeId primitive.ObjectID, followeeUsername string) mongo.WriteModel {
+	now := time.Now()
+
+	edge := domain.Follow{
+		Id:               primitive.NewObjectID(),
+		FollowerId:       followerId,
+		FollowerUsername: followerUsername,
+		FolloweeId:       followeeId,
+		FolloweeUsername: followeeUsername,
+		Status:           domain.FollowStatusAccepted,
+		CreatedAt:        now,
+		AcceptedAt:       now,
+	}
+
+	return mongo.NewUpdateOneModel().SetUpsert(true).
+		SetFilter(bson.D{{"followerId", followerId}, {"followeeId", followeeId}}).
+		SetUpdate(bson.D{{"$setOnInsert", edge}})
+}
+
+// RecomputeFollowCounts sets the follower and following count of every user to their accepted edges
+func RecomputeFollowCounts() error {
+	conn := database.MongoConn
+
+	followers, err := countEdges("$followeeId")
+
+	if err != nil {
+		return err
+	}
+
+	following, err := countEdges("$followerId")
+
+	if err != nil {
+		return err
+	}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), bson.D{}, options.Find().SetProjection(bson.D{{"_id", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close(context.TODO())
+
+	models := make([]mongo.WriteModel, 0, followMigrationBatch)
+
+	for cur.Next(context.TODO()) {
+		var user struct {
+			Id primitive.ObjectID `bson:"_id"`
+		}
+
+		if err = cur.Decode(&user); err != nil {
+			return err
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.D{{"_id", user.Id}}).
+			SetUpdate(bson.D{{"$set", bson.D{{"followerCount", followers[user.Id]}, {"followingCount", following[user.Id]}}}}))
+
+		if len(models) == followMigrationBatch {
+			if err = bulkWrite(conn.UserCollection, models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	return bulkWrite(conn.UserCollection, models)
+}
+
+// countEdges counts the accepted edges per user on one end of the edge
+func countEdges(end string) (map[primitive.ObjectID]int, error) {
+	conn := database.MongoConn
+
+	cur, err := conn.FollowCollection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{"$match", bson.D{{"status", domain.FollowStatusAccepted}}}},
+		{{"$group", bson.D{{"_id", end}, {"count", bson.D{{"$sum", 1}}}}}},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		Id    primitive.ObjectID `bson:"_id"`
+		Count int                `bson:"count"`
+	}
+
+	if err = cur.All(context.TODO(), &results); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[primitive.ObjectID]int, len(results))
+
+	for _, r := range results {
+		counts[r.Id] = r.Count
+	}
+
+	return counts, nil
+}
+
+func userIds(usernames []string) (map[string]primitive.ObjectID, error) {
+	conn := database.MongoConn
+
+	ids := make(map[string]primitive.ObjectID)
+
+	if len(usernames) == 0 {
+		return ids, nil
+	}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), bson.D{{"username", bson.D{{"$in", usernames}}}},
+		options.Find().SetProjection(bson.D{{"username", 1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var users []struct {
+		Id       primitive.ObjectID `bson:"_id"`
+		Username string             `bson:"username"`
+	}
+
+	if err = cur.All(context.TODO(), &users); err != nil {
+		return nil, err
+	}
+
+	for _, u := range users {
+		ids[u.Username] = u.Id
+	}
+
+	return ids, nil
+}
+
+func bulkWrite(collection *mongo.Collection, models []mongo.WriteModel) error {
+	if len(models) == 0 {
+		return nil
+	}
+
+	_, err := collection.BulkWrite(context.TODO(), models, options.BulkWrite().SetOrdered(false))
+
+	return err
+}
@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"testing"
+)
+
+func TestMigrateFollowArrays(t *testing.T) {
+	requireDB(t)
+
+	conn := database.MongoConn
+
+	ids := map[string]primitive.ObjectID{"ann": primitive.NewObjectID(), "bob": primitive.NewObjectID(), "cat": primitive.NewObjectID()}
+
+	// both sides of ann following bob are in the arrays, "gone" was purged, the counts are stale
+	users := []interface{}{
+		bson.M{"_id": ids["ann"], "username": "ann", "following": bson.A{"bob", "gone"}, "followers": bson.A{}, "followerCount": 7, "followingCount": 2},
+		bson.M{"_id": ids["bob"], "username": "bob", "following": bson.A{}, "followers": bson.A{"ann", "cat"}, "followerCount": 2, "followingCount": 0},
+		bson.M{"_id": ids["cat"], "username": "cat", "followerCount": 0, "followingCount": 0},
+	}
+
+	if _, err := conn.UserCollection.InsertMany(context.TODO(), users); err != nil {
+		t.Fatal(err)
+	}
+
+	// running it twice is the same as running it once
+	for i := 0; i < 2; i++ {
+		if err := MigrateFollowArrays(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, edge := range [][2]string{{"ann", "bob"}, {"cat", "bob"}} {
+		status, err := FollowRepoImpl{}.Status(edge[0], edge[1])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status != domain.FollowStatusAccepted {
+			t.Errorf("expected %v to follow %v, got %q", edge[0], edge[1], status)
+		}
+	}
+
+	if count, _ := conn.FollowCollection.CountDocuments(context.TODO(), bson.D{}); count != 2 {
+		t.Errorf("expected 2 edges, got %v", count)
+	}
+
+	expected := map[string][2]int{"ann": {0, 1}, "bob": {2, 0}, "cat": {0, 1}}
+
+	for username, counts := range expected {
+		var user bson.M
+
+		if err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}}).Decode(&user); err != nil {
+			t.Fatal(err)
+		}
+
+		if user["followerCount"] != int32(counts[0]) || user["followingCount"] != int32(counts[1]) {
+			t.Errorf("%v: expected counts %v, got %v and %v", username, counts, user["followerCount"], user["followingCount"])
+		}
+
+		if _, ok := user["followers"]; ok {
+			t.Errorf("%v still has the followers array", username)
+		}
+
+		if _, ok := user["following"]; ok {
+			t.Errorf("%v still has the following array", username)
+		}
+	}
+
+	// a follow from before the migration can be undone
+	if err := (FollowRepoImpl{}).Unfollow(ids["ann"], "bob"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type FollowRepo interface {
+	Follow(followerId primitive.ObjectID, username string) (status string, err error)
+	Unfollow(followerId primitive.ObjectID, username string) error
+	FindFollowers(username string, currentUsername string, page string) (*domain.FollowList, error)
+	FindFollowing(username string, currentUsername string, page string) (*domain.FollowList, error)
+	FindRequests(userId primitive.ObjectID, page string) (*domain.FollowList, error)
+	AcceptRequest(userId primitive.ObjectID, username string) error
+	DeclineRequest(userId primitive.ObjectID, username string) error
+	Status(followerUsername string, followeeUsername string) (string, error)
+	RemoveEdges(userId primitive.ObjectID, otherUserId primitive.ObjectID) error
+}
@@ -0,0 +1,414 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	helper "story-app-monolith/helpers"
+	"strconv"
+	"time"
+)
+
+const followsPerPage = 20
+
+type FollowRepoImpl struct {
+	Edge  domain.Follow
+	Edges []domain.Follow
+}
+
+// Follow follows a public account right away, following a private account sends a request the owner has to accept
+func (f FollowRepoImpl) Follow(followerId primitive.ObjectID, username string) (string, error) {
+	conn := database.MongoConn
+
+	var follower domain.User
+	var followee domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", followerId}}).Decode(&follower)
+
+	if err != nil {
+		return "", fmt.Errorf("error processing data")
+	}
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.M{"username": username, "pendingDeletion": bson.M{"$ne": true}, "deactivated": bson.M{"$ne": true}}).Decode(&followee)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return "", domain.ErrUserNotFound
+		}
+		return "", fmt.Errorf("error processing data")
+	}
+
+	if follower.Id == followee.Id {
+		return "", fmt.Errorf("you can't follow yourself")
+	}
+
+	if helper.CurrentUserInteraction(followee.BlockList, follower.Username) || helper.CurrentUserInteraction(followee.BlockByList, follower.Username) {
+		return "", domain.ErrUserNotFound
+	}
+
+	f.Edge.Id = primitive.NewObjectID()
+	f.Edge.FollowerId = follower.Id
+	f.Edge.FollowerUsername = follower.Username
+	f.Edge.FolloweeId = followee.Id
+	f.Edge.FolloweeUsername = followee.Username
+	f.Edge.Status = domain.FollowStatusAccepted
+	f.Edge.CreatedAt = time.Now()
+	f.Edge.AcceptedAt = time.Now()
+
+	// anyone who isn't let in by the profile audience has to ask
+	if followee.Privacy.Profile != domain.AudienceEveryone {
+		f.Edge.Status = domain.FollowStatusPending
+		f.Edge.AcceptedAt = time.Time{}
+	}
+
+	err = withTransaction(func(ctx mongo.SessionContext) error {
+		// the unique index on followerId and followeeId is what detects duplicates
+		_, err := conn.FollowCollection.InsertOne(ctx, &f.Edge)
+
+		if err != nil {
+			return err
+		}
+
+		if f.Edge.Status == domain.FollowStatusAccepted {
+			return changeFollowCounts(ctx, f.Edge.FollowerId, f.Edge.FolloweeId, 1)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			if status, _ := f.Status(follower.Username, followee.Username); status == domain.FollowStatusPending {
+				return "", fmt.Errorf("you already asked to follow this user")
+			}
+			return "", fmt.Errorf("you are already following this user")
+		}
+		return "", fmt.Errorf("error processing data")
+	}
+
+	if f.Edge.Status == domain.FollowStatusAccepted {
+		RecordActivity(followee.Username, domain.ActivityFollowed)
+	}
+
+	return f.Edge.Status, nil
+}
+
+// Unfollow also withdraws a pending request
+func (f FollowRepoImpl) Unfollow(followerId primitive.ObjectID, username string) error {
+	conn := database.MongoConn
+
+	err := withTransaction(func(ctx mongo.SessionContext) error {
+		err := conn.FollowCollection.FindOneAndDelete(ctx, bson.D{{"followerId", followerId}, {"followeeUsername", username}}).Decode(&f.Edge)
+
+		if err != nil {
+			return err
+		}
+
+		if f.Edge.Status == domain.FollowStatusAccepted {
+			return changeFollowCounts(ctx, f.Edge.FollowerId, f.Edge.FolloweeId, -1)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("you are not following this user")
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (f FollowRepoImpl) FindFollowers(username string, currentUsername string, page string) (*domain.FollowList, error) {
+	owner, err := f.viewableUser(username, currentUsername)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.findPage(bson.D{{"followeeId", owner.Id}, {"status", domain.FollowStatusAccepted}}, "followerUsername", page)
+}
+
+func (f FollowRepoImpl) FindFollowing(username string, currentUsername string, page string) (*domain.FollowList, error) {
+	owner, err := f.viewableUser(username, currentUsername)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return f.findPage(bson.D{{"followerId", owner.Id}, {"status", domain.FollowStatusAccepted}}, "followeeUsername", page)
+}
+
+// FindRequests lists the pending follow requests to the user
+func (f FollowRepoImpl) FindRequests(userId primitive.ObjectID, page string) (*domain.FollowList, error) {
+	return f.findPage(bson.D{{"followeeId", userId}, {"status", domain.FollowStatusPending}}, "followerUsername", page)
+}
+
+func (f FollowRepoImpl) AcceptRequest(userId primitive.ObjectID, username string) error {
+	conn := database.MongoConn
+
+	err := withTransaction(func(ctx mongo.SessionContext) error {
+		filter := bson.D{{"followeeId", userId}, {"followerUsername", username}, {"status", domain.FollowStatusPending}}
+		update := bson.D{{"$set", bson.D{{"status", domain.FollowStatusAccepted}, {"acceptedAt", time.Now()}}}}
+
+		err := conn.FollowCollection.FindOneAndUpdate(ctx, filter, update).Decode(&f.Edge)
+
+		if err != nil {
+			return err
+		}
+
+		return changeFollowCounts(ctx, f.Edge.FollowerId, f.Edge.FolloweeId, 1)
+	})
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("follow request not found")
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	RecordActivity(f.Edge.FolloweeUsername, domain.ActivityFollowed)
+
+	return nil
+}
+
+func (f FollowRepoImpl) DeclineRequest(userId primitive.ObjectID, username string) error {
+	conn := database.MongoConn
+
+	res, err := conn.FollowCollection.DeleteOne(context.TODO(), bson.D{{"followeeId", userId}, {"followerUsername", username}, {"status", domain.FollowStatusPending}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("follow request not found")
+	}
+
+	return nil
+}
+
+// Status is empty when there is no edge from the follower to the followee
+func (f FollowRepoImpl) Status(followerUsername string, followeeUsername string) (string, error) {
+	conn := database.MongoConn
+
+	err := conn.FollowCollection.FindOne(context.TODO(), bson.D{{"followerUsername", followerUsername}, {"followeeUsername", followeeUsername}}).Decode(&f.Edge)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return "", nil
+		}
+		return "", fmt.Errorf("error processing data")
+	}
+
+	return f.Edge.Status, nil
+}
+
+// RemoveEdges drops the edges and requests between two users in both directions, blocking someone calls this
+func (f FollowRepoImpl) RemoveEdges(userId primitive.ObjectID, otherUserId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	return withTransaction(func(ctx mongo.SessionContext) error {
+		for _, ids := range [][2]primitive.ObjectID{{userId, otherUserId}, {otherUserId, userId}} {
+			var edge domain.Follow
+
+			err := conn.FollowCollection.FindOneAndDelete(ctx, bson.D{{"followerId", ids[0]}, {"followeeId", ids[1]}}).Decode(&edge)
+
+			if err == mongo.ErrNoDocuments {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if edge.Status == domain.FollowStatusAccepted {
+				err = changeFollowCounts(ctx, edge.FollowerId, edge.FolloweeId, -1)
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// viewableUser the follow lists are visible to whoever can see the profile
+func (f FollowRepoImpl) viewableUser(username string, currentUsername string) (*domain.User, error) {
+	conn := database.MongoConn
+
+	var owner domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.M{"username": username, "pendingDeletion": bson.M{"$ne": true}, "deactivated": bson.M{"$ne": true}}).Decode(&owner)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if helper.CurrentUserInteraction(owner.BlockList, currentUsername) || helper.CurrentUserInteraction(owner.BlockByList, currentUsername) {
+		return nil, domain.ErrUserNotFound
+	}
+
+	if owner.Privacy.Profile == domain.AudienceEveryone || owner.Username == currentUsername {
+		return &owner, nil
+	}
+
+	status, err := f.Status(currentUsername, owner.Username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !domain.InAudience(owner.Privacy.Profile, false, status) {
+		return nil, domain.ErrProfileNotViewable
+	}
+
+	return &owner, nil
+}
+
+// findPage lists the users on the other end of the edges, usernameField picks the end
+func (f FollowRepoImpl) findPage(filter bson.D, usernameField string, page string) (*domain.FollowList, error) {
+	conn := database.MongoConn
+
+	pageNumber, err := strconv.Atoi(page)
+
+	if err != nil || pageNumber < 1 {
+		return nil, fmt.Errorf("page must be a number")
+	}
+
+	findOptions := options.Find()
+	findOptions.SetSkip((int64(pageNumber) - 1) * followsPerPage)
+	findOptions.SetLimit(followsPerPage)
+	findOptions.SetSort(bson.D{{"createdAt", -1}})
+
+	cur, err := conn.FollowCollection.Find(context.TODO(), filter, findOptions)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if err = cur.All(context.TODO(), &f.Edges); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	count, err := conn.FollowCollection.CountDocuments(context.TODO(), filter)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	usernames := make([]string, 0, len(f.Edges))
+	for _, edge := range f.Edges {
+		if usernameField == "followerUsername" {
+			usernames = append(usernames, edge.FollowerUsername)
+		} else {
+			usernames = append(usernames, edge.FolloweeUsername)
+		}
+	}
+
+	users := make([]domain.User, 0, len(usernames))
+
+	if len(usernames) > 0 {
+		cur, err = conn.UserCollection.Find(context.TODO(), bson.M{"username": bson.M{"$in": usernames}},
+			options.Find().SetProjection(bson.D{{"username", 1}, {"profilePictureUrl", 1}, {"currentTagLine", 1}}))
+
+		if err != nil {
+			return nil, fmt.Errorf("error processing data")
+		}
+
+		if err = cur.All(context.TODO(), &users); err != nil {
+			return nil, fmt.Errorf("error processing data")
+		}
+	}
+
+	list := domain.FollowList{Users: make([]domain.FollowDto, 0, len(usernames)), NumberOfUsers: count, CurrentPage: pageNumber}
+
+	for i, username := range usernames {
+		dto := domain.FollowDto{Username: username, Since: f.Edges[i].CreatedAt}
+
+		if f.Edges[i].Status == domain.FollowStatusAccepted {
+			dto.Since = f.Edges[i].AcceptedAt
+		}
+
+		for _, user := range users {
+			if user.Username == username {
+				dto.ProfilePictureUrl = user.ProfilePictureUrl
+				dto.CurrentTagLine = user.CurrentTagLine
+			}
+		}
+
+		list.Users = append(list.Users, dto)
+	}
+
+	list.NumberOfPages = int((count + followsPerPage - 1) / followsPerPage)
+
+	if list.NumberOfPages == 0 {
+		list.NumberOfPages = 1
+	}
+
+	return &list, nil
+}
+
+func changeFollowCounts(ctx context.Context, followerId primitive.ObjectID, followeeId primitive.ObjectID, delta int) error {
+	conn := database.MongoConn
+
+	_, err := conn.UserCollection.UpdateOne(ctx, bson.D{{"_id", followerId}}, bson.M{"$inc": bson.M{"followingCount": delta}})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.UserCollection.UpdateOne(ctx, bson.D{{"_id", followeeId}}, bson.M{"$inc": bson.M{"followerCount": delta}})
+
+	return err
+}
+
+// withTransaction runs fn in a transaction with majority writes and snapshot reads
+func withTransaction(fn func(ctx mongo.SessionContext) error) error {
+	conn := database.MongoConn
+
+	// sets mongo's read and write concerns
+	wc := writeconcern.New(writeconcern.WMajority())
+	rc := readconcern.Snapshot()
+	txnOpts := options.Transaction().SetWriteConcern(wc).SetReadConcern(rc)
+
+	// set up for a transaction
+	session, err := conn.StartSession()
+
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(context.Background(), func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionContext)
+	}, txnOpts)
+
+	return err
+}
+
+func NewFollowRepoImpl() FollowRepoImpl {
+	var followRepoImpl FollowRepoImpl
+
+	return followRepoImpl
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"sync"
+	"time"
+)
+
+// InMemoryRevocationRepo keeps revocations in process memory, it's meant for tests and local development
+type InMemoryRevocationRepo struct {
+	mu            sync.Mutex
+	revoked       map[string]time.Time
+	revokedBefore map[primitive.ObjectID]int64
+	sessions      map[string]bool
+}
+
+func (r *InMemoryRevocationRepo) Revoke(jti string, userId primitive.ObjectID, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revoked[jti] = expiresAt
+
+	return nil
+}
+
+func (r *InMemoryRevocationRepo) RevokeAllByUserId(userId primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokedBefore[userId] = domain.UnixMs(time.Now())
+
+	return nil
+}
+
+func (r *InMemoryRevocationRepo) RevokeSession(sessionId primitive.ObjectID, userId primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sessions[sessionId.Hex()] = true
+
+	return nil
+}
+
+func (r *InMemoryRevocationRepo) IsRevoked(jti string, sessionId string, userId primitive.ObjectID, issuedAtMs int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sessions[sessionId] {
+		return true, nil
+	}
+
+	if expiresAt, ok := r.revoked[jti]; ok {
+		if time.Now().Before(expiresAt) {
+			return true, nil
+		}
+		delete(r.revoked, jti)
+	}
+
+	if before, ok := r.revokedBefore[userId]; ok && issuedAtMs <= before {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func NewInMemoryRevocationRepo() *InMemoryRevocationRepo {
+	return &InMemoryRevocationRepo{
+		revoked:       make(map[string]time.Time),
+		revokedBefore: make(map[primitive.ObjectID]int64),
+		sessions:      make(map[string]bool),
+	}
+}
@@ -0,0 +1,7 @@
+package repo
+
+type LoginAttemptRepo interface {
+	Check(key string) error
+	RecordFailure(key string, freeAttempts int) (int, error)
+	Reset(key string) error
+}
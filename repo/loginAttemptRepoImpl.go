@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"time"
+)
+
+const (
+	loginBackoffBase   = time.Second
+	loginBackoffMax    = 15 * time.Minute
+	loginAttemptWindow = time.Hour
+)
+
+type LoginAttemptRepoImpl struct {
+	LoginAttempt domain.LoginAttempt
+}
+
+// Check returns domain.ErrTooManyAttempts while the key is still backing off
+func (l LoginAttemptRepoImpl) Check(key string) error {
+	conn := database.MongoConn
+
+	err := conn.LoginAttemptCollection.FindOne(context.TODO(), bson.D{{"key", key}}).Decode(&l.LoginAttempt)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	if l.LoginAttempt.NextAttemptAt.After(time.Now()) {
+		return domain.ErrTooManyAttempts
+	}
+
+	return nil
+}
+
+// RecordFailure counts a failed login, after freeAttempts failures every further attempt has to wait twice as long
+// as the one before it. It returns the number of failures in the current window.
+func (l LoginAttemptRepoImpl) RecordFailure(key string, freeAttempts int) (int, error) {
+	conn := database.MongoConn
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	filter := bson.D{{"key", key}}
+	update := bson.M{
+		"$inc":         bson.M{"failures": 1},
+		"$set":         bson.M{"expiresAt": time.Now().Add(loginAttemptWindow)},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "nextAttemptAt": time.Now()},
+	}
+
+	err := conn.LoginAttemptCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&l.LoginAttempt)
+
+	if err != nil {
+		return 0, fmt.Errorf("error processing data")
+	}
+
+	if l.LoginAttempt.Failures <= freeAttempts {
+		return l.LoginAttempt.Failures, nil
+	}
+
+	wait := loginBackoffMax
+	if n := l.LoginAttempt.Failures - freeAttempts - 1; n < 20 {
+		if d := loginBackoffBase << uint(n); d < loginBackoffMax {
+			wait = d
+		}
+	}
+
+	_, err = conn.LoginAttemptCollection.UpdateOne(context.TODO(), filter,
+		bson.M{"$set": bson.M{"nextAttemptAt": time.Now().Add(wait)}})
+
+	if err != nil {
+		return 0, fmt.Errorf("error processing data")
+	}
+
+	return l.LoginAttempt.Failures, nil
+}
+
+func (l LoginAttemptRepoImpl) Reset(key string) error {
+	conn := database.MongoConn
+
+	_, err := conn.LoginAttemptCollection.DeleteOne(context.TODO(), bson.D{{"key", key}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func NewLoginAttemptRepoImpl() LoginAttemptRepoImpl {
+	var loginAttemptRepoImpl LoginAttemptRepoImpl
+
+	return loginAttemptRepoImpl
+}
@@ -0,0 +1,11 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type MagicLinkRepo interface {
+	Create(userId primitive.ObjectID, nonce string) (string, error)
+	Consume(token string, nonce string) (*domain.MagicLink, error)
+}
@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/keyring"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type MagicLinkRepoImpl struct {
+	MagicLink domain.MagicLink
+}
+
+// Create issues a signed "<random>.<hmac>" token for the user, only hashes of the token and the nonce are stored
+func (m MagicLinkRepoImpl) Create(userId primitive.ObjectID, nonce string) (string, error) {
+	conn := database.MongoConn
+
+	expiration, err := strconv.Atoi(config.Config("MAGIC_LINK_EXPIRATION"))
+
+	if err != nil {
+		return "", err
+	}
+
+	random, err := generateRefreshToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	k, err := keyring.For(keyring.MagicLink)
+
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := k.Sign([]byte(random))
+
+	if err != nil {
+		return "", err
+	}
+
+	token := random + "." + string(sig)
+
+	m.MagicLink.Id = primitive.NewObjectID()
+	m.MagicLink.UserId = userId
+	m.MagicLink.TokenHash = hashRefreshToken(token)
+	m.MagicLink.NonceHash = hashRefreshToken(nonce)
+	m.MagicLink.ExpiresAt = time.Now().Add(time.Duration(expiration) * time.Minute)
+	m.MagicLink.CreatedAt = time.Now()
+
+	_, err = conn.MagicLinkCollection.InsertOne(context.TODO(), &m.MagicLink)
+
+	if err != nil {
+		return "", fmt.Errorf("error processing data")
+	}
+
+	return token, nil
+}
+
+// Consume marks the link as used, it only works once and only with the nonce of the browser that requested it
+func (m MagicLinkRepoImpl) Consume(token string, nonce string) (*domain.MagicLink, error) {
+	conn := database.MongoConn
+
+	parts := strings.SplitN(token, ".", 2)
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid link")
+	}
+
+	// links signed with a key that was rotated out are rejected before touching the database
+	k, err := keyring.For(keyring.MagicLink)
+
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := k.Verify([]byte(parts[0]), []byte(parts[1]))
+
+	if err != nil || !valid {
+		return nil, fmt.Errorf("invalid link")
+	}
+
+	err = conn.MagicLinkCollection.FindOne(context.TODO(), bson.D{{"tokenHash", hashRefreshToken(token)}}).Decode(&m.MagicLink)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("invalid link")
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	// a forwarded link is opened without the cookie, it stays usable on the device that asked for it
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(m.MagicLink.NonceHash), []byte(hashRefreshToken(nonce))) != 1 {
+		return nil, fmt.Errorf("this link has to be opened in the browser it was requested from")
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": m.MagicLink.Id, "used": false, "expiresAt": bson.M{"$gt": time.Now()}}
+	update := bson.M{"$set": bson.M{"used": true}}
+
+	err = conn.MagicLinkCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&m.MagicLink)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("link has expired or was already used")
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &m.MagicLink, nil
+}
+
+func NewMagicLinkRepoImpl() MagicLinkRepoImpl {
+	var magicLinkRepoImpl MagicLinkRepoImpl
+
+	return magicLinkRepoImpl
+}
@@ -0,0 +1,83 @@
+package repo
+
+import (
+	"context"
+	"log"
+	"os"
+	"story-app-monolith/database"
+	"testing"
+)
+
+// testDatabase is dropped after the tests, it is never the database of the app
+const testDatabase = "story-service-test"
+
+var hasTestDB bool
+
+// TestMain the repos need mongo, TEST_MONGO_URI points at one. It has to be a replica set since the repos use
+// transactions, the mongo of setup/docker-compose.yml is a standalone one. A single node replica set is enough, e.g.
+// "docker run -p 27017:27017 mongo --replSet rs0" followed by rs.initiate() in mongosh and
+// TEST_MONGO_URI=mongodb://localhost:27017/?directConnection=true. Without it the tests that need it are skipped.
+func TestMain(m *testing.M) {
+	if os.Getenv("SECRET") == "" {
+		_ = os.Setenv("SECRET", "test-secret")
+	}
+
+	if os.Getenv("MFA_TOKEN_EXPIRATION") == "" {
+		_ = os.Setenv("MFA_TOKEN_EXPIRATION", "5")
+	}
+
+	if uri := os.Getenv("TEST_MONGO_URI"); uri != "" {
+		conn, err := database.Connect(uri, testDatabase)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		database.MongoConn = conn
+		hasTestDB = true
+	}
+
+	code := m.Run()
+
+	if hasTestDB {
+		_ = database.MongoConn.Database.Drop(context.TODO())
+	}
+
+	os.Exit(code)
+}
+
+// requireDB skips the test without mongo and empties the collections the test is going to use
+func requireDB(t *testing.T) {
+	t.Helper()
+
+	if !hasTestDB {
+		t.Skip("TEST_MONGO_URI isn't set")
+	}
+
+	conn := database.MongoConn
+
+	for _, collection := range []string{"users", "follows", "stories", "oidcStates", "sessions", "refreshTokens", "loginAttempts"} {
+		_, err := conn.Database.Collection(collection).DeleteMany(context.TODO(), map[string]interface{}{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConnectFailsOnDuplicateUsernames(t *testing.T) {
+	requireDB(t)
+
+	db := database.MongoConn.Database.Client().Database(testDatabase + "-duplicates")
+	defer db.Drop(context.TODO())
+
+	for i := 0; i < 2; i++ {
+		if _, err := db.Collection("users").InsertOne(context.TODO(), map[string]interface{}{"username": "twin"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := database.Connect(os.Getenv("TEST_MONGO_URI"), db.Name()); err == nil {
+		t.Fatal("expected the unique username index to fail on duplicate usernames")
+	}
+}
@@ -46,6 +46,22 @@ func (m MessageRepoImpl) Create(message *domain.Message) (*domain.Conversation,
 		}
 	}
 
+	// messaging is paused while the account is deactivated
+	if m.User.Deactivated {
+		return nil, fmt.Errorf("user is not receiving messages")
+	}
+
+	status, err := FollowRepoImpl{}.Status(message.From, message.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the recipient picks who can message them
+	if !domain.InAudience(m.User.Privacy.Messages, message.From == message.To, status) {
+		return nil, fmt.Errorf("user is not receiving messages")
+	}
+
 	message.Id = primitive.NewObjectID()
 
 	_, err = conn.MessageCollection.InsertOne(context.TODO(), &message)
@@ -0,0 +1,13 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type MfaRepo interface {
+	Enroll(id primitive.ObjectID) (*domain.MfaEnrollment, error)
+	Confirm(id primitive.ObjectID, code string) error
+	Disable(id primitive.ObjectID, code string) error
+	Verify(mfaToken string, code string, ip string, userAgent string) (*domain.LoginResult, error)
+}
@@ -0,0 +1,369 @@
+package repo
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/keyring"
+	"story-app-monolith/util"
+	"strings"
+	"time"
+)
+
+const (
+	maxMfaAttempts    = 5
+	mfaLockout        = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+type MfaRepoImpl struct {
+	User domain.User
+}
+
+// Enroll starts 2FA enrolment, nothing changes for the user until the first code is confirmed
+func (m MfaRepoImpl) Enroll(id primitive.ObjectID) (*domain.MfaEnrollment, error) {
+	conn := database.MongoConn
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&m.User)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if m.User.MfaEnabled {
+		return nil, fmt.Errorf("2fa is already enabled")
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hashedCodes := make([]string, 0, len(codes))
+	for _, c := range codes {
+		hashedCodes = append(hashedCodes, hashRecoveryCode(c))
+	}
+
+	sealed, err := sealMfaSecret(secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{{"_id", id}}
+	update := bson.D{{"$set", bson.D{{"mfaPendingSecret", sealed}, {"mfaPendingRecoveryCodes", hashedCodes}, {"updatedAt", time.Now()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	enrollment := new(domain.MfaEnrollment)
+	enrollment.Secret = secret
+	enrollment.OtpAuthUri = util.TOTPUri(config.Config("MFA_ISSUER"), m.User.Username, secret)
+	enrollment.RecoveryCodes = codes
+
+	return enrollment, nil
+}
+
+func (m MfaRepoImpl) Confirm(id primitive.ObjectID, code string) error {
+	conn := database.MongoConn
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&m.User)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return err
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	if m.User.MfaEnabled {
+		return fmt.Errorf("2fa is already enabled")
+	}
+
+	if m.User.MfaPendingSecret == "" {
+		return fmt.Errorf("no 2fa enrolment in progress")
+	}
+
+	if m.User.MfaLockedUntil > time.Now().Unix() {
+		return fmt.Errorf("too many attempts, try again later")
+	}
+
+	secret, err := openMfaSecret(m.User.MfaPendingSecret)
+
+	if err != nil {
+		return err
+	}
+
+	step, ok := util.ValidateTOTP(secret, code, time.Now())
+
+	if !ok {
+		return recordFailedMfaAttempt(id)
+	}
+
+	filter := bson.D{{"_id", id}}
+	update := bson.D{{"$set", bson.D{
+		{"mfaEnabled", true},
+		{"mfaSecret", m.User.MfaPendingSecret},
+		{"mfaRecoveryCodes", m.User.MfaPendingRecoveryCodes},
+		{"mfaPendingSecret", ""},
+		{"mfaPendingRecoveryCodes", []string{}},
+		{"mfaLastUsedStep", step},
+		{"mfaFailedAttempts", 0},
+		{"updatedAt", time.Now()},
+	}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (m MfaRepoImpl) Disable(id primitive.ObjectID, code string) error {
+	conn := database.MongoConn
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&m.User)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return err
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	if !m.User.MfaEnabled {
+		return fmt.Errorf("2fa is not enabled")
+	}
+
+	err = verifyMfaCode(&m.User, code)
+
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{"_id", id}}
+	update := bson.D{{"$set", bson.D{
+		{"mfaEnabled", false},
+		{"mfaSecret", ""},
+		{"mfaRecoveryCodes", []string{}},
+		{"mfaLastUsedStep", 0},
+		{"updatedAt", time.Now()},
+	}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+// Verify exchanges an "mfa pending" token and a valid code for the tokens Login would have issued
+func (m MfaRepoImpl) Verify(mfaToken string, code string, ip string, userAgent string) (*domain.LoginResult, error) {
+	var login domain.Authentication
+
+	conn := database.MongoConn
+
+	a, err := login.ParseMfaToken(mfaToken)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid mfa token")
+	}
+
+	revoked, err := RevocationRepoImpl{}.IsRevoked(a.Jti, "", a.Id, a.IssuedAtMs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, fmt.Errorf("invalid mfa token")
+	}
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", a.Id}}).Decode(&m.User)
+
+	if err != nil {
+		return nil, fmt.Errorf("error finding user")
+	}
+
+	// only a login that confirmed the reactivation can bring a deactivated account back
+	if m.User.Deactivated && !a.Reactivate {
+		return nil, domain.ErrAccountDeactivated
+	}
+
+	err = verifyMfaCode(&m.User, code)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the mfa token is single use
+	err = RevocationRepoImpl{}.Revoke(a.Jti, a.Id, time.Unix(a.ExpiresAt, 0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if m.User.Deactivated {
+		err = withTransaction(func(ctx mongo.SessionContext) error {
+			return setDeactivated(ctx, &m.User, false)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		m.User.Deactivated = false
+	}
+
+	err = recordSuccessfulLogin(m.User.Id, ip)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return issueTokens(&m.User, ip, userAgent)
+}
+
+// verifyMfaCode accepts either a TOTP code that hasn't been used yet or one of the recovery codes
+func verifyMfaCode(user *domain.User, code string) error {
+	conn := database.MongoConn
+
+	if user.MfaLockedUntil > time.Now().Unix() {
+		return fmt.Errorf("too many attempts, try again later")
+	}
+
+	secret, err := openMfaSecret(user.MfaSecret)
+
+	if err != nil {
+		return err
+	}
+
+	step, ok := util.ValidateTOTP(secret, code, time.Now())
+
+	if ok {
+		// the step filter makes sure the same code can't be replayed
+		filter := bson.M{"_id": user.Id, "mfaLastUsedStep": bson.M{"$lt": step}}
+		update := bson.D{{"$set", bson.D{{"mfaLastUsedStep", step}, {"mfaFailedAttempts", 0}}}}
+
+		res, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+		if err != nil {
+			return fmt.Errorf("error processing data")
+		}
+
+		if res.ModifiedCount == 0 {
+			return fmt.Errorf("code was already used")
+		}
+
+		return nil
+	}
+
+	filter := bson.D{{"_id", user.Id}, {"mfaRecoveryCodes", hashRecoveryCode(code)}}
+	update := bson.M{"$pull": bson.M{"mfaRecoveryCodes": hashRecoveryCode(code)}, "$set": bson.M{"mfaFailedAttempts": 0}}
+
+	res, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.ModifiedCount == 1 {
+		return nil
+	}
+
+	return recordFailedMfaAttempt(user.Id)
+}
+
+// sealMfaSecret encrypts a TOTP secret with the MFA_SECRET key before it is stored
+func sealMfaSecret(secret string) (string, error) {
+	k, err := keyring.For(keyring.MfaSecret)
+
+	if err != nil {
+		return "", err
+	}
+
+	return k.Encrypt([]byte(secret))
+}
+
+// openMfaSecret decrypts a stored TOTP secret, a secret that can't be decrypted is an error and never a wrong code
+func openMfaSecret(sealed string) (string, error) {
+	k, err := keyring.For(keyring.MfaSecret)
+
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := k.Decrypt(sealed)
+
+	if err != nil {
+		return "", fmt.Errorf("error processing data")
+	}
+
+	return string(secret), nil
+}
+
+// recordFailedMfaAttempt counts a wrong code and locks code entry for a while after too many of them
+func recordFailedMfaAttempt(id primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	user := new(domain.User)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.D{{"_id", id}}
+	update := bson.M{"$inc": bson.M{"mfaFailedAttempts": 1}}
+
+	err := conn.UserCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(user)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if user.MfaFailedAttempts >= maxMfaAttempts {
+		update = bson.M{"$set": bson.M{"mfaFailedAttempts": 0, "mfaLockedUntil": time.Now().Add(mfaLockout).Unix()}}
+
+		_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+		if err != nil {
+			return fmt.Errorf("error processing data")
+		}
+
+		return fmt.Errorf("too many attempts, try again later")
+	}
+
+	return fmt.Errorf("invalid code")
+}
+
+func hashRecoveryCode(code string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return fmt.Sprintf("%x", h)
+}
+
+func NewMfaRepoImpl() MfaRepoImpl {
+	var mfaRepoImpl MfaRepoImpl
+
+	return mfaRepoImpl
+}
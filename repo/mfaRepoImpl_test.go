@@ -0,0 +1,210 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/util"
+	"testing"
+	"time"
+)
+
+func TestReactivateNeedsSecondFactor(t *testing.T) {
+	requireDB(t)
+
+	conn := database.MongoConn
+
+	user := createTestUser(t, "sleeper", "sleeper@example.com", true)
+
+	secret, err := util.GenerateTOTPSecret()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}}, bson.D{{"$set", bson.D{
+		{"deactivated", true}, {"mfaEnabled", true}, {"mfaSecret", sealTestSecret(t, secret)},
+		{"reactivationToken", "reactivation-token"}, {"reactivationTokenExpiresAt", time.Now().Add(time.Hour).Unix()}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deactivated := func() bool {
+		t.Helper()
+
+		var u domain.User
+
+		if err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", user.Id}}).Decode(&u); err != nil {
+			t.Fatal(err)
+		}
+
+		return u.Deactivated
+	}
+
+	result, err := AuthRepoImpl{}.Reactivate("reactivation-token", "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.MfaToken == "" || result.AccessToken != "" {
+		t.Fatalf("expected only an mfa token, got %+v", result)
+	}
+
+	if !deactivated() {
+		t.Fatal("the account came back before the second factor")
+	}
+
+	if _, err = (MfaRepoImpl{}).Verify(result.MfaToken, "000000", "127.0.0.1", "test"); err == nil {
+		t.Fatal("expected a wrong code to be refused")
+	}
+
+	if !deactivated() {
+		t.Fatal("the account came back with a wrong code")
+	}
+
+	code, err := util.TOTPCode(secret, time.Now().Unix()/30)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login, err := MfaRepoImpl{}.Verify(result.MfaToken, code, "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if login.AccessToken == "" {
+		t.Error("expected a session once the code was accepted")
+	}
+
+	if deactivated() {
+		t.Error("expected the account to be reactivated")
+	}
+}
+
+func TestFailedLoginsAreKeptUntilTheSecondFactor(t *testing.T) {
+	requireDB(t)
+
+	conn := database.MongoConn
+
+	user := createTestUser(t, "guarded", "guarded@example.com", true)
+
+	secret, err := util.GenerateTOTPSecret()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}},
+		bson.D{{"$set", bson.D{{"mfaEnabled", true}, {"mfaSecret", sealTestSecret(t, secret)}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failures := func() int {
+		t.Helper()
+
+		var attempt domain.LoginAttempt
+
+		err := conn.LoginAttemptCollection.FindOne(context.TODO(), bson.D{{"key", "user:" + user.Id.Hex()}}).Decode(&attempt)
+
+		if err != nil {
+			return 0
+		}
+
+		return attempt.Failures
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err = (AuthRepoImpl{}).Login("guarded", "wrong password", "127.0.0.1", "test"); err == nil {
+			t.Fatal("expected a wrong password to be refused")
+		}
+	}
+
+	result, err := AuthRepoImpl{}.Login("guarded", "a long enough password", "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failures() != 2 {
+		t.Fatalf("expected the failures to be kept until the second factor, got %v", failures())
+	}
+
+	code, err := util.TOTPCode(secret, time.Now().Unix()/30)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = (MfaRepoImpl{}).Verify(result.MfaToken, code, "127.0.0.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if failures() != 0 {
+		t.Errorf("expected the failures to be cleared after the second factor, got %v", failures())
+	}
+}
+
+func sealTestSecret(t *testing.T, secret string) string {
+	t.Helper()
+
+	sealed, err := sealMfaSecret(secret)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
+
+func TestMigrateMfaSecrets(t *testing.T) {
+	requireDB(t)
+
+	conn := database.MongoConn
+
+	user := createTestUser(t, "legacy", "legacy@example.com", true)
+
+	secret, err := util.GenerateTOTPSecret()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}},
+		bson.D{{"$set", bson.D{{"mfaEnabled", true}, {"mfaSecret", secret}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = MigrateMfaSecrets(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := findTestUser(t, "legacy")
+
+	if stored.MfaSecret == secret {
+		t.Fatal("expected the secret to be encrypted")
+	}
+
+	opened, err := openMfaSecret(stored.MfaSecret)
+
+	if err != nil || opened != secret {
+		t.Fatalf("expected the encrypted secret to open to the old one, got %q %v", opened, err)
+	}
+
+	// a second run leaves encrypted secrets alone
+	if err = MigrateMfaSecrets(); err != nil {
+		t.Fatal(err)
+	}
+
+	if again := findTestUser(t, "legacy"); again.MfaSecret != stored.MfaSecret {
+		t.Fatal("expected an encrypted secret to be left as it is")
+	}
+}
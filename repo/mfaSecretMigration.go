@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/database"
+	"strings"
+)
+
+// mfaMigrationBatch how many secrets are written per bulk write
+const mfaMigrationBatch = 500
+
+// plainMfaSecret matches a TOTP secret stored before they were encrypted, an encrypted one starts with "<kid>:"
+var plainMfaSecret = primitive.Regex{Pattern: "^[A-Z2-7]+$"}
+
+// MigrateMfaSecrets encrypts the TOTP secrets that were stored in plain text. A secret is only replaced if it
+// didn't change in the meantime, so it can run while users enrol. Without any plain secrets left it does nothing.
+func MigrateMfaSecrets() error {
+	conn := database.MongoConn
+
+	legacy := bson.D{{"$or", bson.A{
+		bson.D{{"mfaSecret", plainMfaSecret}},
+		bson.D{{"mfaPendingSecret", plainMfaSecret}},
+	}}}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), legacy,
+		options.Find().SetProjection(bson.D{{"mfaSecret", 1}, {"mfaPendingSecret", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close(context.TODO())
+
+	models := make([]mongo.WriteModel, 0, mfaMigrationBatch)
+
+	for cur.Next(context.TODO()) {
+		var user struct {
+			Id               primitive.ObjectID `bson:"_id"`
+			MfaSecret        string             `bson:"mfaSecret"`
+			MfaPendingSecret string             `bson:"mfaPendingSecret"`
+		}
+
+		if err = cur.Decode(&user); err != nil {
+			return err
+		}
+
+		for field, secret := range map[string]string{"mfaSecret": user.MfaSecret, "mfaPendingSecret": user.MfaPendingSecret} {
+			if secret == "" || strings.Contains(secret, ":") {
+				continue
+			}
+
+			sealed, err := sealMfaSecret(secret)
+
+			if err != nil {
+				return err
+			}
+
+			models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.D{{"_id", user.Id}, {field, secret}}).
+				SetUpdate(bson.D{{"$set", bson.D{{field, sealed}}}}))
+		}
+
+		if len(models) >= mfaMigrationBatch {
+			if err = bulkWrite(conn.UserCollection, models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	return bulkWrite(conn.UserCollection, models)
+}
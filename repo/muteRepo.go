@@ -0,0 +1,13 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type MuteRepo interface {
+	Create(userId primitive.ObjectID, mute *domain.CreateMute) (*domain.Mute, error)
+	FindAllByUserId(userId primitive.ObjectID) (*[]domain.Mute, error)
+	Delete(id primitive.ObjectID, userId primitive.ObjectID) error
+	Filter(username string) (*domain.MuteFilter, error)
+}
@@ -0,0 +1,196 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"time"
+)
+
+const maxMutes = 200
+
+type MuteRepoImpl struct {
+	Mute     domain.Mute
+	MuteList []domain.Mute
+}
+
+// Create muting the same thing again replaces the expiry
+func (m MuteRepoImpl) Create(userId primitive.ObjectID, mute *domain.CreateMute) (*domain.Mute, error) {
+	conn := database.MongoConn
+
+	var user domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", userId}}).Decode(&user)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if mute.Kind == domain.MuteKindUser {
+		if mute.Value == user.Username {
+			return nil, fmt.Errorf("you can't mute yourself")
+		}
+
+		count, err := conn.UserCollection.CountDocuments(context.TODO(), bson.D{{"username", mute.Value}})
+
+		if err != nil {
+			return nil, fmt.Errorf("error processing data")
+		}
+
+		if count == 0 {
+			return nil, domain.ErrUserNotFound
+		}
+	}
+
+	filter := bson.D{{"userId", userId}, {"kind", mute.Kind}, {"value", mute.Value}}
+
+	count, err := conn.MuteCollection.CountDocuments(context.TODO(), bson.M{"userId": userId, "$nor": bson.A{filter}})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if count >= maxMutes {
+		return nil, fmt.Errorf("you can't have more than %v mutes, remove one first", maxMutes)
+	}
+
+	update := bson.M{"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "createdAt": time.Now()}}
+
+	if mute.ExpiresAt != nil {
+		update["$set"] = bson.M{"expiresAt": mute.ExpiresAt}
+	} else {
+		update["$unset"] = bson.M{"expiresAt": ""}
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	err = conn.MuteCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&m.Mute)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &m.Mute, nil
+}
+
+func (m MuteRepoImpl) FindAllByUserId(userId primitive.ObjectID) (*[]domain.Mute, error) {
+	conn := database.MongoConn
+
+	findOptions := options.Find().SetSort(bson.D{{"createdAt", -1}})
+
+	cur, err := conn.MuteCollection.Find(context.TODO(), activeMutes(userId), findOptions)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	m.MuteList = make([]domain.Mute, 0)
+	if err = cur.All(context.TODO(), &m.MuteList); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &m.MuteList, nil
+}
+
+func (m MuteRepoImpl) Delete(id primitive.ObjectID, userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	res, err := conn.MuteCollection.DeleteOne(context.TODO(), bson.D{{"_id", id}, {"userId", userId}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.DeletedCount == 0 {
+		return fmt.Errorf("mute not found")
+	}
+
+	return nil
+}
+
+// Filter collects the active mutes of a user, a user without mutes gets an empty filter
+func (m MuteRepoImpl) Filter(username string) (*domain.MuteFilter, error) {
+	conn := database.MongoConn
+
+	filter := new(domain.MuteFilter)
+
+	var user domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}},
+		options.FindOne().SetProjection(bson.D{{"_id", 1}})).Decode(&user)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return filter, nil
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	mutes, err := m.FindAllByUserId(user.Id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mute := range *mutes {
+		switch mute.Kind {
+		case domain.MuteKindUser:
+			filter.Usernames = append(filter.Usernames, mute.Value)
+		case domain.MuteKindTag:
+			filter.Tags = append(filter.Tags, mute.Value)
+		case domain.MuteKindKeyword:
+			filter.Keywords = append(filter.Keywords, mute.Value)
+		}
+	}
+
+	return filter, nil
+}
+
+// activeMutes mongo removes expired mutes only about once a minute
+func activeMutes(userId primitive.ObjectID) bson.M {
+	return bson.M{"userId": userId, "$or": bson.A{
+		bson.M{"expiresAt": bson.M{"$exists": false}},
+		bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+	}}
+}
+
+// mutedStoriesQuery excludes the muted authors, tags and keywords from a story query
+func mutedStoriesQuery(filter *domain.MuteFilter) bson.M {
+	query := bson.M{}
+
+	if filter.IsEmpty() {
+		return query
+	}
+
+	nor := bson.A{}
+
+	if len(filter.Usernames) > 0 {
+		nor = append(nor, bson.M{"authorUsername": bson.M{"$in": filter.Usernames}})
+	}
+
+	for _, tag := range filter.Tags {
+		nor = append(nor, bson.M{"tag.value": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(tag) + "$", Options: "i"}})
+	}
+
+	for _, keyword := range filter.Keywords {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(keyword), Options: "i"}
+		nor = append(nor, bson.M{"title": pattern}, bson.M{"content": pattern})
+	}
+
+	query["$nor"] = nor
+
+	return query
+}
+
+func NewMuteRepoImpl() MuteRepoImpl {
+	var muteRepoImpl MuteRepoImpl
+
+	return muteRepoImpl
+}
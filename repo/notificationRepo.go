@@ -4,5 +4,6 @@ import "story-app-monolith/domain"
 
 type NotificationRepo interface {
 	GetAllUnreadNotificationByUsername(string) (*[]domain.Notification, error)
+	Create(string, string, string, string) error
 }
 
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"log"
 	"story-app-monolith/database"
 	"story-app-monolith/domain"
+	"time"
 )
 
 type NotificationRepoImpl struct {
@@ -35,9 +37,54 @@ func (n NotificationRepoImpl) GetAllUnreadNotificationByUsername(username string
 	}
 
 
-	return &n.NotificationList, nil
+	mutes, err := MuteRepoImpl{}.Filter(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// notifications caused by a muted user or mentioning a muted keyword are dropped silently
+	notifications := make([]domain.Notification, 0, len(n.NotificationList))
+	for _, notification := range n.NotificationList {
+		if !mutes.Hides(notification.From, notification.Content) {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	return &notifications, nil
 }
 
+// Create from is empty for notifications the app sends itself. Deactivated users don't get any until they're back.
+func (n NotificationRepoImpl) Create(username string, from string, content string, path string) error {
+	conn := database.MongoConn
+
+	deactivated, err := conn.UserCollection.CountDocuments(context.TODO(), bson.D{{"username", username}, {"deactivated", true}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if deactivated > 0 {
+		return nil
+	}
+
+	n.Notification.Id = primitive.NewObjectID()
+	n.Notification.For = username
+	n.Notification.From = from
+	n.Notification.Content = content
+	n.Notification.Path = path
+	n.Notification.ReadStatus = false
+	n.Notification.CreatedAt = time.Now()
+	n.Notification.UpdatedAt = time.Now()
+
+	_, err = conn.NotificationCollection.InsertOne(context.TODO(), &n.Notification)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
 
 func NewNotificationRepoImpl() NotificationRepoImpl {
 	var notificationRepoImpl NotificationRepoImpl
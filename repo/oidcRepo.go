@@ -0,0 +1,9 @@
+package repo
+
+import "story-app-monolith/domain"
+
+type OidcRepo interface {
+	Begin(provider string) (authUrl string, state string, err error)
+	Callback(provider string, state string, code string, ip string, userAgent string) (*domain.OidcLoginResult, error)
+	Signup(signupToken string, username string, ip string, userAgent string) (*domain.LoginResult, error)
+}
@@ -0,0 +1,264 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/oidc"
+	"story-app-monolith/util"
+	"strings"
+	"time"
+)
+
+const (
+	oidcStateLifetime  = 10 * time.Minute
+	oidcSignupLifetime = 15 * time.Minute
+)
+
+type OidcRepoImpl struct {
+	OidcState domain.OidcState
+}
+
+// Begin stores the nonce and the PKCE verifier under the hash of a new state and returns where to send the user
+func (o OidcRepoImpl) Begin(provider string) (string, string, error) {
+	conn := database.MongoConn
+
+	p, err := oidc.For(provider)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := oidc.RandomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := oidc.RandomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	verifier, err := oidc.RandomString()
+
+	if err != nil {
+		return "", "", err
+	}
+
+	authUrl, err := p.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	o.OidcState.Id = primitive.NewObjectID()
+	o.OidcState.StateHash = hashRefreshToken(state)
+	o.OidcState.Provider = provider
+	o.OidcState.Nonce = nonce
+	o.OidcState.CodeVerifier = verifier
+	o.OidcState.ExpiresAt = time.Now().Add(oidcStateLifetime)
+	o.OidcState.CreatedAt = time.Now()
+
+	_, err = conn.OidcStateCollection.InsertOne(context.TODO(), &o.OidcState)
+
+	if err != nil {
+		return "", "", fmt.Errorf("error processing data")
+	}
+
+	return authUrl, state, nil
+}
+
+// Callback signs in the account linked to the provider's subject. An account with the same verified email is linked
+// first, without one the caller gets a signup token to pick a username with.
+func (o OidcRepoImpl) Callback(provider string, state string, code string, ip string, userAgent string) (*domain.OidcLoginResult, error) {
+	conn := database.MongoConn
+
+	// the state can only be used once
+	filter := bson.M{"stateHash": hashRefreshToken(state), "provider": provider, "signupTokenHash": "", "expiresAt": bson.M{"$gt": time.Now()}}
+
+	err := conn.OidcStateCollection.FindOneAndDelete(context.TODO(), filter).Decode(&o.OidcState)
+
+	if err != nil || state == "" {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments || state == "" {
+			return nil, fmt.Errorf("sign in has expired, try again")
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	p, err := oidc.For(provider)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := p.Exchange(code, o.OidcState.CodeVerifier)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := p.VerifyIdToken(tokens.IdToken, o.OidcState.Nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var user domain.User
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.M{"externalIdentities": bson.M{"$elemMatch": bson.M{
+		"provider": provider, "subject": claims.Subject}}}).Decode(&user)
+
+	if err == nil {
+		login, err := oidcLogin(&user, ip, userAgent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &domain.OidcLoginResult{Login: login}, nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, fmt.Errorf("%v didn't share a verified email", provider)
+	}
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"email", claims.Email}}).Decode(&user)
+
+	if err == nil {
+		// otherwise someone could sign up with another person's email and wait for them to link their provider
+		if !user.IsVerified {
+			return nil, fmt.Errorf("sign in with your password and verify your email before signing in with %v", provider)
+		}
+
+		identity := domain.ExternalIdentity{Provider: provider, Subject: claims.Subject, Email: claims.Email, LinkedAt: time.Now()}
+
+		_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", user.Id}},
+			bson.M{"$push": bson.M{"externalIdentities": identity}, "$set": bson.M{"updatedAt": time.Now()}})
+
+		if err != nil {
+			return nil, fmt.Errorf("error processing data")
+		}
+
+		login, err := oidcLogin(&user, ip, userAgent)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &domain.OidcLoginResult{Login: login}, nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	signupToken, err := oidc.RandomString()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o.OidcState.Id = primitive.NewObjectID()
+	o.OidcState.StateHash = ""
+	o.OidcState.SignupTokenHash = hashRefreshToken(signupToken)
+	o.OidcState.Subject = claims.Subject
+	o.OidcState.Email = claims.Email
+	o.OidcState.ExpiresAt = time.Now().Add(oidcSignupLifetime)
+
+	_, err = conn.OidcStateCollection.InsertOne(context.TODO(), &o.OidcState)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	suggested := claims.PreferredUsername
+	if suggested == "" {
+		suggested = strings.Split(claims.Email, "@")[0]
+	}
+
+	return &domain.OidcLoginResult{SignupToken: signupToken, Email: claims.Email, SuggestedUsername: suggestUsername(suggested)}, nil
+}
+
+// Signup creates the account for a signup token from Callback. It has no usable password, the email is already
+// verified by the provider.
+func (o OidcRepoImpl) Signup(signupToken string, username string, ip string, userAgent string) (*domain.LoginResult, error) {
+	conn := database.MongoConn
+
+	filter := bson.M{"signupTokenHash": hashRefreshToken(signupToken), "expiresAt": bson.M{"$gt": time.Now()}}
+
+	err := conn.OidcStateCollection.FindOneAndDelete(context.TODO(), filter).Decode(&o.OidcState)
+
+	if err != nil || signupToken == "" {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments || signupToken == "" {
+			return nil, fmt.Errorf("signup has expired, sign in again")
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	password, err := oidc.RandomString()
+
+	if err != nil {
+		return nil, err
+	}
+
+	user := util.CreateUser(&domain.CreateUserDto{Username: username, Email: o.OidcState.Email, Password: password})
+	user.IsVerified = true
+	user.ExternalIdentities = []domain.ExternalIdentity{{Provider: o.OidcState.Provider, Subject: o.OidcState.Subject,
+		Email: o.OidcState.Email, LinkedAt: time.Now()}}
+
+	err = UserRepoImpl{}.Create(user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return completeLogin(user, ip, userAgent)
+}
+
+// oidcLogin the provider replaces the password but the account lock and 2FA still apply
+func oidcLogin(user *domain.User, ip string, userAgent string) (*domain.LoginResult, error) {
+	if user.IsLocked && user.LockedUntil > time.Now().Unix() {
+		return nil, domain.ErrAccountLocked
+	}
+
+	if user.PendingDeletion {
+		return nil, domain.ErrAccountPendingDeletion
+	}
+
+	return completeLogin(user, ip, userAgent)
+}
+
+// suggestUsername keeps letters, digits and underscores
+func suggestUsername(s string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		}
+
+		if b.Len() == 30 {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+func NewOidcRepoImpl() OidcRepoImpl {
+	var oidcRepoImpl OidcRepoImpl
+
+	return oidcRepoImpl
+}
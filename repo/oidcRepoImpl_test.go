@@ -0,0 +1,265 @@
+package repo
+
+import (
+	"context"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/oidc"
+	"story-app-monolith/oidc/oidctest"
+	"story-app-monolith/util"
+	"strings"
+	"testing"
+)
+
+const testProvider = "mock"
+
+func newTestIssuer(t *testing.T) *oidctest.Issuer {
+	t.Helper()
+
+	issuer, err := oidctest.NewIssuer("client")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(issuer.Close)
+
+	oidc.Register(issuer.Provider(testProvider))
+
+	return issuer
+}
+
+// signInWith begins a sign in and lets the issuer answer it with the claims, it returns the state and the code
+func signInWith(t *testing.T, issuer *oidctest.Issuer, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+
+	authUrl, state, err := OidcRepoImpl{}.Begin(testProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := issuer.Authorize(authUrl, claims)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state, code
+}
+
+func createTestUser(t *testing.T, username string, email string, verified bool) *domain.User {
+	t.Helper()
+
+	user := util.CreateUser(&domain.CreateUserDto{Username: username, Email: email, Password: "a long enough password"})
+	user.IsVerified = verified
+
+	err := UserRepoImpl{}.Create(user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func TestOidcCallbackRejectsTamperedTokens(t *testing.T) {
+	requireDB(t)
+	issuer := newTestIssuer(t)
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+	}{
+		{"bad nonce", func(c jwt.MapClaims) { c["nonce"] = "someone else's nonce" }},
+		{"bad issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.test" }},
+		{"bad audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = int64(1) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := issuer.Claims("subject", "user@example.com")
+			test.change(claims)
+
+			state, code := signInWith(t, issuer, claims)
+
+			result, err := OidcRepoImpl{}.Callback(testProvider, state, code, "127.0.0.1", "test")
+
+			if err == nil {
+				t.Fatalf("the sign in went through with %+v", result)
+			}
+		})
+	}
+}
+
+func TestOidcCallbackRejectsWrongVerifier(t *testing.T) {
+	requireDB(t)
+	issuer := newTestIssuer(t)
+
+	state, code := signInWith(t, issuer, issuer.Claims("subject", "user@example.com"))
+
+	other, err := oidc.RandomString()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = database.MongoConn.OidcStateCollection.UpdateOne(context.TODO(), bson.D{{"stateHash", hashRefreshToken(state)}},
+		bson.D{{"$set", bson.D{{"codeVerifier", other}}}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = (OidcRepoImpl{}).Callback(testProvider, state, code, "127.0.0.1", "test"); err == nil {
+		t.Error("the code was exchanged with another verifier")
+	}
+}
+
+func TestOidcCallbackStateIsUsedOnce(t *testing.T) {
+	requireDB(t)
+	issuer := newTestIssuer(t)
+
+	state, code := signInWith(t, issuer, issuer.Claims("subject", "user@example.com"))
+
+	if _, err := (OidcRepoImpl{}).Callback(testProvider, state, code, "127.0.0.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a fresh code doesn't make the used state valid again
+	authUrl, _, err := OidcRepoImpl{}.Begin(testProvider)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err = issuer.Authorize(authUrl, issuer.Claims("subject", "user@example.com"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = OidcRepoImpl{}.Callback(testProvider, state, code, "127.0.0.1", "test")
+
+	if err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("a replayed state was accepted, got %v", err)
+	}
+}
+
+func TestOidcCallbackLinksVerifiedAccount(t *testing.T) {
+	requireDB(t)
+	issuer := newTestIssuer(t)
+
+	user := createTestUser(t, "linked", "linked@example.com", true)
+
+	state, code := signInWith(t, issuer, issuer.Claims("linked-subject", "Linked@Example.com"))
+
+	result, err := OidcRepoImpl{}.Callback(testProvider, state, code, "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Login == nil || result.Login.AccessToken == "" {
+		t.Fatalf("expected a login, got %+v", result)
+	}
+
+	var linked domain.User
+
+	err = database.MongoConn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", user.Id}}).Decode(&linked)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(linked.ExternalIdentities) != 1 || linked.ExternalIdentities[0].Subject != "linked-subject" {
+		t.Fatalf("expected the identity to be linked, got %+v", linked.ExternalIdentities)
+	}
+
+	// the next sign in finds the account by the subject, even after the email changed at the provider
+	state, code = signInWith(t, issuer, issuer.Claims("linked-subject", "new@example.com"))
+
+	result, err = OidcRepoImpl{}.Callback(testProvider, state, code, "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Login == nil || result.Login.User.Username != "linked" {
+		t.Errorf("expected a login as linked, got %+v", result)
+	}
+}
+
+func TestOidcCallbackDoesNotLinkUnverifiedAccount(t *testing.T) {
+	requireDB(t)
+	issuer := newTestIssuer(t)
+
+	createTestUser(t, "unverified", "unverified@example.com", false)
+
+	state, code := signInWith(t, issuer, issuer.Claims("unverified-subject", "unverified@example.com"))
+
+	if _, err := (OidcRepoImpl{}).Callback(testProvider, state, code, "127.0.0.1", "test"); err == nil {
+		t.Error("an unverified account was linked")
+	}
+
+	// nor when the provider didn't verify the email
+	createTestUser(t, "verified", "verified@example.com", true)
+
+	claims := issuer.Claims("verified-subject", "verified@example.com")
+	claims["email_verified"] = false
+
+	state, code = signInWith(t, issuer, claims)
+
+	if _, err := (OidcRepoImpl{}).Callback(testProvider, state, code, "127.0.0.1", "test"); err == nil {
+		t.Error("an account was linked to an unverified email")
+	}
+}
+
+func TestOidcSignup(t *testing.T) {
+	requireDB(t)
+	issuer := newTestIssuer(t)
+
+	claims := issuer.Claims("new-subject", "new@example.com")
+	claims["preferred_username"] = "New.User"
+
+	state, code := signInWith(t, issuer, claims)
+
+	result, err := OidcRepoImpl{}.Callback(testProvider, state, code, "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Login != nil || result.SignupToken == "" || result.SuggestedUsername != "newuser" {
+		t.Fatalf("expected a signup, got %+v", result)
+	}
+
+	login, err := OidcRepoImpl{}.Signup(result.SignupToken, "newuser", "127.0.0.1", "test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if login.AccessToken == "" {
+		t.Fatalf("expected a login, got %+v", login)
+	}
+
+	var user domain.User
+
+	err = database.MongoConn.UserCollection.FindOne(context.TODO(), bson.D{{"username", "newuser"}}).Decode(&user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.IsVerified || user.Email != "new@example.com" || len(user.ExternalIdentities) != 1 {
+		t.Errorf("unexpected user %+v", user)
+	}
+
+	if _, err = (OidcRepoImpl{}).Signup(result.SignupToken, "another", "127.0.0.1", "test"); err == nil {
+		t.Error("the signup token was used twice")
+	}
+}
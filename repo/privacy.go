@@ -0,0 +1,197 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"regexp"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	helper "story-app-monolith/helpers"
+	"strings"
+)
+
+// mentionRegex an @ in the middle of a word, like in an email address, isn't a mention
+var mentionRegex = regexp.MustCompile(`(?:^|[^a-z0-9_@])@([a-z0-9_]{2,30})`)
+
+// MigratePrivacySettings turns the visibility, follower count and message flags of users from before the privacy
+// settings into audiences. Users that already have settings are left alone so it's safe to run on every start.
+func MigratePrivacySettings() error {
+	conn := database.MongoConn
+
+	defaults := domain.DefaultPrivacySettings()
+
+	unless := func(field string, audience string, fallback string) bson.D {
+		return bson.D{{"$cond", bson.A{bson.D{{"$eq", bson.A{field, false}}}, audience, fallback}}}
+	}
+
+	profile := unless("$profileIsViewable", domain.AudienceFollowers, defaults.Profile)
+
+	_, err := conn.UserCollection.UpdateMany(context.TODO(), bson.D{{"privacy", bson.D{{"$exists", false}}}}, mongo.Pipeline{
+		{{"$set", bson.D{{"privacy", bson.D{
+			{"profile", profile},
+			{"stories", profile},
+			{"followerCount", unless("$displayFollowerCount", domain.AudienceNobody, defaults.FollowerCount)},
+			{"messages", unless("$acceptMessages", domain.AudienceNobody, defaults.Messages)},
+			{"mentions", defaults.Mentions},
+			{"readActivity", defaults.ReadActivity},
+		}}}}},
+		{{"$unset", bson.A{"profileIsViewable", "displayFollowerCount", "acceptMessages"}}},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	// stories from before the audience was copied onto them
+	cur, err := conn.UserCollection.Find(context.TODO(), bson.D{{"privacy.stories", bson.D{{"$ne", domain.AudienceEveryone}}}},
+		options.Find().SetProjection(bson.D{{"username", 1}, {"privacy.stories", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	var users []domain.User
+
+	if err = cur.All(context.TODO(), &users); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err = syncStoriesAudience(context.TODO(), user.Username, user.Privacy.Stories); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncStoriesAudience copies the stories audience of an author onto their stories so listing them doesn't need the
+// author. Everyone is the same as no field at all, like on stories from before the privacy settings.
+func syncStoriesAudience(ctx context.Context, username string, audience string) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"authorUsername", username}, {"authorStoriesAudience", bson.D{{"$ne", audience}}}}
+	update := bson.D{{"$set", bson.D{{"authorStoriesAudience", audience}}}}
+
+	if audience == domain.AudienceEveryone {
+		filter = bson.D{{"authorUsername", username}, {"authorStoriesAudience", bson.D{{"$exists", true}}}}
+		update = bson.D{{"$unset", bson.D{{"authorStoriesAudience", ""}}}}
+	}
+
+	_, err := conn.StoryCollection.UpdateMany(ctx, filter, update)
+
+	return err
+}
+
+// storiesAudienceQuery matches the stories viewer is in the stories audience of, their own, the ones for everyone and
+// the ones for followers of authors they follow. An empty viewer only sees the ones for everyone.
+func storiesAudienceQuery(viewer string) (bson.A, error) {
+	conn := database.MongoConn
+
+	visible := bson.A{bson.D{{"authorStoriesAudience", bson.D{{"$exists", false}}}}}
+
+	if viewer == "" {
+		return visible, nil
+	}
+
+	following, err := conn.FollowCollection.Distinct(context.TODO(), "followeeUsername",
+		bson.D{{"followerUsername", viewer}, {"status", domain.FollowStatusAccepted}})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	visible = append(visible, bson.D{{"authorUsername", viewer}})
+
+	if len(following) > 0 {
+		visible = append(visible, bson.D{{"authorStoriesAudience", domain.AudienceFollowers}, {"authorUsername", bson.D{{"$in", following}}}})
+	}
+
+	return visible, nil
+}
+
+// NotifyMentions lets the users mentioned with @username know, as long as the author is in their mentions audience.
+// It runs in the background, a mention that can't be delivered never fails the comment it's in.
+func NotifyMentions(author string, content string, path string) {
+	usernames := mentionedUsernames(author, content)
+
+	if len(usernames) == 0 {
+		return
+	}
+
+	go func() {
+		err := notifyMentions(author, usernames, path)
+
+		if err != nil {
+			log.Printf("mentions by %v: %v", author, err)
+		}
+	}()
+}
+
+// mentionedUsernames each user once, without the author, up to domain.MaxMentions
+func mentionedUsernames(author string, content string) []string {
+	seen := map[string]bool{author: true}
+	usernames := make([]string, 0)
+
+	for _, match := range mentionRegex.FindAllStringSubmatch(strings.ToLower(content), -1) {
+		if seen[match[1]] {
+			continue
+		}
+
+		seen[match[1]] = true
+		usernames = append(usernames, match[1])
+
+		if len(usernames) == domain.MaxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+func notifyMentions(author string, usernames []string, path string) error {
+	conn := database.MongoConn
+
+	filter := bson.M{"username": bson.M{"$in": usernames}, "pendingDeletion": bson.M{"$ne": true}, "deactivated": bson.M{"$ne": true}}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), filter,
+		options.Find().SetProjection(bson.D{{"username", 1}, {"blockList", 1}, {"blockByList", 1}, {"privacy", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	var users []domain.User
+
+	if err = cur.All(context.TODO(), &users); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if helper.CurrentUserInteraction(user.BlockList, author) || helper.CurrentUserInteraction(user.BlockByList, author) {
+			continue
+		}
+
+		status, err := FollowRepoImpl{}.Status(author, user.Username)
+
+		if err != nil {
+			return err
+		}
+
+		if !domain.InAudience(user.Privacy.Mentions, false, status) {
+			continue
+		}
+
+		err = NotificationRepoImpl{}.Create(user.Username, author, fmt.Sprintf("%v mentioned you", author), path)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
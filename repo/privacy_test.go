@@ -0,0 +1,90 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"testing"
+	"time"
+)
+
+func TestStoriesAudience(t *testing.T) {
+	requireDB(t)
+
+	author := createTestUser(t, "author", "author@example.com", true)
+	follower := createTestUser(t, "follower", "follower@example.com", true)
+	createTestUser(t, "stranger", "stranger@example.com", true)
+
+	_, err := database.MongoConn.FollowCollection.InsertOne(context.TODO(), domain.Follow{Id: primitive.NewObjectID(),
+		FollowerId: follower.Id, FollowerUsername: "follower", FolloweeId: author.Id, FolloweeUsername: "author",
+		Status: domain.FollowStatusAccepted, CreatedAt: time.Now(), AcceptedAt: time.Now()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	followers := domain.AudienceFollowers
+
+	if _, err = (UserRepoImpl{}).UpdatePrivacySettings(author.Id, &domain.UpdatePrivacySettings{Stories: &followers}); err != nil {
+		t.Fatal(err)
+	}
+
+	story := &domain.CreateStoryDto{Title: "title", Content: "content", AuthorUsername: "author", CreatedAt: time.Now()}
+
+	if err = (StoryRepoImpl{}).Create(story); err != nil {
+		t.Fatal(err)
+	}
+
+	visible := func(viewer string) bool {
+		t.Helper()
+
+		_, err := StoryRepoImpl{}.FindById(story.Id, viewer, "127.0.0.1")
+
+		if err != nil && err != mongo.ErrNoDocuments {
+			t.Fatal(err)
+		}
+
+		found := err == nil
+
+		page, err := StoryRepoImpl{}.FindAll("1", true, viewer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if found != (len(page.Stories) == 1) {
+			t.Errorf("%v: FindById and FindAll disagree", viewer)
+		}
+
+		return len(page.Stories) == 1
+	}
+
+	for viewer, expected := range map[string]bool{"author": true, "follower": true, "stranger": false, "": false} {
+		if visible(viewer) != expected {
+			t.Errorf("%q: expected visible to be %v", viewer, expected)
+		}
+	}
+
+	featured, err := StoryRepoImpl{}.FeaturedStories()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*featured) != 0 {
+		t.Errorf("a story for followers was featured")
+	}
+
+	// opening the stories up again reaches the ones already written
+	everyone := domain.AudienceEveryone
+
+	if _, err = (UserRepoImpl{}).UpdatePrivacySettings(author.Id, &domain.UpdatePrivacySettings{Stories: &everyone}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !visible("stranger") {
+		t.Errorf("expected the story to be visible to everyone")
+	}
+}
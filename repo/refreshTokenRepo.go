@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type RefreshTokenRepo interface {
+	Create(userId primitive.ObjectID, username string, family primitive.ObjectID) (string, error)
+	Rotate(token string) (*domain.RefreshToken, string, error)
+	RevokeFamily(family primitive.ObjectID) error
+	RevokeFamilyByToken(token string) error
+	RevokeAllByUserId(userId primitive.ObjectID) error
+}
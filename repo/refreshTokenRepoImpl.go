@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"strconv"
+	"time"
+)
+
+type RefreshTokenRepoImpl struct {
+	RefreshToken domain.RefreshToken
+}
+
+// Create issues a new refresh token in the given family, only the hash of the returned token is stored
+func (r RefreshTokenRepoImpl) Create(userId primitive.ObjectID, username string, family primitive.ObjectID) (string, error) {
+	conn := database.MongoConn
+
+	expiration, err := strconv.Atoi(config.Config("REFRESH_TOKEN_EXPIRATION"))
+
+	if err != nil {
+		return "", err
+	}
+
+	token, err := generateRefreshToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	r.RefreshToken.Id = primitive.NewObjectID()
+	r.RefreshToken.UserId = userId
+	r.RefreshToken.Username = username
+	r.RefreshToken.Family = family
+	r.RefreshToken.TokenHash = hashRefreshToken(token)
+	r.RefreshToken.ExpiresAt = time.Now().Add(time.Duration(expiration) * time.Minute)
+	r.RefreshToken.CreatedAt = time.Now()
+	r.RefreshToken.UpdatedAt = time.Now()
+
+	_, err = conn.RefreshTokenCollection.InsertOne(context.TODO(), &r.RefreshToken)
+
+	if err != nil {
+		return "", fmt.Errorf("error processing data")
+	}
+
+	return token, nil
+}
+
+// Rotate consumes a refresh token and issues its replacement in the same family.
+// Presenting a token that was already used or revoked revokes the whole family.
+func (r RefreshTokenRepoImpl) Rotate(token string) (*domain.RefreshToken, string, error) {
+	conn := database.MongoConn
+
+	hash := hashRefreshToken(token)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"tokenHash": hash, "used": false, "revoked": false, "expiresAt": bson.M{"$gt": time.Now()}}
+	update := bson.D{{"$set", bson.D{{"used", true}, {"updatedAt", time.Now()}}}}
+
+	err := conn.RefreshTokenCollection.FindOneAndUpdate(context.TODO(), filter, update, opts).Decode(&r.RefreshToken)
+
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, "", fmt.Errorf("error processing data")
+		}
+
+		err = conn.RefreshTokenCollection.FindOne(context.TODO(), bson.D{{"tokenHash", hash}}).Decode(&r.RefreshToken)
+
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid refresh token")
+		}
+
+		if r.RefreshToken.Used || r.RefreshToken.Revoked {
+			err = r.RevokeFamily(r.RefreshToken.Family)
+
+			if err != nil {
+				return nil, "", err
+			}
+
+			return nil, "", fmt.Errorf("refresh token reuse detected")
+		}
+
+		return nil, "", fmt.Errorf("refresh token has expired")
+	}
+
+	newToken, err := r.Create(r.RefreshToken.UserId, r.RefreshToken.Username, r.RefreshToken.Family)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &r.RefreshToken, newToken, nil
+}
+
+func (r RefreshTokenRepoImpl) RevokeFamily(family primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"family", family}}
+	update := bson.D{{"$set", bson.D{{"revoked", true}, {"updatedAt", time.Now()}}}}
+
+	_, err := conn.RefreshTokenCollection.UpdateMany(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (r RefreshTokenRepoImpl) RevokeFamilyByToken(token string) error {
+	conn := database.MongoConn
+
+	err := conn.RefreshTokenCollection.FindOne(context.TODO(), bson.D{{"tokenHash", hashRefreshToken(token)}}).Decode(&r.RefreshToken)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("invalid refresh token")
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	return r.RevokeFamily(r.RefreshToken.Family)
+}
+
+func (r RefreshTokenRepoImpl) RevokeAllByUserId(userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"userId", userId}}
+	update := bson.D{{"$set", bson.D{{"revoked", true}, {"updatedAt", time.Now()}}}}
+
+	_, err := conn.RefreshTokenCollection.UpdateMany(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func generateRefreshToken() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return fmt.Sprintf("%x", h)
+}
+
+func NewRefreshTokenRepoImpl() RefreshTokenRepoImpl {
+	var refreshTokenRepoImpl RefreshTokenRepoImpl
+
+	return refreshTokenRepoImpl
+}
@@ -39,13 +39,15 @@ func (r ReplyRepoImpl) Create(comment *domain.Reply) error {
 		return err
 	}
 
+	NotifyMentions(comment.AuthorUsername, comment.Content, "/stories/"+commentObj.ResourceId.Hex())
+
 	return nil
 }
 
 func (r ReplyRepoImpl) FindAllRepliesByResourceId(resourceID primitive.ObjectID, username string) (*[]domain.Reply, error) {
 	conn := database.MongoConn
 
-	cur, err := conn.RepliesCollection.Find(context.TODO(), bson.D{{"resourceId", resourceID}})
+	cur, err := conn.RepliesCollection.Find(context.TODO(), bson.M{"resourceId": resourceID, "authorDeactivated": bson.M{"$ne": true}})
 
 	if err != nil {
 		// ErrNoDocuments means that the filter did not match any documents in the collection
@@ -167,6 +169,8 @@ func (r ReplyRepoImpl) LikeReplyById(commentId primitive.ObjectID, username stri
 		return fmt.Errorf("failed to like comment")
 	}
 
+	RefreshReputation(r.Reply.AuthorUsername)
+
 	return nil
 }
 
@@ -242,6 +246,8 @@ func (r ReplyRepoImpl) DisLikeReplyById(commentId primitive.ObjectID, username s
 		return fmt.Errorf("failed to dislike comment")
 	}
 
+	RefreshReputation(r.Reply.AuthorUsername)
+
 	return nil
 }
 
@@ -260,7 +266,12 @@ func (r ReplyRepoImpl) UpdateFlagCount(flag *domain.Flag) error {
 	}
 
 	if !cur.Next(context.TODO()) {
-		flag.Id = primitive.NewObjectID()
+		err = newFlag(flag, conn.RepliesCollection)
+
+		if err != nil {
+			return err
+		}
+
 		_, err = conn.FlagCollection.InsertOne(context.TODO(), &flag)
 
 		return nil
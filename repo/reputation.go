@@ -0,0 +1,202 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"math"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"time"
+)
+
+// reputationBatch how many users the recompute job updates per bulk write
+const reputationBatch = 500
+
+// StartReputationRecompute recomputes every user's reputation every interval, until the process exits. Between
+// runs only the users whose content is liked, disliked or flagged are refreshed, the job is what applies the decay.
+func StartReputationRecompute(interval time.Duration) {
+	go func() {
+		for {
+			err := RecomputeAllReputations()
+
+			if err != nil {
+				log.Println("reputation recompute:", err)
+			}
+
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// RefreshReputation recomputes the user's reputation in the background, it never holds up or fails the request
+// that caused it
+func RefreshReputation(username string) {
+	if username == "" || username == domain.DeletedUsername {
+		return
+	}
+
+	go func() {
+		err := recomputeReputation(username)
+
+		if err != nil {
+			log.Printf("reputation %v: %v", username, err)
+		}
+	}()
+}
+
+func recomputeReputation(username string) error {
+	conn := database.MongoConn
+
+	scores, err := reputationScores(username)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"username", username}},
+		bson.D{{"$set", bson.D{{"reputation", roundReputation(scores[username])}, {"reputationUpdatedAt", time.Now()}}}})
+
+	return err
+}
+
+// RecomputeAllReputations backfills and decays the reputation of every user, users without any activity get 0
+func RecomputeAllReputations() error {
+	conn := database.MongoConn
+
+	scores, err := reputationScores("")
+
+	if err != nil {
+		return err
+	}
+
+	cur, err := conn.UserCollection.Find(context.TODO(), bson.D{},
+		options.Find().SetProjection(bson.D{{"username", 1}, {"reputation", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	defer cur.Close(context.TODO())
+
+	now := time.Now()
+	models := make([]mongo.WriteModel, 0, reputationBatch)
+
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+
+		_, err := conn.UserCollection.BulkWrite(context.TODO(), models, options.BulkWrite().SetOrdered(false))
+		models = models[:0]
+
+		return err
+	}
+
+	for cur.Next(context.TODO()) {
+		var user domain.User
+
+		if err = cur.Decode(&user); err != nil {
+			return err
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.D{{"_id", user.Id}}).
+			SetUpdate(bson.D{{"$set", bson.D{{"reputation", roundReputation(scores[user.Username])}, {"reputationUpdatedAt", now}}}}))
+
+		if len(models) == reputationBatch {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// reputationScores adds up the decayed likes, dislikes and upheld flags per username, for one user or for everyone
+// when username is empty
+func reputationScores(username string) (map[string]float64, error) {
+	conn := database.MongoConn
+
+	now := time.Now()
+
+	author := bson.D{{"authorUsername", bson.D{{"$ne", domain.DeletedUsername}}}}
+	flagged := bson.D{{"status", domain.FlagStatusUpheld}, {"flaggedUsername", bson.D{{"$ne", ""}}}}
+
+	if username != "" {
+		author = bson.D{{"authorUsername", username}}
+		flagged = bson.D{{"status", domain.FlagStatusUpheld}, {"flaggedUsername", username}}
+	}
+
+	sources := []struct {
+		Collection *mongo.Collection
+		Pipeline   mongo.Pipeline
+	}{
+		{conn.StoryCollection, reactionPipeline(author, domain.ReputationStoryLike, domain.ReputationStoryDislike, now)},
+		{conn.CommentsCollection, reactionPipeline(author, domain.ReputationCommentLike, domain.ReputationCommentDislike, now)},
+		{conn.RepliesCollection, reactionPipeline(author, domain.ReputationCommentLike, domain.ReputationCommentDislike, now)},
+		{conn.FlagCollection, mongo.Pipeline{
+			{{"$match", flagged}},
+			{{"$group", bson.D{{"_id", "$flaggedUsername"}, {"score", bson.D{{"$sum", bson.D{{"$multiply", bson.A{
+				domain.ReputationUpheldFlag, decayFactor("$reviewedAt", now),
+			}}}}}}}}},
+		}},
+	}
+
+	scores := make(map[string]float64)
+
+	for _, source := range sources {
+		cur, err := source.Collection.Aggregate(context.TODO(), source.Pipeline)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var results []struct {
+			Username string  `bson:"_id"`
+			Score    float64 `bson:"score"`
+		}
+
+		if err = cur.All(context.TODO(), &results); err != nil {
+			return nil, err
+		}
+
+		for _, r := range results {
+			scores[r.Username] += r.Score
+		}
+	}
+
+	return scores, nil
+}
+
+// reactionPipeline sums likeCount * like + dislikeCount * dislike per author, decayed by the age of the content
+func reactionPipeline(match bson.D, like float64, dislike float64, now time.Time) mongo.Pipeline {
+	points := bson.D{{"$add", bson.A{
+		bson.D{{"$multiply", bson.A{bson.D{{"$ifNull", bson.A{"$likeCount", 0}}}, like}}},
+		bson.D{{"$multiply", bson.A{bson.D{{"$ifNull", bson.A{"$dislikeCount", 0}}}, dislike}}},
+	}}}
+
+	return mongo.Pipeline{
+		{{"$match", match}},
+		{{"$group", bson.D{{"_id", "$authorUsername"}, {"score", bson.D{{"$sum", bson.D{{"$multiply", bson.A{
+			points, decayFactor("$createdAt", now),
+		}}}}}}}}},
+	}
+}
+
+// decayFactor is 0.5 ^ (age / half life), anything without a date counts in full
+func decayFactor(field string, now time.Time) bson.D {
+	age := bson.D{{"$subtract", bson.A{now, bson.D{{"$ifNull", bson.A{field, now}}}}}}
+
+	return bson.D{{"$pow", bson.A{0.5, bson.D{{"$divide", bson.A{age, float64(domain.ReputationHalfLife.Milliseconds())}}}}}}
+}
+
+func roundReputation(score float64) int {
+	return int(math.Round(score))
+}
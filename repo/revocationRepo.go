@@ -0,0 +1,15 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+type RevocationRepo interface {
+	Revoke(jti string, userId primitive.ObjectID, expiresAt time.Time) error
+	RevokeAllByUserId(userId primitive.ObjectID) error
+	RevokeSession(sessionId primitive.ObjectID, userId primitive.ObjectID) error
+	// IsRevoked sessionId is the "sid" claim, empty for tokens without one. issuedAtMs is when the token was issued,
+	// in milliseconds.
+	IsRevoked(jti string, sessionId string, userId primitive.ObjectID, issuedAtMs int64) (bool, error)
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"strconv"
+	"time"
+)
+
+type RevocationRepoImpl struct {
+	RevokedToken domain.RevokedToken
+}
+
+func (r RevocationRepoImpl) Revoke(jti string, userId primitive.ObjectID, expiresAt time.Time) error {
+	conn := database.MongoConn
+
+	r.RevokedToken.Id = primitive.NewObjectID()
+	r.RevokedToken.Jti = jti
+	r.RevokedToken.UserId = userId
+	r.RevokedToken.ExpiresAt = expiresAt
+	r.RevokedToken.CreatedAt = time.Now()
+
+	_, err := conn.RevokedTokenCollection.InsertOne(context.TODO(), &r.RevokedToken)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+// RevokeAllByUserId revokes every access token the user was issued up to now
+func (r RevocationRepoImpl) RevokeAllByUserId(userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	e, err := strconv.Atoi(config.Config("EXPIRATION"))
+
+	if err != nil {
+		return err
+	}
+
+	opts := options.Update().SetUpsert(true)
+	// the user-wide document, never a single token's or a session's
+	filter := bson.M{"userId": userId, "jti": bson.M{"$exists": false}, "sessionId": bson.M{"$exists": false}}
+	update := bson.M{
+		"$set": bson.M{
+			"revokedBeforeMs": domain.UnixMs(time.Now()),
+			"expiresAt":       time.Now().Add(time.Duration(e) * time.Minute),
+		},
+		"$unset":       bson.M{"revokedBefore": ""},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "createdAt": time.Now()},
+	}
+
+	_, err = conn.RevokedTokenCollection.UpdateOne(context.TODO(), filter, update, opts)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+// RevokeSession revokes every access token of a terminated session, refreshing it is already refused so the
+// revocation only has to last as long as an access token
+func (r RevocationRepoImpl) RevokeSession(sessionId primitive.ObjectID, userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	e, err := strconv.Atoi(config.Config("EXPIRATION"))
+
+	if err != nil {
+		return err
+	}
+
+	opts := options.Update().SetUpsert(true)
+	filter := bson.M{"sessionId": sessionId}
+	update := bson.M{
+		"$set":         bson.M{"userId": userId, "expiresAt": time.Now().Add(time.Duration(e) * time.Minute)},
+		"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "createdAt": time.Now()},
+	}
+
+	_, err = conn.RevokedTokenCollection.UpdateOne(context.TODO(), filter, update, opts)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+// IsRevoked checks the token, its session and logouts everywhere in one query. A token issued in the same
+// millisecond as a logout everywhere counts as revoked.
+func (r RevocationRepoImpl) IsRevoked(jti string, sessionId string, userId primitive.ObjectID, issuedAtMs int64) (bool, error) {
+	conn := database.MongoConn
+
+	or := []interface{}{
+		bson.M{"jti": jti},
+		bson.M{"userId": userId, "revokedBeforeMs": bson.M{"$gte": issuedAtMs}},
+		// revocations in whole seconds from before, they expire with the tokens they cover
+		bson.M{"userId": userId, "revokedBefore": bson.M{"$gte": issuedAtMs / 1000}},
+	}
+
+	if sid, err := primitive.ObjectIDFromHex(sessionId); err == nil {
+		or = append(or, bson.M{"sessionId": sid})
+	}
+
+	opts := options.Count().SetLimit(1)
+	count, err := conn.RevokedTokenCollection.CountDocuments(context.TODO(), bson.M{"$or": or}, opts)
+
+	if err != nil {
+		return false, fmt.Errorf("error processing data")
+	}
+
+	return count > 0, nil
+}
+
+func NewRevocationRepoImpl() RevocationRepoImpl {
+	var revocationRepoImpl RevocationRepoImpl
+
+	return revocationRepoImpl
+}
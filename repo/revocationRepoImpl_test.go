@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"os"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"testing"
+)
+
+func TestRevokeAllKeepsSessionRevocations(t *testing.T) {
+	requireDB(t)
+
+	_ = os.Setenv("EXPIRATION", "15")
+	defer os.Unsetenv("EXPIRATION")
+
+	userId := primitive.NewObjectID()
+	sessionId := primitive.NewObjectID()
+
+	if err := (RevocationRepoImpl{}).RevokeSession(sessionId, userId); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (RevocationRepoImpl{}).RevokeAllByUserId(userId); err != nil {
+		t.Fatal(err)
+	}
+
+	var session domain.RevokedToken
+
+	err := database.MongoConn.RevokedTokenCollection.FindOne(context.TODO(), bson.D{{"sessionId", sessionId}}).Decode(&session)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session.RevokedBeforeMs != 0 {
+		t.Error("expected logging out everywhere to leave the session revocation alone")
+	}
+
+	count, err := database.MongoConn.RevokedTokenCollection.CountDocuments(context.TODO(), bson.D{{"userId", userId}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 {
+		t.Errorf("expected a session and a user-wide revocation, got %v documents", count)
+	}
+}
@@ -0,0 +1,15 @@
+package repo
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+)
+
+type SessionRepo interface {
+	Create(id primitive.ObjectID, userId primitive.ObjectID, ip string, userAgent string) error
+	FindAllByUserId(userId primitive.ObjectID) (*[]domain.Session, error)
+	Seen(id primitive.ObjectID) error
+	Refresh(id primitive.ObjectID, ip string) error
+	Terminate(id primitive.ObjectID, userId primitive.ObjectID) error
+	TerminateAllByUserId(userId primitive.ObjectID) error
+}
@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"story-app-monolith/config"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"story-app-monolith/util"
+	"strconv"
+	"time"
+)
+
+// lastSeenPrecision keeps Seen from writing to the database on every single request, the middleware only calls it
+// this often per session as well
+const lastSeenPrecision = 5 * time.Minute
+
+type SessionRepoImpl struct {
+	Session     domain.Session
+	SessionList []domain.Session
+}
+
+func (s SessionRepoImpl) Create(id primitive.ObjectID, userId primitive.ObjectID, ip string, userAgent string) error {
+	conn := database.MongoConn
+
+	expiresAt, err := sessionExpiration()
+
+	if err != nil {
+		return err
+	}
+
+	s.Session.Id = id
+	s.Session.UserId = userId
+	s.Session.Ip = ip
+	s.Session.UserAgent = userAgent
+	s.Session.Device = util.DescribeUserAgent(userAgent)
+	s.Session.CreatedAt = time.Now()
+	s.Session.LastSeenAt = time.Now()
+	s.Session.ExpiresAt = expiresAt
+
+	_, err = conn.SessionCollection.InsertOne(context.TODO(), &s.Session)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (s SessionRepoImpl) FindAllByUserId(userId primitive.ObjectID) (*[]domain.Session, error) {
+	conn := database.MongoConn
+
+	findOptions := options.Find().SetSort(bson.D{{"lastSeenAt", -1}})
+
+	cur, err := conn.SessionCollection.Find(context.TODO(), bson.M{
+		"userId":     userId,
+		"terminated": false,
+		"expiresAt":  bson.M{"$gt": time.Now()},
+	}, findOptions)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	s.SessionList = make([]domain.Session, 0)
+	if err = cur.All(context.TODO(), &s.SessionList); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &s.SessionList, nil
+}
+
+func (s SessionRepoImpl) Seen(id primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	filter := bson.M{"_id": id, "lastSeenAt": bson.M{"$lt": time.Now().Add(-lastSeenPrecision)}}
+	update := bson.D{{"$set", bson.D{{"lastSeenAt", time.Now()}}}}
+
+	_, err := conn.SessionCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+// Refresh keeps the session alive for as long as its newest refresh token
+func (s SessionRepoImpl) Refresh(id primitive.ObjectID, ip string) error {
+	conn := database.MongoConn
+
+	expiresAt, err := sessionExpiration()
+
+	if err != nil {
+		return err
+	}
+
+	filter := bson.D{{"_id", id}, {"terminated", false}}
+	update := bson.D{{"$set", bson.D{{"ip", ip}, {"lastSeenAt", time.Now()}, {"expiresAt", expiresAt}}}}
+
+	res, err := conn.SessionCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("session has been terminated")
+	}
+
+	return nil
+}
+
+func (s SessionRepoImpl) Terminate(id primitive.ObjectID, userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"_id", id}, {"userId", userId}}
+	update := bson.D{{"$set", bson.D{{"terminated", true}}}}
+
+	res, err := conn.SessionCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("session not found")
+	}
+
+	// the access tokens of the session are refused by the revocation check every request already does
+	err = RevocationRepoImpl{}.RevokeSession(id, userId)
+
+	if err != nil {
+		return err
+	}
+
+	return RefreshTokenRepoImpl{}.RevokeFamily(id)
+}
+
+func (s SessionRepoImpl) TerminateAllByUserId(userId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"userId", userId}}
+	update := bson.D{{"$set", bson.D{{"terminated", true}}}}
+
+	_, err := conn.SessionCollection.UpdateMany(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return RefreshTokenRepoImpl{}.RevokeAllByUserId(userId)
+}
+
+func sessionExpiration() (time.Time, error) {
+	expiration, err := strconv.Atoi(config.Config("REFRESH_TOKEN_EXPIRATION"))
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Now().Add(time.Duration(expiration) * time.Minute), nil
+}
+
+func NewSessionRepoImpl() SessionRepoImpl {
+	var sessionRepoImpl SessionRepoImpl
+
+	return sessionRepoImpl
+}
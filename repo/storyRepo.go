@@ -8,8 +8,11 @@ import (
 type StoryRepo interface {
 	Create(story *domain.CreateStoryDto) error
 	UpdateById(primitive.ObjectID, string, string, string, *domain.Tag, bool) error
-	FindAll(string, bool) (*domain.StoryList, error)
+	FindAll(string, bool, string) (*domain.StoryList, error)
 	FindAllByUsername(string) (*[]domain.StoryDto, error)
+	FindPageByUsername(string, string) (*domain.StoryList, error)
+	FindPinned(string, []primitive.ObjectID) ([]domain.StoryPreviewDto, error)
+	AuthorStats(string) (*domain.AuthorStats, error)
 	FeaturedStories() (*[]domain.FeaturedStoryDto, error)
 	LikeStoryById(primitive.ObjectID, string) error
 	DisLikeStoryById(primitive.ObjectID, string) error
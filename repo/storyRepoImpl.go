@@ -5,6 +5,7 @@ import (
 	"story-app-monolith/database"
 	"story-app-monolith/domain"
 	helper "story-app-monolith/helpers"
+	"story-app-monolith/keyring"
 
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
@@ -40,12 +41,33 @@ func (s StoryRepoImpl) Create(story *domain.CreateStoryDto) error {
 		story.Preview = story.Content
 	}
 
-	_, err := conn.StoryCollection.InsertOne(context.TODO(), &story)
+	var author domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", story.AuthorUsername}},
+		options.FindOne().SetProjection(bson.D{{"privacy.stories", 1}})).Decode(&author)
 
 	if err != nil {
 		return fmt.Errorf("error processing data")
 	}
 
+	if author.Privacy.Stories != domain.AudienceEveryone {
+		story.AuthorStoriesAudience = author.Privacy.Stories
+	}
+
+	_, err = conn.StoryCollection.InsertOne(context.TODO(), &story)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"username", story.AuthorUsername}}, bson.M{"$set": bson.M{"lastActiveAt": time.Now()}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	RecordActivity(story.AuthorUsername, domain.ActivityStoryCreated)
+
 	return nil
 }
 
@@ -77,7 +99,8 @@ func (s StoryRepoImpl) UpdateById(id primitive.ObjectID, newContent string, newT
 	return nil
 }
 
-func (s StoryRepoImpl) FindAll(page string, newStoriesQuery bool) (*domain.StoryList, error) {
+// FindAll leaves out the stories the user muted
+func (s StoryRepoImpl) FindAll(page string, newStoriesQuery bool, username string) (*domain.StoryList, error) {
 	conn := database.MongoConn
 
 	findOptions := options.FindOptions{}
@@ -94,7 +117,21 @@ func (s StoryRepoImpl) FindAll(page string, newStoriesQuery bool) (*domain.Story
 		findOptions.SetSort(bson.D{{"createdAt", -1}})
 	}
 
-	query := bson.M{}
+	mutes, err := MuteRepoImpl{}.Filter(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	visible, err := storiesAudienceQuery(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	query := mutedStoriesQuery(mutes)
+	query["authorDeactivated"] = bson.M{"$ne": true}
+	query["$or"] = visible
 
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -180,6 +217,119 @@ func (s StoryRepoImpl) FindAllByUsername(username string) (*[]domain.StoryDto, e
 	return &s.StoryDtoList, nil
 }
 
+// FindPageByUsername lists an author's stories newest first
+func (s StoryRepoImpl) FindPageByUsername(username string, page string) (*domain.StoryList, error) {
+	conn := database.MongoConn
+
+	findOptions := options.FindOptions{}
+	perPage := 10
+	pageNumber, err := strconv.Atoi(page)
+
+	if err != nil || pageNumber < 1 {
+		return nil, fmt.Errorf("page must be a number")
+	}
+	findOptions.SetSkip((int64(pageNumber) - 1) * int64(perPage))
+	findOptions.SetLimit(int64(perPage))
+	findOptions.SetSort(bson.D{{"createdAt", -1}})
+
+	query := bson.D{{"authorUsername", username}}
+
+	cur, err := conn.StoryCollection.Find(context.TODO(), query, &findOptions)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	s.StoryPreviews = make([]domain.StoryPreviewDto, 0)
+
+	if err = cur.All(context.TODO(), &s.StoryPreviews); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	count, err := conn.StoryCollection.CountDocuments(context.TODO(), query)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	s.StoryPreviewList.Stories = s.StoryPreviews
+	s.StoryPreviewList.NumberOfStories = count
+	s.StoryPreviewList.CurrentPage = pageNumber
+	s.StoryPreviewList.NumberOfPages = int((count + int64(perPage) - 1) / int64(perPage))
+
+	if s.StoryPreviewList.NumberOfPages == 0 {
+		s.StoryPreviewList.NumberOfPages = 1
+	}
+
+	return &s.StoryPreviewList, nil
+}
+
+// FindPinned keeps the order the stories were pinned in, stories that were deleted are skipped
+func (s StoryRepoImpl) FindPinned(username string, ids []primitive.ObjectID) ([]domain.StoryPreviewDto, error) {
+	conn := database.MongoConn
+
+	pinned := make([]domain.StoryPreviewDto, 0, len(ids))
+
+	if len(ids) == 0 {
+		return pinned, nil
+	}
+
+	cur, err := conn.StoryCollection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": ids}, "authorUsername": username})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if err = cur.All(context.TODO(), &s.StoryPreviews); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	for _, id := range ids {
+		for _, story := range s.StoryPreviews {
+			if story.Id == id {
+				pinned = append(pinned, story)
+			}
+		}
+	}
+
+	return pinned, nil
+}
+
+// AuthorStats sums the views, likes and dislikes of an author's stories
+func (s StoryRepoImpl) AuthorStats(username string) (*domain.AuthorStats, error) {
+	conn := database.MongoConn
+
+	pipeline := mongo.Pipeline{
+		{{"$match", bson.D{{"authorUsername", username}}}},
+		{{"$group", bson.D{
+			{"_id", nil},
+			{"storyCount", bson.D{{"$sum", 1}}},
+			{"totalViews", bson.D{{"$sum", "$views"}}},
+			{"totalLikes", bson.D{{"$sum", "$likeCount"}}},
+			{"totalDislikes", bson.D{{"$sum", "$dislikeCount"}}},
+		}}},
+	}
+
+	cur, err := conn.StoryCollection.Aggregate(context.TODO(), pipeline)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	results := make([]domain.AuthorStats, 0, 1)
+
+	if err = cur.All(context.TODO(), &results); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	// an author without stories has no group
+	if len(results) == 0 {
+		return &domain.AuthorStats{}, nil
+	}
+
+	return &results[0], nil
+}
+
 func (s StoryRepoImpl) FeaturedStories() (*[]domain.FeaturedStoryDto, error) {
 	conn := database.MongoConn
 
@@ -188,7 +338,14 @@ func (s StoryRepoImpl) FeaturedStories() (*[]domain.FeaturedStoryDto, error) {
 	findOptions.SetLimit(3)
 	findOptions.SetSort(bson.D{{"score", -1}})
 
-	cur, err := conn.StoryCollection.Find(context.TODO(), bson.M{}, &findOptions)
+	// featured stories are on a public page, only the ones for everyone
+	visible, err := storiesAudienceQuery("")
+
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := conn.StoryCollection.Find(context.TODO(), bson.M{"authorDeactivated": bson.M{"$ne": true}, "$or": visible}, &findOptions)
 
 	if err != nil {
 		return nil, err
@@ -281,6 +438,9 @@ func (s StoryRepoImpl) LikeStoryById(storyId primitive.ObjectID, username string
 		return fmt.Errorf("failed to like story")
 	}
 
+	RecordActivity(s.Story.AuthorUsername, domain.ActivityLikeReceived)
+	RefreshReputation(s.Story.AuthorUsername)
+
 	return nil
 }
 
@@ -357,13 +517,16 @@ func (s StoryRepoImpl) DisLikeStoryById(storyId primitive.ObjectID, username str
 		return fmt.Errorf("failed to dislike story")
 	}
 
+	RefreshReputation(s.Story.AuthorUsername)
+
 	return nil
 }
 
 func (s StoryRepoImpl) FindById(storyID primitive.ObjectID, username string, userIp string) (*domain.StoryDto, error) {
 	conn := database.MongoConn
 
-	err := conn.StoryCollection.FindOne(context.TODO(), bson.D{{"_id", storyID}}).Decode(&s.StoryDto)
+	// stories of deactivated authors are gone until they come back
+	err := conn.StoryCollection.FindOne(context.TODO(), bson.M{"_id": storyID, "authorDeactivated": bson.M{"$ne": true}}).Decode(&s.StoryDto)
 
 	if err != nil {
 		// ErrNoDocuments means that the filter did not match any documents in the collection
@@ -373,6 +536,19 @@ func (s StoryRepoImpl) FindById(storyID primitive.ObjectID, username string, use
 		return nil, fmt.Errorf("error processing data")
 	}
 
+	if s.StoryDto.AuthorStoriesAudience != "" {
+		status, err := FollowRepoImpl{}.Status(username, s.StoryDto.AuthorUsername)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the same as a story that isn't there, so the audience doesn't give away that it exists
+		if !domain.InAudience(s.StoryDto.AuthorStoriesAudience, s.StoryDto.AuthorUsername == username, status) {
+			return nil, mongo.ErrNoDocuments
+		}
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(3)
 
@@ -402,13 +578,22 @@ func (s StoryRepoImpl) FindById(storyID primitive.ObjectID, username string, use
 
 		identity := new(domain.Identity)
 
-		identityArr, err := hasher.SignToken([]byte(userIp))
+		k, err := keyring.For(keyring.Identity)
+
+		if err != nil {
+			log.Println("couldn't hash identity:", err)
+			return
+		}
+
+		// identities hashed with a key that is still on the keyring count as the same viewer
+		identityArr, err := k.SignAll([]byte(userIp))
 
 		if err != nil {
-			panic("Couldn't hash identity")
+			log.Println("couldn't hash identity:", err)
+			return
 		}
 
-		err = conn.IdentityCollection.FindOne(context.TODO(), bson.D{{"identifier", identityArr}, {"storyId", storyID}, {"username", username}}).Decode(&identity)
+		err = conn.IdentityCollection.FindOne(context.TODO(), bson.D{{"identifier", bson.M{"$in": identityArr}}, {"storyId", storyID}, {"username", username}}).Decode(&identity)
 
 		if err != nil {
 			_, err = conn.StoryCollection.UpdateOne(context.TODO(), bson.D{{"_id", storyID}}, bson.M{"$inc": bson.M{"views": 1}})
@@ -417,10 +602,11 @@ func (s StoryRepoImpl) FindById(storyID primitive.ObjectID, username string, use
 				fmt.Println(fmt.Sprintf("%v", err))
 			}
 
-			val, err := hasher.SignToken([]byte(userIp))
+			val, err := hasher.SignTokenFor(keyring.Identity, []byte(userIp))
 
 			if err != nil {
-				panic("Couldn't hash identity")
+				log.Println("couldn't hash identity:", err)
+				return
 			}
 
 			identity.Identifier = val
@@ -458,7 +644,12 @@ func (s StoryRepoImpl) UpdateFlagCount(flag *domain.Flag) error {
 	}
 
 	if !cur.Next(context.TODO()) {
-		flag.Id = primitive.NewObjectID()
+		err = newFlag(flag, conn.StoryCollection)
+
+		if err != nil {
+			return err
+		}
+
 		_, err = conn.FlagCollection.InsertOne(context.TODO(), &flag)
 
 		return nil
@@ -487,7 +678,7 @@ func (s StoryRepoImpl) DeleteById(id primitive.ObjectID, username string) error
 	// execute this code in a logical transaction
 	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
 		var wg sync.WaitGroup
-		wg.Add(4)
+		wg.Add(5)
 
 		go func() {
 			defer wg.Done()
@@ -523,6 +714,16 @@ func (s StoryRepoImpl) DeleteById(id primitive.ObjectID, username string) error
 			return
 		}()
 
+		go func() {
+			defer wg.Done()
+			_, err = conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"username", username}}, bson.M{"$pull": bson.M{"pinnedStories": id}})
+
+			if err != nil {
+				panic(err)
+			}
+			return
+		}()
+
 		go func() {
 			defer wg.Done()
 			err = CommentRepoImpl{}.DeleteManyById(id, username)
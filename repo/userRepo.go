@@ -7,27 +7,39 @@ import (
 )
 
 type UserRepo interface {
-	FindAll(primitive.ObjectID, string, context.Context, string) (*domain.UserResponse, error)
+	FindAll(primitive.ObjectID, string, string, context.Context, string) (*domain.UserResponse, error)
+	Search(primitive.ObjectID, string, string) (*domain.UserSearchList, error)
+	SuggestAuthors(primitive.ObjectID) (*[]domain.UserSearchResult, error)
 	FindAllBlockedUsers(primitive.ObjectID, context.Context, string) (*[]domain.UserDto, error)
 	Create(*domain.User) error
 	FindByID(primitive.ObjectID, context.Context) (*domain.UserDto, error)
 	FindByUsername(string, context.Context) (*domain.UserDto, error)
 	UpdateByID(primitive.ObjectID, *domain.User) (*domain.UserDto, error)
-	UpdateProfileVisibility(primitive.ObjectID, *domain.UpdateProfileVisibility, context.Context) error
-	UpdateMessageAcceptance(primitive.ObjectID, *domain.UpdateMessageAcceptance, context.Context) error
 	UpdateCurrentBadge(primitive.ObjectID, *domain.UpdateCurrentBadge, context.Context) error
-	UpdateProfilePicture(primitive.ObjectID, *domain.UpdateProfilePicture, context.Context) error
-	UpdateProfileBackgroundPicture(primitive.ObjectID, *domain.UpdateProfileBackgroundPicture, context.Context) error
+	UploadProfilePicture(primitive.ObjectID, []byte) (*domain.Image, error)
+	UploadProfileBackgroundPicture(primitive.ObjectID, []byte) (*domain.Image, error)
 	UpdateCurrentTagline(primitive.ObjectID, *domain.UpdateCurrentTagline, context.Context)  error
 	UpdateVerification(primitive.ObjectID, *domain.UpdateVerification) error
-	UpdateDisplayFollowerCount(primitive.ObjectID, *domain.UpdateDisplayFollowerCount) error
-	FollowUser(username string, currentUser string) error
-	UnfollowUser(username string, currentUser string) error
+	GetPrivacySettings(primitive.ObjectID) (*domain.PrivacySettings, error)
+	UpdatePrivacySettings(primitive.ObjectID, *domain.UpdatePrivacySettings) (*domain.PrivacySettings, error)
+	UpdateMagicLink(primitive.ObjectID, *domain.UpdateMagicLink) error
 	UpdatePassword(primitive.ObjectID, string) error
+	UpdateRole(string, *domain.UpdateRole) error
+	RequestEmailChange(primitive.ObjectID, *domain.UpdateEmail) error
+	ConfirmEmailChange(string) error
+	CancelEmailChange(string) error
+	ChangeUsername(primitive.ObjectID, *domain.UpdateUsername, string, string) (*domain.LoginResult, error)
+	ResolveUsername(string, string) (string, error)
+	FindUsernameHistory(primitive.ObjectID) (*[]domain.UsernameChange, error)
 	UpdateFlagCount(*domain.Flag) error
 	BlockUser(primitive.ObjectID, string, context.Context, string) error
 	UnblockUser(primitive.ObjectID, string, context.Context, string) error
-	GetCurrentUserProfile(string) (*domain.CurrentUserProfile, error)
-	GetUserProfile(string, string) (*domain.ViewUserProfile, error)
+	GetCurrentUserProfile(string, string) (*domain.CurrentUserProfile, error)
+	GetUserProfile(string, string, string) (*domain.ViewUserProfile, error)
+	FindReadActivity(string, string) (*domain.ReadActivity, error)
+	PinStory(primitive.ObjectID, string, primitive.ObjectID) error
+	UnpinStory(primitive.ObjectID, primitive.ObjectID) error
 	DeleteByID(primitive.ObjectID, context.Context, string) error
+	RestoreAccount(string) error
+	Deactivate(primitive.ObjectID, *domain.Deactivate) error
 }
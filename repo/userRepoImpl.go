@@ -3,18 +3,30 @@ package repo
 import (
 	"context"
 	"fmt"
+	"github.com/gofiber/fiber/v2/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readconcern"
 	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"golang.org/x/crypto/bcrypt"
 	"log"
+	"math"
+	"regexp"
+	"sort"
+	"story-app-monolith/blobstore"
+	"story-app-monolith/config"
 	"story-app-monolith/database"
 	"story-app-monolith/domain"
+	"story-app-monolith/keyring"
 	helper "story-app-monolith/helpers"
+	"story-app-monolith/images"
+	"story-app-monolith/mailer"
+	"story-app-monolith/passwords"
 	"story-app-monolith/util"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -29,7 +41,8 @@ type UserRepoImpl struct {
 	viewedUser  domain.ViewUserProfile
 }
 
-func (u UserRepoImpl) FindAll(id primitive.ObjectID, page string, ctx context.Context, username string) (*domain.UserResponse, error) {
+// FindAll sort can be domain.SortByReputation, otherwise the users come in no particular order
+func (u UserRepoImpl) FindAll(id primitive.ObjectID, page string, sort string, ctx context.Context, username string) (*domain.UserResponse, error) {
 	var currentUser *domain.UserDto
 
 	conn := database.MongoConn
@@ -51,13 +64,20 @@ func (u UserRepoImpl) FindAll(id primitive.ObjectID, page string, ctx context.Co
 	findOptions.SetSkip((int64(pageNumber) - 1) * int64(perPage))
 	findOptions.SetLimit(int64(perPage))
 
+	if sort == domain.SortByReputation {
+		findOptions.SetSort(bson.D{{"reputation", -1}, {"_id", 1}})
+	}
+
 	// Get all users
 	cur, err := conn.UserCollection.Find(ctx, bson.M{
-		"profileIsViewable": true,
+		"privacy.profile": domain.AudienceEveryone,
+		"pendingDeletion": bson.M{"$ne": true},
+		"deactivated":     bson.M{"$ne": true},
 		"$and": []interface{}{
 			bson.M{"_id": bson.M{"$ne": id}},
-			bson.M{"_id": bson.M{"$nin": currentUser.BlockByList}},
-			bson.M{"_id": bson.M{"$nin": currentUser.BlockList}},
+			// block lists hold usernames
+			bson.M{"username": bson.M{"$nin": currentUser.BlockByList}},
+			bson.M{"username": bson.M{"$nin": currentUser.BlockList}},
 		},
 	}, &findOptions)
 
@@ -74,7 +94,372 @@ func (u UserRepoImpl) FindAll(id primitive.ObjectID, page string, ctx context.Co
 	return &u.userResponse, nil
 }
 
-func (u UserRepoImpl) GetCurrentUserProfile(username string) (*domain.CurrentUserProfile, error) {
+const (
+	searchPerPage = 20
+	// searchPrefixMatches how many of the most followed users whose username starts with the search are ranked
+	searchPrefixMatches = 200
+	// searchFuzzyCandidates how many users that might match with a typo or by their tagline are ranked on top of those
+	searchFuzzyCandidates = 100
+	suggestedAuthors      = 10
+	suggestedFromViews    = 500
+	suggestedFromTags     = 3
+)
+
+// Search matches usernames by prefix or with a typo or two, and taglines by substring. Prefix matches are found first,
+// the fuzzy ones only among a limited set of the most followed candidates. Better matches come first, then more
+// followed and more recently active users. Users whose profile is visible to nobody are never found, the taglines and
+// pictures of the ones only visible to followers are only matched and shown for accepted followers.
+func (u UserRepoImpl) Search(id primitive.ObjectID, query string, page string) (*domain.UserSearchList, error) {
+	conn := database.MongoConn
+
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	if query == "" || len([]rune(query)) > 50 {
+		return nil, fmt.Errorf("search must be between 1 and 50 characters")
+	}
+
+	pageNumber, err := strconv.Atoi(page)
+
+	if err != nil || pageNumber < 1 {
+		return nil, fmt.Errorf("page must be a number")
+	}
+
+	var currentUser domain.User
+
+	err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&currentUser)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	excluded := bson.M{
+		"username":        bson.M{"$nin": append(append([]string{currentUser.Username}, currentUser.BlockList...), currentUser.BlockByList...)},
+		"pendingDeletion": bson.M{"$ne": true},
+		"deactivated":     bson.M{"$ne": true},
+		"privacy.profile": bson.M{"$ne": domain.AudienceNobody},
+	}
+
+	// anchored regexes use the username index, usernames are lowercase. Prefix matches are looked up on their own so
+	// they aren't crowded out by popular users that only match fuzzily.
+	candidates, err := searchCandidates(excluded, bson.M{"username": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query)}},
+		searchPrefixMatches)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// typos are only looked for among usernames with the same first letter, taglines by substring
+	fuzzy, err := searchCandidates(excluded, bson.M{"$or": bson.A{
+		bson.M{"username": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(string([]rune(query)[0]))}},
+		bson.M{"currentTagLine": primitive.Regex{Pattern: regexp.QuoteMeta(query), Options: "i"}},
+	}}, searchFuzzyCandidates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	following, err := conn.FollowCollection.Distinct(context.TODO(), "followeeUsername",
+		bson.D{{"followerUsername", currentUser.Username}, {"status", domain.FollowStatusAccepted}})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	statuses := make(map[string]string, len(following))
+
+	for _, username := range following {
+		if s, ok := username.(string); ok {
+			statuses[s] = domain.FollowStatusAccepted
+		}
+	}
+
+	seen := make(map[string]bool, len(candidates))
+
+	for _, candidate := range candidates {
+		seen[candidate.Username] = true
+	}
+
+	for _, candidate := range fuzzy {
+		if !seen[candidate.Username] {
+			seen[candidate.Username] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	type ranked struct {
+		user  domain.UserSearchResult
+		score float64
+	}
+
+	results := make([]ranked, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		// a tagline the searcher isn't allowed to see must not decide whether the user is found
+		candidate = searchResult(candidate, statuses[candidate.Username])
+		match := matchScore(query, candidate.Username, candidate.CurrentTagLine)
+
+		if match == 0 {
+			continue
+		}
+
+		results = append(results, ranked{candidate, match + popularityScore(candidate.FollowerCount, candidate.LastActiveAt)})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	list := domain.UserSearchList{Users: make([]domain.UserSearchResult, 0, searchPerPage), NumberOfUsers: len(results), CurrentPage: pageNumber}
+	list.NumberOfPages = (len(results) + searchPerPage - 1) / searchPerPage
+
+	if list.NumberOfPages == 0 {
+		list.NumberOfPages = 1
+	}
+
+	for i := (pageNumber - 1) * searchPerPage; i < len(results) && i < pageNumber*searchPerPage; i++ {
+		list.Users = append(list.Users, results[i].user)
+	}
+
+	return &list, nil
+}
+
+// searchCandidates the most followed users that match, up to limit
+func searchCandidates(excluded bson.M, match bson.M, limit int64) ([]domain.UserSearchResult, error) {
+	conn := database.MongoConn
+
+	findOptions := options.Find().SetSort(bson.D{{"followerCount", -1}}).SetLimit(limit)
+
+	cur, err := conn.UserCollection.Find(context.TODO(), bson.M{"$and": bson.A{excluded, match}}, findOptions)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	candidates := make([]domain.UserSearchResult, 0)
+
+	if err = cur.All(context.TODO(), &candidates); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return candidates, nil
+}
+
+// matchScore is 0 when the user doesn't match at all
+func matchScore(query string, username string, tagline string) float64 {
+	switch {
+	case username == query:
+		return 100
+	case strings.HasPrefix(username, query):
+		return 80
+	case strings.Contains(username, query):
+		return 60
+	}
+
+	score := 0.0
+
+	// typos are compared against the start of the username so longer usernames aren't penalized
+	prefix := username
+	if len([]rune(prefix)) > len([]rune(query)) {
+		prefix = string([]rune(prefix)[:len([]rune(query))])
+	}
+
+	maxEdits := 1
+	if len([]rune(query)) >= 6 {
+		maxEdits = 2
+	}
+
+	if len([]rune(query)) > 2 {
+		if d := util.EditDistance(query, prefix); d <= maxEdits {
+			score = 50 - float64(d)*10
+		}
+	}
+
+	if score == 0 && len([]rune(query)) > 1 && util.IsSubsequence(query, username) {
+		score = 25
+	}
+
+	if strings.Contains(strings.ToLower(tagline), query) {
+		score += 20
+	}
+
+	return score
+}
+
+// popularityScore grows slowly with followers so it only reorders users that match about as well
+func popularityScore(followerCount int, lastActiveAt time.Time) float64 {
+	score := math.Log1p(math.Max(float64(followerCount), 0)) * 3
+
+	switch since := time.Since(lastActiveAt); {
+	case since < 7*24*time.Hour:
+		score += 10
+	case since < 30*24*time.Hour:
+		score += 5
+	}
+
+	return score
+}
+
+// searchResult hides what the user doesn't want shown to the viewer, followStatus is the viewer's follow of the user
+func searchResult(user domain.UserSearchResult, followStatus string) domain.UserSearchResult {
+	user.IsPrivate = user.Privacy.Profile != domain.AudienceEveryone
+
+	if !domain.InAudience(user.Privacy.Profile, false, followStatus) {
+		user.CurrentTagLine = ""
+		user.ProfilePictureUrl = ""
+		user.CurrentBadgeUrl = ""
+	}
+
+	if !domain.InAudience(user.Privacy.FollowerCount, false, followStatus) {
+		user.FollowerCount = -1
+	}
+
+	return user
+}
+
+// SuggestAuthors finds authors writing in the tags of the stories the user viewed most, leaving out authors the
+// user already follows, blocked, was blocked by or muted. Users without any history get the most followed authors.
+func (u UserRepoImpl) SuggestAuthors(id primitive.ObjectID) (*[]domain.UserSearchResult, error) {
+	conn := database.MongoConn
+
+	var currentUser domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&currentUser)
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	excluded := append(append([]string{currentUser.Username}, currentUser.BlockList...), currentUser.BlockByList...)
+
+	following, err := conn.FollowCollection.Distinct(context.TODO(), "followeeUsername", bson.D{{"followerId", id}})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	for _, username := range following {
+		excluded = append(excluded, username.(string))
+	}
+
+	mutes, err := MuteRepoImpl{}.Filter(currentUser.Username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	excluded = append(excluded, mutes.Usernames...)
+
+	// the most recent views, ObjectIds grow with time
+	cur, err := conn.IdentityCollection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{"$match", bson.D{{"username", currentUser.Username}}}},
+		{{"$sort", bson.D{{"_id", -1}}}},
+		{{"$limit", suggestedFromViews}},
+		{{"$lookup", bson.D{{"from", "stories"}, {"localField", "storyId"}, {"foreignField", "_id"}, {"as", "story"}}}},
+		{{"$unwind", "$story"}},
+		{{"$group", bson.D{{"_id", "$story.tag.value"}, {"views", bson.D{{"$sum", 1}}}}}},
+		{{"$sort", bson.D{{"views", -1}}}},
+		{{"$limit", suggestedFromTags}},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	var tagViews []struct {
+		Tag string `bson:"_id"`
+	}
+
+	if err = cur.All(context.TODO(), &tagViews); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	tags := make([]string, 0, len(tagViews))
+	for _, t := range tagViews {
+		if t.Tag != "" && !helper.CurrentUserInteraction(mutes.Tags, strings.ToLower(t.Tag)) {
+			tags = append(tags, t.Tag)
+		}
+	}
+
+	authorTags := make(map[string][]string)
+	authors := make([]string, 0, suggestedAuthors)
+
+	if len(tags) > 0 {
+		cur, err = conn.StoryCollection.Aggregate(context.TODO(), mongo.Pipeline{
+			{{"$match", bson.D{{"tag.value", bson.D{{"$in", tags}}}, {"authorUsername", bson.D{{"$nin", excluded}}},
+				{"authorDeactivated", bson.D{{"$ne", true}}}}}},
+			{{"$group", bson.D{
+				{"_id", "$authorUsername"},
+				{"stories", bson.D{{"$sum", 1}}},
+				{"views", bson.D{{"$sum", "$views"}}},
+				{"tags", bson.D{{"$addToSet", "$tag.value"}}},
+			}}},
+			{{"$sort", bson.D{{"stories", -1}, {"views", -1}}}},
+			{{"$limit", suggestedAuthors}},
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("error processing data")
+		}
+
+		var authorStats []struct {
+			Username string   `bson:"_id"`
+			Tags     []string `bson:"tags"`
+		}
+
+		if err = cur.All(context.TODO(), &authorStats); err != nil {
+			return nil, fmt.Errorf("error processing data")
+		}
+
+		for _, a := range authorStats {
+			authors = append(authors, a.Username)
+			authorTags[a.Username] = a.Tags
+		}
+	}
+
+	filter := bson.M{"username": bson.M{"$in": authors}, "privacy.profile": bson.M{"$ne": domain.AudienceNobody},
+		"pendingDeletion": bson.M{"$ne": true}, "deactivated": bson.M{"$ne": true}}
+
+	if len(authors) == 0 {
+		filter = bson.M{"username": bson.M{"$nin": excluded}, "privacy.profile": domain.AudienceEveryone, "pendingDeletion": bson.M{"$ne": true},
+			"deactivated": bson.M{"$ne": true}}
+	}
+
+	cur, err = conn.UserCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.D{{"followerCount", -1}}).SetLimit(suggestedAuthors))
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	users := make([]domain.UserSearchResult, 0, suggestedAuthors)
+
+	if err = cur.All(context.TODO(), &users); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	// keep the order of the authors
+	suggestions := make([]domain.UserSearchResult, 0, len(users))
+
+	if len(authors) == 0 {
+		for _, user := range users {
+			suggestions = append(suggestions, searchResult(user, ""))
+		}
+		return &suggestions, nil
+	}
+
+	for _, username := range authors {
+		for _, user := range users {
+			if user.Username == username {
+				user.Tags = authorTags[username]
+				// authors the user follows are never suggested
+				suggestions = append(suggestions, searchResult(user, ""))
+			}
+		}
+	}
+
+	return &suggestions, nil
+}
+
+func (u UserRepoImpl) GetCurrentUserProfile(username string, page string) (*domain.CurrentUserProfile, error) {
 	conn := database.MongoConn
 
 	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}}).Decode(&u.currentUser)
@@ -82,68 +467,232 @@ func (u UserRepoImpl) GetCurrentUserProfile(username string) (*domain.CurrentUse
 	if err != nil {
 		// ErrNoDocuments means that the filter did not match any documents in the collection
 		if err == mongo.ErrNoDocuments {
-			return nil, err
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, fmt.Errorf("error processing data")
 	}
 
-	stories, err := StoryRepoImpl{}.FindAllByUsername(username)
+	u.currentUser.PinnedStories, u.currentUser.Stories, u.currentUser.Stats, err = profileStories(username, u.currentUser.PinnedStoryIds, page)
 
 	if err != nil {
 		return nil, err
 	}
 
-	u.currentUser.Posts = *stories
-
 	return &u.currentUser, nil
 }
 
-func (u UserRepoImpl) GetUserProfile(username, currentUsername string) (*domain.ViewUserProfile, error) {
+// GetUserProfile a block in either direction hides the profile as if the user didn't exist
+func (u UserRepoImpl) GetUserProfile(username, currentUsername string, page string) (*domain.ViewUserProfile, error) {
 	conn := database.MongoConn
 
-	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", username}}).Decode(&u.viewedUser)
+	// accounts waiting to be purged and deactivated accounts are gone for everyone else
+	filter := bson.M{"username": username, "pendingDeletion": bson.M{"$ne": true}, "deactivated": bson.M{"$ne": true}}
+
+	err := conn.UserCollection.FindOne(context.TODO(), filter).Decode(&u.viewedUser)
 
 	if err != nil {
 		// ErrNoDocuments means that the filter did not match any documents in the collection
 		if err == mongo.ErrNoDocuments {
-			return nil, err
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, fmt.Errorf("error processing data")
 	}
 
-	if u.viewedUser.ProfileIsViewable == false {
-		return nil, fmt.Errorf("cannot view user")
+	if helper.CurrentUserInteraction(u.viewedUser.BlockList, currentUsername) || helper.CurrentUserInteraction(u.viewedUser.BlockByList, currentUsername) {
+		return nil, domain.ErrUserNotFound
 	}
 
-	if !u.viewedUser.DisplayFollowerCount {
+	status, err := FollowRepoImpl{}.Status(currentUsername, username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.viewedUser.IsFollowing = status == domain.FollowStatusAccepted
+	u.viewedUser.FollowRequested = status == domain.FollowStatusPending
+
+	privacy := u.viewedUser.Privacy
+	isOwner := username == currentUsername
+
+	if !domain.InAudience(privacy.Profile, isOwner, status) {
+		return nil, domain.ErrProfileNotViewable
+	}
+
+	if !domain.InAudience(privacy.FollowerCount, isOwner, status) {
 		u.viewedUser.FollowerCount = -1
 	}
 
+	u.viewedUser.PinnedStories, u.viewedUser.Stories, u.viewedUser.Stats, err = profileStories(username, u.viewedUser.PinnedStoryIds, page)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the stats stay, only the stories themselves are hidden
+	if !domain.InAudience(privacy.Stories, isOwner, status) {
+		u.viewedUser.PinnedStories = []domain.StoryPreviewDto{}
+		u.viewedUser.Stories = nil
+	}
+
+	return &u.viewedUser, nil
+}
+
+// profileStories loads the pinned stories, a page of stories and the stats of a profile at the same time
+func profileStories(username string, pinnedIds []primitive.ObjectID, page string) ([]domain.StoryPreviewDto, *domain.StoryList, *domain.AuthorStats, error) {
+	var pinned []domain.StoryPreviewDto
+	var stories *domain.StoryList
+	var stats *domain.AuthorStats
+	var pinnedErr, storiesErr, statsErr error
+
 	var wg sync.WaitGroup
-	wg.Add(2)
+	wg.Add(3)
 
 	go func() {
 		defer wg.Done()
-		stories, err := StoryRepoImpl{}.FindAllByUsername(username)
-
-		if err != nil {
-			panic(err)
-		}
-
-		u.viewedUser.Posts = *stories
+		pinned, pinnedErr = StoryRepoImpl{}.FindPinned(username, pinnedIds)
+	}()
 
-		return
+	go func() {
+		defer wg.Done()
+		stories, storiesErr = StoryRepoImpl{}.FindPageByUsername(username, page)
 	}()
 
 	go func() {
 		defer wg.Done()
-		u.viewedUser.IsFollowing = helper.CurrentUserInteraction(u.viewedUser.Followers, currentUsername)
-		return
+		stats, statsErr = StoryRepoImpl{}.AuthorStats(username)
 	}()
 
 	wg.Wait()
 
-	return &u.viewedUser, nil
+	for _, err := range []error{storiesErr, pinnedErr, statsErr} {
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return pinned, stories, stats, nil
+}
+
+// readActivityLimit how many of the stories read most recently are shown
+const readActivityLimit = 20
+
+// FindReadActivity the stories the user read most recently, for whoever can see the profile and is in the read
+// activity audience
+func (u UserRepoImpl) FindReadActivity(username string, currentUsername string) (*domain.ReadActivity, error) {
+	conn := database.MongoConn
+
+	var owner domain.User
+
+	filter := bson.M{"username": username, "pendingDeletion": bson.M{"$ne": true}, "deactivated": bson.M{"$ne": true}}
+
+	err := conn.UserCollection.FindOne(context.TODO(), filter).Decode(&owner)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	if helper.CurrentUserInteraction(owner.BlockList, currentUsername) || helper.CurrentUserInteraction(owner.BlockByList, currentUsername) {
+		return nil, domain.ErrUserNotFound
+	}
+
+	status, err := FollowRepoImpl{}.Status(currentUsername, username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	isOwner := username == currentUsername
+
+	if !domain.InAudience(owner.Privacy.Profile, isOwner, status) {
+		return nil, domain.ErrProfileNotViewable
+	}
+
+	if !domain.InAudience(owner.Privacy.ReadActivity, isOwner, status) {
+		return nil, domain.ErrReadActivityNotViewable
+	}
+
+	// the owner's reads can include stories the viewer isn't in the audience of
+	visible, err := storiesAudienceQuery(currentUsername)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a story read from several devices has several views, ObjectIds grow with time
+	cur, err := conn.IdentityCollection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{"$match", bson.D{{"username", username}}}},
+		{{"$group", bson.D{{"_id", "$storyId"}, {"readAt", bson.D{{"$max", "$_id"}}}}}},
+		{{"$sort", bson.D{{"readAt", -1}}}},
+		{{"$limit", readActivityLimit}},
+		{{"$lookup", bson.D{{"from", "stories"}, {"localField", "_id"}, {"foreignField", "_id"}, {"as", "story"}}}},
+		{{"$unwind", "$story"}},
+		{{"$replaceRoot", bson.D{{"newRoot", "$story"}}}},
+		{{"$match", bson.D{{"authorDeactivated", bson.D{{"$ne", true}}}, {"$or", visible}}}},
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	activity := domain.ReadActivity{Stories: make([]domain.StoryPreviewDto, 0, readActivityLimit)}
+
+	if err = cur.All(context.TODO(), &activity.Stories); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &activity, nil
+}
+
+// PinStory pins one of the user's own stories to the top of their profile
+func (u UserRepoImpl) PinStory(id primitive.ObjectID, username string, storyId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	count, err := conn.StoryCollection.CountDocuments(context.TODO(), bson.D{{"_id", storyId}, {"authorUsername", username}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if count == 0 {
+		return fmt.Errorf("story not found")
+	}
+
+	// the array index check keeps concurrent pins from going over the limit
+	filter := bson.M{"_id": id, fmt.Sprintf("pinnedStories.%d", domain.MaxPinnedStories-1): bson.M{"$exists": false}}
+	update := bson.M{"$addToSet": bson.M{"pinnedStories": storyId}, "$set": bson.M{"updatedAt": time.Now()}}
+
+	res, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("only %v stories can be pinned", domain.MaxPinnedStories)
+	}
+
+	return nil
+}
+
+func (u UserRepoImpl) UnpinStory(id primitive.ObjectID, storyId primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	res, err := conn.UserCollection.UpdateOne(context.TODO(), bson.D{{"_id", id}},
+		bson.M{"$pull": bson.M{"pinnedStories": storyId}, "$set": bson.M{"updatedAt": time.Now()}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	if res.ModifiedCount == 0 {
+		return fmt.Errorf("story isn't pinned")
+	}
+
+	return nil
 }
 
 func (u UserRepoImpl) FindAllBlockedUsers(id primitive.ObjectID, ctx context.Context, username string) (*[]domain.UserDto, error) {
@@ -193,6 +742,18 @@ func (u UserRepoImpl) Create(user *domain.User) error {
 	}
 	found := cur.Next(context.TODO())
 	if !found {
+		err = usernameIsAvailable(user.Username, primitive.NilObjectID)
+
+		if err != nil {
+			return err
+		}
+
+		user.Password, err = passwords.Hash(user.Password)
+
+		if err != nil {
+			return err
+		}
+
 		user.Id = primitive.NewObjectID()
 		_, err = conn.UserCollection.InsertOne(context.TODO(), &user)
 
@@ -241,7 +802,7 @@ func (u UserRepoImpl) FindByUsername(username string, ctx context.Context) (*dom
 
 	err := conn.UserCollection.FindOne(context.TODO(), bson.M{"username": username, "$and":
 	[]interface{}{
-		bson.M{"profileIsViewable": true,
+		bson.M{"privacy.profile": domain.AudienceEveryone,
 		},
 	}}).Decode(&u.userDto)
 
@@ -269,53 +830,228 @@ func (u UserRepoImpl) UpdateByID(id primitive.ObjectID, user *domain.User) (*dom
 	return &u.userDto, nil
 }
 
-func (u UserRepoImpl) UpdateProfileVisibility(id primitive.ObjectID, user *domain.UpdateProfileVisibility, ctx context.Context) error {
+func (u UserRepoImpl) GetPrivacySettings(id primitive.ObjectID) (*domain.PrivacySettings, error) {
+	conn := database.MongoConn
+
+	var user domain.User
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}},
+		options.FindOne().SetProjection(bson.D{{"privacy", 1}})).Decode(&user)
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &user.Privacy, nil
+}
+
+// UpdatePrivacySettings changes the audiences that were sent and returns all of them
+func (u UserRepoImpl) UpdatePrivacySettings(id primitive.ObjectID, update *domain.UpdatePrivacySettings) (*domain.PrivacySettings, error) {
+	conn := database.MongoConn
+
+	fields, err := update.Fields()
+
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.D{{"updatedAt", time.Now()}}
+
+	for field, audience := range fields {
+		set = append(set, bson.E{Key: "privacy." + field, Value: audience})
+	}
+
+	var user domain.User
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.D{{"username", 1}, {"privacy", 1}})
+
+	// the stories carry the audience too, they change with it
+	err = withTransaction(func(ctx mongo.SessionContext) error {
+		err := conn.UserCollection.FindOneAndUpdate(ctx, bson.D{{"_id", id}}, bson.D{{"$set", set}}, opts).Decode(&user)
+
+		if err != nil {
+			return err
+		}
+
+		if _, ok := fields["stories"]; !ok {
+			return nil
+		}
+
+		return syncStoriesAudience(ctx, user.Username, user.Privacy.Stories)
+	})
+
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &user.Privacy, nil
+}
+
+// UpdateCurrentBadge only unlocked badges can be picked, an empty url takes the badge off
+func (u UserRepoImpl) UpdateCurrentBadge(id primitive.ObjectID, user *domain.UpdateCurrentBadge, ctx context.Context) error {
 	conn := database.MongoConn
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
 	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"profileIsViewable", user.ProfileIsViewable}}}}
+
+	if user.CurrentBadgeUrl != "" {
+		filter = append(filter, bson.E{Key: "unlockedBadgesUrls", Value: user.CurrentBadgeUrl})
+	}
+
+	update := bson.D{{"$set", bson.D{{"currentBadgeUrl", user.CurrentBadgeUrl}, {"updatedAt", user.UpdatedAt}}}}
 
 	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+		filter, update).Decode(&u.userDto)
 
 	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return domain.ErrBadgeLocked
+		}
 		return err
 	}
 
-	u.userDto.ProfileIsViewable = user.ProfileIsViewable
-
+	u.userDto.CurrentBadgeUrl = user.CurrentBadgeUrl
 
 	return nil
 }
 
-func (u UserRepoImpl) UpdateMessageAcceptance(id primitive.ObjectID, user *domain.UpdateMessageAcceptance, ctx context.Context) error {
+func (u UserRepoImpl) UploadProfilePicture(id primitive.ObjectID, data []byte) (*domain.Image, error) {
+	return uploadUserImage(id, data, images.ProfilePicture, "profilePicture", "profilePictureUrl")
+}
+
+func (u UserRepoImpl) UploadProfileBackgroundPicture(id primitive.ObjectID, data []byte) (*domain.Image, error) {
+	return uploadUserImage(id, data, images.BackgroundPicture, "profileBackgroundPicture", "profileBackgroundPictureUrl")
+}
+
+// uploadUserImage stores every size before the user points at them and removes the old ones after, so the
+// profile never shows a missing picture. The largest size also goes in urlField for older clients.
+func uploadUserImage(id primitive.ObjectID, data []byte, spec images.Spec, field string, urlField string) (*domain.Image, error) {
 	conn := database.MongoConn
 
+	store, err := blobstore.Default()
+
+	if err != nil {
+		return nil, err
+	}
+
+	variants, err := images.Process(data, spec)
+
+	if err != nil {
+		return nil, err
+	}
+
+	name := primitive.NewObjectID().Hex()
+
+	image := domain.Image{Urls: make(map[string]string, len(variants)), Keys: make([]string, 0, len(variants))}
+
+	for _, variant := range variants {
+		key := fmt.Sprintf("users/%v/%v/%v-%d.%v", id.Hex(), field, name, variant.Width, variant.Extension)
+
+		err = store.Put(key, variant.Data, variant.ContentType)
+
+		if err != nil {
+			deleteBlobs(image.Keys)
+			return nil, err
+		}
+
+		image.Keys = append(image.Keys, key)
+		image.Urls[strconv.Itoa(variant.Width)] = store.URL(key)
+	}
+
+	var old domain.User
+
+	update := bson.D{{"$set", bson.D{{field, image}, {urlField, store.URL(image.Keys[0])}, {"updatedAt", time.Now()}}}}
+
+	err = conn.UserCollection.FindOneAndUpdate(context.TODO(), bson.D{{"_id", id}}, update,
+		options.FindOneAndUpdate().SetProjection(bson.D{{field, 1}})).Decode(&old)
+
+	if err != nil {
+		deleteBlobs(image.Keys)
+		return nil, err
+	}
+
+	if field == "profilePicture" {
+		deleteBlobs(old.ProfilePicture.Keys)
+	} else {
+		deleteBlobs(old.ProfileBackgroundPicture.Keys)
+	}
+
+	return &image, nil
+}
+
+// deleteBlobs is best effort, a leftover file is only wasted space
+func deleteBlobs(keys []string) {
+	store, err := blobstore.Default()
+
+	if err != nil {
+		log.Printf("deleting blobs %v: %v", keys, err)
+		return
+	}
+
+	for _, key := range keys {
+		err := store.Delete(key)
+
+		if err != nil {
+			log.Printf("deleting blob %v: %v", key, err)
+		}
+	}
+}
+
+// UpdateCurrentTagline only unlocked taglines can be picked, an empty tagline takes it off
+func (u UserRepoImpl) UpdateCurrentTagline(id primitive.ObjectID, user *domain.UpdateCurrentTagline, ctx context.Context) error {
+	conn := database.MongoConn
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
 	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"acceptMessages", user.AcceptMessages}}}}
+
+	if user.CurrentTagLine != "" {
+		filter = append(filter, bson.E{Key: "unlockedTagLine", Value: user.CurrentTagLine})
+	}
+
+	update := bson.D{{"$set", bson.D{{"currentTagLine", user.CurrentTagLine}, {"updatedAt", user.UpdatedAt}}}}
 
 	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+		filter, update).Decode(&u.userDto)
 
 	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return domain.ErrTagLineLocked
+		}
 		return err
 	}
 
-	u.userDto.AcceptMessages = user.AcceptMessages
+	u.userDto.CurrentTagLine = user.CurrentTagLine
 
 	return nil
 }
 
-func (u UserRepoImpl) UpdateCurrentBadge(id primitive.ObjectID, user *domain.UpdateCurrentBadge, ctx context.Context) error {
+func (u UserRepoImpl) UpdateMagicLink(id primitive.ObjectID, user *domain.UpdateMagicLink) error {
 	conn := database.MongoConn
 
+	filter := bson.D{{"_id", id}}
+	update := bson.D{{"$set", bson.D{{"magicLinkEnabled", user.MagicLinkEnabled}, {"updatedAt", user.UpdatedAt}}}}
+
+	_, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (u UserRepoImpl) UpdateVerification(id primitive.ObjectID, user *domain.UpdateVerification) error {
+	conn := database.MongoConn
 
 	opts := options.FindOneAndUpdate().SetUpsert(true)
 	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"currentBadgeUrl", user.CurrentBadgeUrl}}}}
+	update := bson.D{{"$set", bson.D{{"isVerified", user.IsVerified}}}}
 
 	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
 		filter, update, opts).Decode(&u.userDto)
@@ -324,121 +1060,222 @@ func (u UserRepoImpl) UpdateCurrentBadge(id primitive.ObjectID, user *domain.Upd
 		return err
 	}
 
-	u.userDto.CurrentBadgeUrl = user.CurrentBadgeUrl
+	u.userDto.IsVerified = user.IsVerified
+
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (u UserRepoImpl) UpdateProfilePicture(id primitive.ObjectID, user *domain.UpdateProfilePicture, ctx context.Context) error {
+// UpdatePassword takes the plain password, it is checked against the password policy and hashed here
+func (u UserRepoImpl) UpdatePassword(id primitive.ObjectID, password string) error {
 	conn := database.MongoConn
 
+	var user domain.User
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&user)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("error processing data")
+	}
+
+	err = passwords.Validate(password, user.Username, user.Email)
+
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := passwords.Hash(password)
+
+	if err != nil {
+		return err
+	}
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
 	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"profilePictureUrl", user.ProfilePictureUrl}}}}
+	update := bson.D{{"$set", bson.D{{"password", hashedPassword}, {"tokenHash", ""}, {"tokenExpiresAt", 0}, {"updatedAt", time.Now()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	return nil
+}
+
+func (u UserRepoImpl) UpdateRole(username string, role *domain.UpdateRole) error {
+	conn := database.MongoConn
+
+	filter := bson.D{{"username", username}}
+	update := bson.D{{"$set", bson.D{{"role", role.Role}, {"permissions", role.Permissions}, {"updatedAt", role.UpdatedAt}}}}
 
 	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+		filter, update).Decode(&u.userDto)
 
 	if err != nil {
-		return err
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("error processing data")
 	}
 
-	u.userDto.ProfilePictureUrl = user.ProfilePictureUrl
+	// roles are carried in the access token, revoke the old ones so the change applies on the next refresh
+	err = RevocationRepoImpl{}.RevokeAllByUserId(u.userDto.Id)
+
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
 
-func (u UserRepoImpl) UpdateProfileBackgroundPicture(id primitive.ObjectID, user *domain.UpdateProfileBackgroundPicture, ctx context.Context) error {
+// RequestEmailChange stores the new address as pending, it only replaces the current one once the link sent to it
+// is opened. The current address gets a notice with a link to cancel the change.
+func (u UserRepoImpl) RequestEmailChange(id primitive.ObjectID, email *domain.UpdateEmail) error {
 	conn := database.MongoConn
 
+	var user domain.User
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&user)
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"profileBackgroundPictureUrl", user.ProfileBackgroundPictureUrl}}}}
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("error processing data")
+	}
 
-	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(email.Password))
+
+	if err != nil {
+		return err
+	}
+
+	if user.Email == email.Email {
+		return fmt.Errorf("this is already your email")
+	}
+
+	err = emailIsAvailable(email.Email, id)
+
+	if err != nil {
+		return err
+	}
+
+	expiration, err := strconv.Atoi(config.Config("EMAIL_CHANGE_TOKEN_EXPIRATION"))
+
+	if err != nil {
+		return err
+	}
+
+	token, err := signedToken()
+
+	if err != nil {
+		return err
+	}
+
+	cancelToken, err := signedToken()
 
 	if err != nil {
 		return err
 	}
 
-	u.userDto.ProfileBackgroundPictureUrl = user.ProfileBackgroundPictureUrl
+	// a pending change that is being replaced keeps the verification state from before it was started
+	wasVerified := user.IsVerified
+	if user.PendingEmail != "" {
+		wasVerified = user.EmailWasVerified
+	}
 
-	return nil
-}
+	filter := bson.D{{"_id", id}}
+	update := bson.D{{"$set", bson.D{{"pendingEmail", email.Email}, {"emailChangeToken", token},
+		{"emailChangeCancelToken", cancelToken}, {"emailChangeExpiresAt", time.Now().Add(time.Duration(expiration) * time.Minute).Unix()},
+		{"emailWasVerified", wasVerified}, {"isVerified", false}, {"updatedAt", email.UpdatedAt}}}}
 
-func (u UserRepoImpl) UpdateCurrentTagline(id primitive.ObjectID, user *domain.UpdateCurrentTagline, ctx context.Context) error {
-	conn := database.MongoConn
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"currentTagLine", user.CurrentTagLine}}}}
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
 
-	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+	err = mailer.SendEmailChangeConfirmationEmail(email.Email, user.Username, token)
 
 	if err != nil {
 		return err
 	}
 
-	u.userDto.CurrentTagLine = user.CurrentTagLine
-
-	return nil
+	return mailer.SendEmailChangeNoticeEmail(user.Email, user.Username, email.Email, cancelToken)
 }
 
-func (u UserRepoImpl) UpdateDisplayFollowerCount(id primitive.ObjectID, user *domain.UpdateDisplayFollowerCount) error{
+// ConfirmEmailChange replaces the email with the pending one, opening the link also verifies the new address
+func (u UserRepoImpl) ConfirmEmailChange(token string) error {
 	conn := database.MongoConn
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"displayFollowerCount", user.DisplayFollowerCount}}}}
-
-	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+	var user domain.User
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"emailChangeToken", token}}).Decode(&user)
 
-	if err != nil {
+	if err != nil || token == "" {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments || token == "" {
+			return fmt.Errorf("no token found")
+		}
 		return err
 	}
 
-	u.userDto.DisplayFollowerCount = user.DisplayFollowerCount
-
-	return nil
-}
-
-func (u UserRepoImpl) UpdateVerification(id primitive.ObjectID, user *domain.UpdateVerification) error {
-	conn := database.MongoConn
-
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"isVerified", user.IsVerified}}}}
+	if user.EmailChangeExpiresAt < time.Now().Unix() {
+		return fmt.Errorf("token has expired")
+	}
 
-	err := conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts).Decode(&u.userDto)
+	// the address could have been taken while the change was pending
+	err = emailIsAvailable(user.PendingEmail, user.Id)
 
 	if err != nil {
 		return err
 	}
 
-	u.userDto.IsVerified = user.IsVerified
+	filter := bson.D{{"_id", user.Id}}
+	update := bson.D{{"$set", bson.D{{"email", user.PendingEmail}, {"isVerified", true}, {"pendingEmail", ""},
+		{"emailChangeToken", ""}, {"emailChangeCancelToken", ""}, {"emailChangeExpiresAt", 0},
+		{"emailWasVerified", false}, {"updatedAt", time.Now()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
 
 	if err != nil {
-		return err
+		return fmt.Errorf("error processing data")
 	}
 
 	return nil
 }
 
-func (u UserRepoImpl) UpdatePassword(id primitive.ObjectID, password string) error {
+// CancelEmailChange drops the pending email with the token sent to the current address
+func (u UserRepoImpl) CancelEmailChange(token string) error {
 	conn := database.MongoConn
 
-	opts := options.FindOneAndUpdate().SetUpsert(true)
-	filter := bson.D{{"_id", id}}
-	update := bson.D{{"$set", bson.D{{"password", password}, {"tokenHash", ""}, {"tokenExpiresAt", 0}, {"updatedAt", time.Now()}}}}
+	var user domain.User
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"emailChangeCancelToken", token}}).Decode(&user)
 
-	conn.UserCollection.FindOneAndUpdate(context.TODO(),
-		filter, update, opts)
+	if err != nil || token == "" {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments || token == "" {
+			return fmt.Errorf("no token found")
+		}
+		return err
+	}
+
+	filter := bson.D{{"_id", user.Id}}
+	update := bson.D{{"$set", bson.D{{"isVerified", user.EmailWasVerified}, {"pendingEmail", ""},
+		{"emailChangeToken", ""}, {"emailChangeCancelToken", ""}, {"emailChangeExpiresAt", 0},
+		{"emailWasVerified", false}, {"updatedAt", time.Now()}}}}
+
+	_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
 
 	return nil
 }
@@ -459,7 +1296,12 @@ func (u UserRepoImpl) UpdateFlagCount(flag *domain.Flag) error {
 
 	// todo send message
 	if !cur.Next(context.TODO()) {
-		flag.Id = primitive.NewObjectID()
+		err = newFlag(flag, nil)
+
+		if err != nil {
+			return err
+		}
+
 		_, err = conn.FlagCollection.InsertOne(context.TODO(), &flag)
 
 		if err != nil {
@@ -551,6 +1393,13 @@ func (u UserRepoImpl) BlockUser(id primitive.ObjectID, username string, ctx cont
 		return fmt.Errorf("failed to block user")
 	}
 
+	// neither user keeps following the other, pending requests go as well
+	err = FollowRepoImpl{}.RemoveEdges(id, u.userDto.Id)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
 	go func() {
 		user := new(domain.User)
 		err = conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", u.userDto.Username}}).Decode(user)
@@ -685,187 +1534,376 @@ func (u UserRepoImpl) UnblockUser(id primitive.ObjectID, username string, ctx co
 	return nil
 }
 
-func (u UserRepoImpl) FollowUser(username string, currentUser string) error {
+// DeleteByID schedules the account for deletion, it can be restored with the emailed link until the purge job
+// removes everything after domain.DeletionGracePeriod
+func (u UserRepoImpl) DeleteByID(id primitive.ObjectID, ctx context.Context, username string) error {
 	conn := database.MongoConn
 
-	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", currentUser}}).Decode(&u.user)
+	token, err := signedToken()
 
 	if err != nil {
-		return fmt.Errorf("error processing data")
+		return err
 	}
 
-	query := bson.M{"username": bson.M{"$in": u.user.Following}}
+	filter := bson.M{"_id": id, "pendingDeletion": bson.M{"$ne": true}}
+	update := bson.D{{"$set", bson.D{{"pendingDeletion", true},
+		{"deletionScheduledAt", time.Now().Add(domain.DeletionGracePeriod)},
+		{"deletionRestoreToken", token}, {"updatedAt", time.Now()}}}}
 
-	// Get all users
-	cur, err := conn.UserCollection.Find(context.TODO(), query)
+	err = conn.UserCollection.FindOneAndUpdate(context.TODO(), filter, update).Decode(&u.user)
 
 	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("account is already scheduled for deletion")
+		}
 		return fmt.Errorf("error processing data")
 	}
 
-	if cur.Next(context.TODO()){
-		return fmt.Errorf("you are already following this user")
-	}
+	// api keys don't come back with a restore
+	_, err = conn.ApiKeyCollection.UpdateMany(context.TODO(), bson.D{{"userId", id}, {"revoked", false}},
+		bson.D{{"$set", bson.D{{"revoked", true}}}})
 
-	// sets mongo's read and write concerns
-	wc := writeconcern.New(writeconcern.WMajority())
-	rc := readconcern.Snapshot()
-	txnOpts := options.Transaction().SetWriteConcern(wc).SetReadConcern(rc)
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
 
-	// set up for a transaction
-	session, err := conn.StartSession()
+	err = AuthRepoImpl{}.LogoutAll(id)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	defer session.EndSession(context.Background())
+	return mailer.SendAccountDeletionEmail(u.user.Email, u.user.Username, token)
+}
 
-	var user = new(domain.User)
-	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
-		filter := bson.D{{"username", currentUser}}
-		update := bson.M{"$push": bson.M{"following": username}}
+// RestoreAccount cancels a scheduled deletion with the token from the deletion email, the user signs in again after
+func (u UserRepoImpl) RestoreAccount(token string) error {
+	conn := database.MongoConn
 
-		_, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+	filter := bson.M{"deletionRestoreToken": token, "pendingDeletion": true, "deletionScheduledAt": bson.M{"$gt": time.Now()}}
+	update := bson.D{{"$set", bson.D{{"pendingDeletion", false}, {"deletionScheduledAt", time.Time{}},
+		{"deletionRestoreToken", ""}, {"updatedAt", time.Now()}}}}
 
-		if err != nil {
-			return nil, err
-		}
+	res, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
 
-		err = conn.UserCollection.FindOne(context.TODO(), filter).Decode(&u.user)
+	if res.MatchedCount == 0 || token == "" {
+		return fmt.Errorf("no token found")
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	return nil
+}
 
-		filter = bson.D{{"username", username}}
-		update = bson.M{"$push": bson.M{"followers": currentUser}, "$inc": bson.M{"followerCount": 1}}
+// Deactivate hides the user and everything they wrote until they log in again, nothing is deleted
+func (u UserRepoImpl) Deactivate(id primitive.ObjectID, deactivate *domain.Deactivate) error {
+	conn := database.MongoConn
 
-		_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&u.user)
 
-		if err != nil {
-			return nil, err
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return domain.ErrUserNotFound
 		}
+		return fmt.Errorf("error processing data")
+	}
 
-		err = conn.UserCollection.FindOne(context.TODO(), filter).Decode(&user)
+	err = bcrypt.CompareHashAndPassword([]byte(u.user.Password), []byte(deactivate.Password))
 
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return err
+	}
 
-		return nil, err
+	if u.user.Deactivated {
+		return domain.ErrAccountDeactivated
 	}
 
-	_, err = session.WithTransaction(context.Background(), callback, txnOpts)
+	err = withTransaction(func(ctx mongo.SessionContext) error {
+		return setDeactivated(ctx, &u.user, true)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return AuthRepoImpl{}.LogoutAll(id)
 }
 
-func (u UserRepoImpl) UnfollowUser(username string, currentUser string) error {
+// setDeactivated flips the user and the visibility of their stories, comments, replies and api keys together, it
+// runs in a transaction so the content never shows up half hidden
+func setDeactivated(ctx mongo.SessionContext, user *domain.User, deactivated bool) error {
 	conn := database.MongoConn
 
-	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"username", currentUser}}).Decode(&u.user)
+	// users from before deactivation existed have no field at all
+	filter := bson.D{{"_id", user.Id}, {"deactivated", bson.D{{"$ne", true}}}}
+	userUpdate := bson.D{{"$set", bson.D{{"deactivated", true}, {"deactivatedAt", time.Now()}, {"updatedAt", time.Now()}}}}
+	contentUpdate := bson.D{{"$set", bson.D{{"authorDeactivated", true}}}}
+	keyUpdate := bson.D{{"$set", bson.D{{"suspended", true}}}}
+
+	if !deactivated {
+		filter = bson.D{{"_id", user.Id}, {"deactivated", true}}
+		userUpdate = bson.D{{"$set", bson.D{{"deactivated", false}, {"deactivatedAt", time.Time{}}, {"reactivationToken", ""},
+			{"reactivationTokenExpiresAt", 0}, {"updatedAt", time.Now()}}}}
+		contentUpdate = bson.D{{"$unset", bson.D{{"authorDeactivated", ""}}}}
+		keyUpdate = bson.D{{"$unset", bson.D{{"suspended", ""}}}}
+	}
+
+	res, err := conn.UserCollection.UpdateOne(ctx, filter, userUpdate)
 
 	if err != nil {
-		return fmt.Errorf("error processing data")
+		return err
 	}
 
-	query := bson.M{"username": bson.M{"$in": u.user.Following}}
+	// someone else got there first
+	if res.MatchedCount == 0 {
+		if deactivated {
+			return domain.ErrAccountDeactivated
+		}
+		return fmt.Errorf("account is not deactivated")
+	}
 
-	// Get all users
-	cur, err := conn.UserCollection.Find(context.TODO(), query)
+	for _, collection := range []*mongo.Collection{conn.StoryCollection, conn.CommentsCollection, conn.RepliesCollection} {
+		_, err = collection.UpdateMany(ctx, bson.D{{"authorUsername", user.Username}}, contentUpdate)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.ApiKeyCollection.UpdateMany(ctx, bson.D{{"userId", user.Id}}, keyUpdate)
+
+	return err
+}
+
+// ChangeUsername renames the user right away, the references to the old username are migrated in the background.
+// Every session is signed out because the tokens carry the username, the caller gets a new one.
+func (u UserRepoImpl) ChangeUsername(id primitive.ObjectID, username *domain.UpdateUsername, ip string, userAgent string) (*domain.LoginResult, error) {
+	conn := database.MongoConn
+
+	err := conn.UserCollection.FindOne(context.TODO(), bson.D{{"_id", id}}).Decode(&u.user)
 
 	if err != nil {
-		return fmt.Errorf("error processing data")
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error processing data")
 	}
 
-	if !cur.Next(context.TODO()){
-		return fmt.Errorf("you are not following this user")
+	err = bcrypt.CompareHashAndPassword([]byte(u.user.Password), []byte(username.Password))
+
+	if err != nil {
+		return nil, err
 	}
 
-	// sets mongo's read and write concerns
-	wc := writeconcern.New(writeconcern.WMajority())
-	rc := readconcern.Snapshot()
-	txnOpts := options.Transaction().SetWriteConcern(wc).SetReadConcern(rc)
+	if u.user.Username == username.Username {
+		return nil, fmt.Errorf("this is already your username")
+	}
 
-	// set up for a transaction
-	session, err := conn.StartSession()
+	count, err := conn.UsernameChangeCollection.CountDocuments(context.TODO(), bson.M{"userId": id,
+		"createdAt": bson.M{"$gt": time.Now().Add(-domain.UsernameChangeInterval)}})
 
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("error processing data")
 	}
 
-	defer session.EndSession(context.Background())
+	if count > 0 {
+		return nil, fmt.Errorf("you can only change your username once every %v days", int(domain.UsernameChangeInterval.Hours()/24))
+	}
 
-	var user = new(domain.User)
-	callback := func(sessionContext mongo.SessionContext) (interface{}, error) {
-		filter := bson.D{{"username", currentUser}}
-		update := bson.M{"$pull": bson.M{"following": username}}
+	err = usernameIsAvailable(username.Username, id)
 
-		_, err := conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	change := domain.UsernameChange{Id: primitive.NewObjectID(), UserId: id, OldUsername: u.user.Username,
+		NewUsername: username.Username, CurrentUsername: username.Username,
+		ReservedUntil: time.Now().Add(domain.UsernameReservation), CreatedAt: time.Now()}
 
-		err = conn.UserCollection.FindOne(context.TODO(), filter).Decode(&u.user)
+	err = withTransaction(func(ctx mongo.SessionContext) error {
+		// the unique index on username catches a name taken since the check
+		res, err := conn.UserCollection.UpdateOne(ctx, bson.D{{"_id", id}, {"username", change.OldUsername}},
+			bson.D{{"$set", bson.D{{"username", change.NewUsername}, {"updatedAt", time.Now()}}}})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		filter = bson.D{{"username", username}}
+		if res.MatchedCount == 0 {
+			return mongo.ErrNoDocuments
+		}
 
-		err = conn.UserCollection.FindOne(context.TODO(), filter).Decode(&user)
+		_, err = conn.UsernameChangeCollection.InsertOne(ctx, &change)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		update = bson.M{"$pull": bson.M{"followers": currentUser}, "$set": bson.M{"followerCount": user.FollowerCount - 1}}
+		// earlier usernames resolve to the new one too
+		_, err = conn.UsernameChangeCollection.UpdateMany(ctx, bson.D{{"userId", id}},
+			bson.D{{"$set", bson.D{{"currentUsername", change.NewUsername}}}})
 
-		_, err = conn.UserCollection.UpdateOne(context.TODO(), filter, update)
+		return err
+	})
 
-		if err != nil {
-			return nil, err
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, domain.ErrUsernameTaken
 		}
+		return nil, fmt.Errorf("error processing data")
+	}
 
-		err = conn.UserCollection.FindOne(context.TODO(), filter).Decode(&user)
+	go func() {
+		err := migrateUsername(&change)
 
 		if err != nil {
-			return nil, err
+			log.Printf("username migration %v: %v", change.Id.Hex(), err)
 		}
+	}()
+
+	err = AuthRepoImpl{}.LogoutAll(id)
 
+	if err != nil {
 		return nil, err
 	}
 
-	_, err = session.WithTransaction(context.Background(), callback, txnOpts)
+	u.user.Username = change.NewUsername
+
+	return issueTokens(&u.user, ip, userAgent)
+}
+
+// ResolveUsername finds the current username of whoever used to go by username, hidden the same way profiles are
+func (u UserRepoImpl) ResolveUsername(username string, currentUsername string) (string, error) {
+	conn := database.MongoConn
+
+	var change domain.UsernameChange
+
+	opts := options.FindOne().SetSort(bson.D{{"createdAt", -1}})
+
+	err := conn.UsernameChangeCollection.FindOne(context.TODO(), bson.D{{"oldUsername", username}}, opts).Decode(&change)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return "", domain.ErrUserNotFound
+		}
+		return "", fmt.Errorf("error processing data")
+	}
+
+	filter := bson.M{"_id": change.UserId, "username": change.CurrentUsername, "pendingDeletion": bson.M{"$ne": true}}
+
+	err = conn.UserCollection.FindOne(context.TODO(), filter).Decode(&u.user)
+
+	if err != nil {
+		// ErrNoDocuments means that the filter did not match any documents in the collection
+		if err == mongo.ErrNoDocuments {
+			return "", domain.ErrUserNotFound
+		}
+		return "", fmt.Errorf("error processing data")
+	}
+
+	if helper.CurrentUserInteraction(u.user.BlockList, currentUsername) || helper.CurrentUserInteraction(u.user.BlockByList, currentUsername) {
+		return "", domain.ErrUserNotFound
+	}
+
+	return u.user.Username, nil
+}
+
+func (u UserRepoImpl) FindUsernameHistory(id primitive.ObjectID) (*[]domain.UsernameChange, error) {
+	conn := database.MongoConn
+
+	cur, err := conn.UsernameChangeCollection.Find(context.TODO(), bson.D{{"userId", id}}, options.Find().SetSort(bson.D{{"createdAt", -1}}))
+
+	if err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	history := make([]domain.UsernameChange, 0)
+
+	if err = cur.All(context.TODO(), &history); err != nil {
+		return nil, fmt.Errorf("error processing data")
+	}
+
+	return &history, nil
+}
+
+// emailIsAvailable checks the address like Create does, pending changes of other users hold on to their address too
+func emailIsAvailable(email string, id primitive.ObjectID) error {
+	conn := database.MongoConn
+
+	cur, err := conn.UserCollection.Find(context.TODO(), bson.M{
+		"_id": bson.M{"$ne": id},
+		"$or": []interface{}{
+			bson.M{"email": email},
+			bson.M{"pendingEmail": email},
+		},
+	})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
+	}
+
+	found := cur.Next(context.TODO())
+
+	err = cur.Close(context.TODO())
 
 	if err != nil {
 		return err
 	}
 
+	if found {
+		return fmt.Errorf("email is taken")
+	}
+
 	return nil
 }
 
-func (u UserRepoImpl) DeleteByID(id primitive.ObjectID, ctx context.Context, username string) error {
+// usernameIsAvailable a username given up by someone else is only free once its reservation ran out
+func usernameIsAvailable(username string, id primitive.ObjectID) error {
 	conn := database.MongoConn
 
-	_, err := conn.UserCollection.DeleteOne(context.TODO(), bson.D{{"_id", id}})
+	count, err := conn.UserCollection.CountDocuments(context.TODO(), bson.M{"username": username, "_id": bson.M{"$ne": id}})
 
 	if err != nil {
-		return err
+		return fmt.Errorf("error processing data")
+	}
+
+	if count > 0 {
+		return domain.ErrUsernameTaken
+	}
+
+	count, err = conn.UsernameChangeCollection.CountDocuments(context.TODO(), bson.M{"oldUsername": username,
+		"userId": bson.M{"$ne": id}, "reservedUntil": bson.M{"$gt": time.Now()}})
+
+	if err != nil {
+		return fmt.Errorf("error processing data")
 	}
 
-	u.user.Id = id
+	if count > 0 {
+		return domain.ErrUsernameTaken
+	}
 
 	return nil
 }
 
+// signedToken builds the same kind of single use token as the password reset one
+func signedToken() (string, error) {
+	a := new(domain.Authentication)
+	h := utils.UUIDv4()
+	s, err := a.SignTokenFor(keyring.Reset, []byte(h))
+
+	if err != nil {
+		return "", err
+	}
+
+	return h + "-" + string(s), nil
+}
+
 func NewUserRepoImpl() UserRepoImpl {
 	var userRepoImpl UserRepoImpl
 
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"testing"
+	"time"
+)
+
+func TestSearchFindsUnpopularPrefixMatches(t *testing.T) {
+	requireDB(t)
+
+	searcher := createTestUser(t, "searcher", "searcher@example.com", true)
+
+	// more popular users with the same first letter than there is room for fuzzy candidates
+	users := make([]interface{}, 0, searchFuzzyCandidates+10)
+
+	for i := 0; i < searchFuzzyCandidates+10; i++ {
+		users = append(users, bson.M{"_id": primitive.NewObjectID(), "username": fmt.Sprintf("c%03dpopular", i),
+			"followerCount": 1000 + i, "lastActiveAt": time.Now()})
+	}
+
+	users = append(users,
+		bson.M{"_id": primitive.NewObjectID(), "username": "carl", "followerCount": 0, "lastActiveAt": time.Now()},
+		bson.M{"_id": primitive.NewObjectID(), "username": "carla", "followerCount": 0, "lastActiveAt": time.Now()},
+		bson.M{"_id": primitive.NewObjectID(), "username": "zoe", "currentTagLine": "writes about cars", "followerCount": 5, "lastActiveAt": time.Now(),
+			"privacy": bson.M{"profile": domain.AudienceEveryone}})
+
+	if _, err := database.MongoConn.UserCollection.InsertMany(context.TODO(), users); err != nil {
+		t.Fatal(err)
+	}
+
+	usernames := func(query string) map[string]int {
+		t.Helper()
+
+		list, err := UserRepoImpl{}.Search(searcher.Id, query, "1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := make(map[string]int, len(list.Users))
+
+		for i, user := range list.Users {
+			found[user.Username] = i
+		}
+
+		return found
+	}
+
+	found := usernames("car")
+
+	for _, username := range []string{"carl", "carla"} {
+		if i, ok := found[username]; !ok || i > 1 {
+			t.Errorf("expected %v among the first results, got %v", username, found)
+		}
+	}
+
+	if _, ok := found["zoe"]; !ok {
+		t.Errorf("expected the tagline match, got %v", found)
+	}
+
+	if _, ok := found["searcher"]; ok {
+		t.Error("the searcher shouldn't find themselves")
+	}
+
+	// a typo in the last letter
+	if _, ok := usernames("carx")["carl"]; !ok {
+		t.Error("expected carl to be found with a typo")
+	}
+}
+
+func TestSearchRespectsProfileAudience(t *testing.T) {
+	requireDB(t)
+
+	follower := createTestUser(t, "follower", "follower@example.com", true)
+	stranger := createTestUser(t, "stranger", "stranger@example.com", true)
+
+	followersOnly := bson.M{"_id": primitive.NewObjectID(), "username": "guarded", "currentTagLine": "tagline for followers",
+		"profilePictureUrl": "/guarded.png", "lastActiveAt": time.Now(),
+		"privacy": bson.M{"profile": domain.AudienceFollowers, "followerCount": domain.AudienceEveryone}}
+	hidden := bson.M{"_id": primitive.NewObjectID(), "username": "guardedhidden", "lastActiveAt": time.Now(),
+		"privacy": bson.M{"profile": domain.AudienceNobody}}
+
+	if _, err := database.MongoConn.UserCollection.InsertMany(context.TODO(), []interface{}{followersOnly, hidden}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := database.MongoConn.FollowCollection.InsertOne(context.TODO(), domain.Follow{Id: primitive.NewObjectID(),
+		FollowerId: follower.Id, FollowerUsername: "follower", FolloweeId: followersOnly["_id"].(primitive.ObjectID),
+		FolloweeUsername: "guarded", Status: domain.FollowStatusAccepted, CreatedAt: time.Now(), AcceptedAt: time.Now()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(searcher *domain.User, query string) map[string]domain.UserSearchResult {
+		t.Helper()
+
+		list, err := UserRepoImpl{}.Search(searcher.Id, query, "1")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := make(map[string]domain.UserSearchResult, len(list.Users))
+
+		for _, user := range list.Users {
+			found[user.Username] = user
+		}
+
+		return found
+	}
+
+	for _, searcher := range []*domain.User{follower, stranger} {
+		if _, ok := search(searcher, "guarded")["guardedhidden"]; ok {
+			t.Errorf("%v: expected a profile visible to nobody to never be found", searcher.Username)
+		}
+	}
+
+	user, ok := search(follower, "guarded")["guarded"]
+
+	if !ok || user.CurrentTagLine == "" || user.ProfilePictureUrl == "" {
+		t.Errorf("expected an accepted follower to see the profile, got %+v", user)
+	}
+
+	user, ok = search(stranger, "guarded")["guarded"]
+
+	if !ok || user.CurrentTagLine != "" || user.ProfilePictureUrl != "" || !user.IsPrivate {
+		t.Errorf("expected a stranger to only see the username, got %+v", user)
+	}
+
+	if _, ok = search(stranger, "followers")["guarded"]; ok {
+		t.Error("expected a hidden tagline not to match")
+	}
+
+	if _, ok = search(follower, "followers")["guarded"]; !ok {
+		t.Error("expected a follower to find the user by tagline")
+	}
+}
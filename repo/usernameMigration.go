@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"story-app-monolith/database"
+	"story-app-monolith/domain"
+	"time"
+)
+
+// usernameField is a field that holds a username, Array fields are updated one element at a time
+type usernameField struct {
+	Collection *mongo.Collection
+	Field      string
+	Array      bool
+}
+
+// StartUsernameMigrations finishes the migrations of renames that were interrupted, e.g. by a restart
+func StartUsernameMigrations(interval time.Duration) {
+	go func() {
+		for {
+			err := resumeUsernameMigrations()
+
+			if err != nil {
+				log.Println("username migration:", err)
+			}
+
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func resumeUsernameMigrations() error {
+	conn := database.MongoConn
+
+	// a rename that just happened is still being migrated by the request that made it
+	filter := bson.M{"migrated": false, "createdAt": bson.M{"$lt": time.Now().Add(-time.Minute)}}
+
+	cur, err := conn.UsernameChangeCollection.Find(context.TODO(), filter, options.Find().SetSort(bson.D{{"createdAt", 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	var changes []domain.UsernameChange
+
+	if err = cur.All(context.TODO(), &changes); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		err = migrateUsername(&change)
+
+		if err != nil {
+			log.Printf("username migration %v: %v", change.Id.Hex(), err)
+		}
+	}
+
+	return nil
+}
+
+// migrateUsername rewrites every reference to the old username. Each update only matches what still has the old
+// username, so running it again after a partial failure picks up where it stopped.
+func migrateUsername(change *domain.UsernameChange) error {
+	conn := database.MongoConn
+
+	fields := []usernameField{
+		{conn.StoryCollection, "authorUsername", false},
+		{conn.StoryCollection, "likes", true},
+		{conn.StoryCollection, "dislikes", true},
+		{conn.CommentsCollection, "authorUsername", false},
+		{conn.CommentsCollection, "likes", true},
+		{conn.CommentsCollection, "dislikes", true},
+		{conn.RepliesCollection, "authorUsername", false},
+		{conn.RepliesCollection, "likes", true},
+		{conn.RepliesCollection, "dislikes", true},
+		{conn.ReadLaterCollection, "username", false},
+		{conn.ReadLaterCollection, "story.authorUsername", false},
+		{conn.UserCollection, "blockList", true},
+		{conn.UserCollection, "blockByList", true},
+		{conn.FollowCollection, "followerUsername", false},
+		{conn.FollowCollection, "followeeUsername", false},
+		{conn.ConversationCollection, "owner", false},
+		{conn.ConversationCollection, "from", false},
+		{conn.ConversationCollection, "to", false},
+		{conn.MessageCollection, "from", false},
+		{conn.MessageCollection, "to", false},
+		{conn.NotificationCollection, "for", false},
+		{conn.NotificationCollection, "from", false},
+		{conn.IdentityCollection, "username", false},
+		{conn.FlagCollection, "flaggedUsername", false},
+		{conn.ApiKeyCollection, "username", false},
+		{conn.RefreshTokenCollection, "username", false},
+	}
+
+	for _, f := range fields {
+		update := bson.D{{"$set", bson.D{{f.Field, change.NewUsername}}}}
+
+		if f.Array {
+			// a username is in an array at most once
+			update = bson.D{{"$set", bson.D{{f.Field + ".$", change.NewUsername}}}}
+		}
+
+		_, err := f.Collection.UpdateMany(context.TODO(), bson.D{{f.Field, change.OldUsername}}, update)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range []string{"from", "to"} {
+		opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"m." + field: change.OldUsername}}})
+
+		_, err := conn.ConversationCollection.UpdateMany(context.TODO(), bson.D{{"messages." + field, change.OldUsername}},
+			bson.D{{"$set", bson.D{{"messages.$[m]." + field, change.NewUsername}}}}, opts)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	muted := bson.D{{"kind", domain.MuteKindUser}, {"value", change.OldUsername}}
+
+	_, err := conn.MuteCollection.UpdateMany(context.TODO(), muted, bson.D{{"$set", bson.D{{"value", change.NewUsername}}}})
+
+	// whoever already mutes the new username doesn't need the old mute anymore
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = conn.MuteCollection.DeleteMany(context.TODO(), muted)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.UsernameChangeCollection.UpdateOne(context.TODO(), bson.D{{"_id", change.Id}},
+		bson.D{{"$set", bson.D{{"migrated", true}, {"migratedAt", time.Now()}}}})
+
+	return err
+}
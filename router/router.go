@@ -5,7 +5,11 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"log"
+	"story-app-monolith/blobstore"
+	"story-app-monolith/domain"
 	"story-app-monolith/handlers"
+	"story-app-monolith/images"
 	"story-app-monolith/middleware"
 	"story-app-monolith/repo"
 	"story-app-monolith/services"
@@ -14,12 +18,20 @@ import (
 func SetupRoutes(app *fiber.App) {
 	uh := handlers.UserHandler{UserService: services.NewUserService(repo.NewUserRepoImpl())}
 	ah := handlers.AuthHandler{AuthService: services.NewAuthService(repo.NewAuthRepoImpl())}
+	mfah := handlers.MfaHandler{MfaService: services.NewMfaService(repo.NewMfaRepoImpl())}
+	oh := handlers.OidcHandler{OidcService: services.NewOidcService(repo.NewOidcRepoImpl())}
+	fh := handlers.FollowHandler{FollowService: services.NewFollowService(repo.NewFollowRepoImpl())}
+	muh := handlers.MuteHandler{MuteService: services.NewMuteService(repo.NewMuteRepoImpl())}
+	deh := handlers.DataExportHandler{DataExportService: services.NewDataExportService(repo.NewDataExportRepoImpl())}
+	ach := handlers.AchievementHandler{AchievementService: services.NewAchievementService(repo.NewAchievementRepoImpl())}
+	akh := handlers.ApiKeyHandler{ApiKeyService: services.NewApiKeyService(repo.NewApiKeyRepoImpl())}
 	ch := handlers.CommentHandler{CommentService: services.NewCommentService(repo.NewCommentRepoImpl())}
 	sh := handlers.StoryHandler{StoryService: services.NewStoryService(repo.NewStoryRepoImpl())}
 	rh := handlers.ReadLaterHandler{ReadLaterService: services.NewReadLaterService(repo.NewReadLaterRepoImpl())}
 	reh := handlers.ReplyHandler{ReplyService: services.NewReplyService(repo.NewReplyRepoImpl())}
 	//mh := handlers.MessageHandler{MessageService: services.NewMessageService(repo.NewMessageRepoImpl())}
 	//conh := handlers.ConversationHandler{ConversationService: services.NewConversationService(repo.NewConversationRepoImpl())}
+	flh := handlers.FlagHandler{FlagService: services.NewFlagService(repo.NewFlagRepoImpl())}
 	nh := handlers.NotificationHandler{NotificationService: services.NewNotificationService(repo.NewNotificationRepoImpl())}
 
 	app.Use(recover.New())
@@ -27,63 +39,122 @@ func SetupRoutes(app *fiber.App) {
 
 	auth := api.Group("/auth")
 	auth.Post("/login", ah.Login)
+	auth.Post("/refresh", ah.RefreshToken)
+	auth.Post("/magic", ah.RequestMagicLink)
+	auth.Get("/magic/:token", ah.MagicLinkLogin)
+	auth.Post("/reactivate", ah.Reactivate)
+	auth.Post("/logout", middleware.IsLoggedIn, ah.Logout)
+	auth.Post("/logout-all", middleware.IsLoggedIn, ah.LogoutAll)
+	auth.Get("/sessions", middleware.IsLoggedIn, ah.GetSessions)
+	auth.Delete("/sessions/:id", middleware.IsLoggedIn, ah.TerminateSession)
 	auth.Post("/reset", ah.ResetPasswordQuery)
 	auth.Put("/reset/:token", ah.ResetPassword)
 	auth.Get("/account/:code", ah.VerifyCode)
+	auth.Get("/unlock/:token", ah.Unlock)
+
+	openId := auth.Group("/oidc")
+	openId.Get("/providers", oh.Providers)
+	openId.Post("/signup", oh.Signup)
+	openId.Get("/:provider", oh.Begin)
+	openId.Get("/:provider/callback", oh.Callback)
+
+	mfa := auth.Group("/mfa")
+	mfa.Post("/verify", mfah.Verify)
+	mfa.Post("/enroll", middleware.IsLoggedIn, mfah.Enroll)
+	mfa.Post("/confirm", middleware.IsLoggedIn, mfah.Confirm)
+	mfa.Post("/disable", middleware.IsLoggedIn, mfah.Disable)
+
+	apiKeys := auth.Group("/api-keys", middleware.IsLoggedIn)
+	apiKeys.Get("/", akh.FindAll)
+	apiKeys.Post("/", akh.Create)
+	apiKeys.Delete("/:id", akh.Revoke)
 
 	user := api.Group("/users")
 	user.Get("/", middleware.IsLoggedIn, uh.GetAllUsers)
 	user.Get("/blocked", middleware.IsLoggedIn, uh.GetAllBlockedUsers)
+	user.Get("/search", middleware.IsLoggedIn, uh.Search)
+	user.Get("/suggested", middleware.IsLoggedIn, uh.SuggestAuthors)
 	user.Post("flag/:username", middleware.IsLoggedIn, uh.UpdateFlagCount)
 	user.Post("/", uh.CreateUser)
-	//user.Put("/profile-visibility", middleware.IsLoggedIn, uh.UpdateProfileVisibility)
-	//user.Put("/follower-count", middleware.IsLoggedIn, uh.UpdateDisplayFollowerCount)
-	//user.Put("/message-acceptance", middleware.IsLoggedIn, uh.UpdateMessageAcceptance)
-	//user.Put("/current-badge", middleware.IsLoggedIn, uh.UpdateCurrentBadge)
-	user.Put("/profile-photo", middleware.IsLoggedIn, uh.UpdateProfilePicture)
-	//user.Put("/background-photo", middleware.IsLoggedIn, uh.UpdateProfileBackgroundPicture)
-	//user.Put("/current-tagline", middleware.IsLoggedIn, uh.UpdateCurrentTagline)
+	user.Get("/settings", middleware.IsLoggedIn, uh.GetPrivacySettings)
+	user.Patch("/settings", middleware.IsLoggedIn, uh.UpdatePrivacySettings)
+	user.Put("/current-badge", middleware.IsLoggedIn, uh.UpdateCurrentBadge)
+	user.Get("/achievements", middleware.IsLoggedIn, ach.FindAll)
+	user.Put("/email", middleware.IsLoggedIn, uh.UpdateEmail)
+	user.Put("/magic-link", middleware.IsLoggedIn, uh.UpdateMagicLink)
+	user.Get("/email/confirm/:token", uh.ConfirmEmailChange)
+	user.Get("/email/cancel/:token", uh.CancelEmailChange)
+	user.Put("/username", middleware.IsLoggedIn, uh.ChangeUsername)
+	user.Get("/username/history", middleware.IsLoggedIn, uh.FindUsernameHistory)
+	user.Get("/resolve/:username", middleware.IsLoggedIn, uh.ResolveUsername)
+	user.Put("/profile-photo", middleware.IsLoggedIn, uh.UploadProfilePicture)
+	user.Put("/background-photo", middleware.IsLoggedIn, uh.UploadProfileBackgroundPicture)
+	user.Put("/current-tagline", middleware.IsLoggedIn, uh.UpdateCurrentTagline)
+	user.Put("/pin/:id", middleware.IsLoggedIn, uh.PinStory)
+	user.Put("/unpin/:id", middleware.IsLoggedIn, uh.UnpinStory)
 	user.Put("/block/:username", middleware.IsLoggedIn, uh.BlockUser)
 	user.Put("/unblock/:username", middleware.IsLoggedIn, uh.UnblockUser)
-	//user.Put("/follow/:username", middleware.IsLoggedIn, uh.FollowUser)
-	//user.Put("/unfollow/:username", middleware.IsLoggedIn, uh.UnfollowUser)
+	user.Put("/follow/:username", middleware.IsLoggedIn, fh.Follow)
+	user.Put("/unfollow/:username", middleware.IsLoggedIn, fh.Unfollow)
+	user.Get("/follow-requests", middleware.IsLoggedIn, fh.FindRequests)
+	user.Put("/follow-requests/:username", middleware.IsLoggedIn, fh.AcceptRequest)
+	user.Delete("/follow-requests/:username", middleware.IsLoggedIn, fh.DeclineRequest)
+	user.Post("/export", middleware.IsLoggedIn, deh.Request)
+	user.Get("/export/:id", middleware.IsLoggedIn, deh.FindById)
+	user.Get("/export/:id/download", deh.Download)
+	user.Get("/mutes", middleware.IsLoggedIn, muh.FindAll)
+	user.Post("/mutes", middleware.IsLoggedIn, muh.Create)
+	user.Delete("/mutes/:id", middleware.IsLoggedIn, muh.Delete)
+	user.Get("/:username/followers", middleware.IsLoggedIn, fh.FindFollowers)
+	user.Get("/:username/following", middleware.IsLoggedIn, fh.FindFollowing)
+	user.Get("/:username/read-activity", middleware.IsLoggedIn, uh.FindReadActivity)
 	user.Delete("/delete", middleware.IsLoggedIn, uh.DeleteByID)
+	user.Get("/restore/:token", uh.RestoreAccount)
+	user.Put("/deactivate", middleware.IsLoggedIn, uh.Deactivate)
+
+	admin := api.Group("/admin", middleware.IsLoggedIn, middleware.RequirePermission(domain.PermissionManageRoles))
+	admin.Get("/roles", uh.GetRoles)
+	admin.Put("/users/:username/role", uh.UpdateRole)
 
-	//profile := api.Group("/profile")
-	//profile.Get("/:username", middleware.IsLoggedIn, uh.GetUserProfile)
-	//profile.Get("/", middleware.IsLoggedIn, uh.GetCurrentUserProfile)
+	flags := api.Group("/flags", middleware.IsLoggedIn, middleware.RequirePermission(domain.PermissionReviewFlags))
+	flags.Get("/", flh.FindAll)
+	flags.Put("/:id", flh.Review)
+
+	profile := api.Group("/profile")
+	profile.Get("/", middleware.IsLoggedIn, uh.GetCurrentUserProfile)
+	profile.Get("/:username", middleware.IsLoggedIn, uh.GetUserProfile)
 
 	stories := api.Group("/stories")
-	stories.Post("/", middleware.IsLoggedIn, sh.CreateStory)
-	stories.Put("/:id", middleware.IsLoggedIn, sh.UpdateStory)
+	stories.Post("/", middleware.IsLoggedInWithScope(domain.ScopeWriteStories), sh.CreateStory)
+	stories.Put("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteStories), sh.UpdateStory)
 	stories.Put("/like/:id", middleware.IsLoggedIn, sh.LikeStory)
 	//stories.Put("/dislike/:id", middleware.IsLoggedIn, sh.DisLikeStory)
 	stories.Put("/flag/:id", middleware.IsLoggedIn, sh.UpdateFlagCount)
 	stories.Get("/featured", sh.FeaturedStories)
-	stories.Get("/:id", middleware.IsLoggedIn, sh.FindStory)
-	stories.Delete("/:id", middleware.IsLoggedIn, sh.DeleteStory)
-	stories.Get("/", middleware.IsLoggedIn, sh.FindAll)
+	stories.Get("/:id", middleware.IsLoggedInWithScope(domain.ScopeReadStories), sh.FindStory)
+	stories.Delete("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteStories), sh.DeleteStory)
+	stories.Get("/", middleware.IsLoggedInWithScope(domain.ScopeReadStories), sh.FindAll)
 
 	comments := api.Group("/comment")
-	comments.Post("/:id", middleware.IsLoggedIn, ch.CreateCommentOnStory)
+	comments.Post("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteComments), ch.CreateCommentOnStory)
 	comments.Put("/like/:id", middleware.IsLoggedIn, ch.LikeComment)
 	comments.Put("/dislike/:id", middleware.IsLoggedIn, ch.DisLikeComment)
 	comments.Put("/flag/:id", middleware.IsLoggedIn, ch.UpdateFlagCount)
-	comments.Put("/:id", middleware.IsLoggedIn, ch.UpdateById)
-	comments.Delete("/:id", middleware.IsLoggedIn, ch.DeleteById)
+	comments.Put("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteComments), ch.UpdateById)
+	comments.Delete("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteComments), ch.DeleteById)
 
 	reply := api.Group("/reply")
-	reply.Post("/:id", middleware.IsLoggedIn, reh.CreateReply)
+	reply.Post("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteComments), reh.CreateReply)
 	reply.Put("/like/:id", middleware.IsLoggedIn, reh.LikeReply)
 	reply.Put("/dislike/:id", middleware.IsLoggedIn, reh.DisLikeReply)
 	reply.Put("/flag/:id", middleware.IsLoggedIn, reh.UpdateFlagCount)
-	reply.Put("/:id", middleware.IsLoggedIn, reh.UpdateById)
-	reply.Delete("/:id", middleware.IsLoggedIn, reh.DeleteById)
+	reply.Put("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteComments), reh.UpdateById)
+	reply.Delete("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteComments), reh.DeleteById)
 
 	readLater := api.Group("/read")
-	readLater.Post("/:id", middleware.IsLoggedIn, rh.Create)
-	readLater.Get("/", middleware.IsLoggedIn, rh.GetByUsername)
-	readLater.Delete("/:id", middleware.IsLoggedIn, rh.Delete)
+	readLater.Post("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteReadLater), rh.Create)
+	readLater.Get("/", middleware.IsLoggedInWithScope(domain.ScopeReadReadLater), rh.GetByUsername)
+	readLater.Delete("/:id", middleware.IsLoggedInWithScope(domain.ScopeWriteReadLater), rh.Delete)
 
 	//messages := api.Group("/messages")
 	//messages.Post("/", middleware.IsLoggedIn, mh.CreateMessage)
@@ -95,14 +166,26 @@ func SetupRoutes(app *fiber.App) {
 	//conversations.Get("/", middleware.IsLoggedIn, conh.GetConversationPreviews)
 
 	notifications := api.Group("/notifications")
-	notifications.Get("/", middleware.IsLoggedIn, nh.GetAllUnreadNotificationByUsername)
+	notifications.Get("/", middleware.IsLoggedInWithScope(domain.ScopeReadNotifications), nh.GetAllUnreadNotificationByUsername)
 }
 
 func Setup() *fiber.App {
-	app := fiber.New()
+	// room for an image upload and the rest of the multipart form
+	app := fiber.New(fiber.Config{BodyLimit: images.MaxSize + 1<<20})
 
 	app.Use(cors.New())
 
+	store, err := blobstore.Default()
+
+	if err != nil {
+		log.Fatal("blob store: ", err)
+	}
+
+	// the local store has nobody else to serve its files
+	if local, ok := store.(blobstore.LocalStore); ok {
+		app.Static(local.UrlPrefix, local.Dir)
+	}
+
 	SetupRoutes(app)
 
 	return app
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+)
+
+type AchievementService interface {
+	FindAll(userId primitive.ObjectID) (*[]domain.AchievementDto, error)
+}
+
+type DefaultAchievementService struct {
+	repo repo.AchievementRepo
+}
+
+func (a DefaultAchievementService) FindAll(userId primitive.ObjectID) (*[]domain.AchievementDto, error) {
+	achievements, err := a.repo.FindAll(userId)
+	if err != nil {
+		return nil, err
+	}
+	return achievements, nil
+}
+
+func NewAchievementService(repository repo.AchievementRepo) DefaultAchievementService {
+	return DefaultAchievementService{repository}
+}
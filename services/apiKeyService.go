@@ -0,0 +1,45 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+)
+
+type ApiKeyService interface {
+	Create(userId primitive.ObjectID, username string, apiKey *domain.CreateApiKey) (*domain.CreatedApiKey, error)
+	FindAllByUserId(userId primitive.ObjectID) (*[]domain.ApiKey, error)
+	Revoke(id primitive.ObjectID, userId primitive.ObjectID) error
+}
+
+type DefaultApiKeyService struct {
+	repo repo.ApiKeyRepo
+}
+
+func (a DefaultApiKeyService) Create(userId primitive.ObjectID, username string, apiKey *domain.CreateApiKey) (*domain.CreatedApiKey, error) {
+	created, err := a.repo.Create(userId, username, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (a DefaultApiKeyService) FindAllByUserId(userId primitive.ObjectID) (*[]domain.ApiKey, error) {
+	apiKeys, err := a.repo.FindAllByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func (a DefaultApiKeyService) Revoke(id primitive.ObjectID, userId primitive.ObjectID) error {
+	err := a.repo.Revoke(id, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewApiKeyService(repository repo.ApiKeyRepo) DefaultApiKeyService {
+	return DefaultApiKeyService{repository}
+}
@@ -1,14 +1,24 @@
 package services
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"story-app-monolith/domain"
 	"story-app-monolith/repo"
+	"strings"
 )
 
 type AuthService interface {
-	Login(username string, password string) (*domain.UserDto, string, error)
+	Login(username string, password string, ip string, userAgent string) (*domain.LoginResult, error)
+	RefreshToken(token string, ip string) (*domain.LoginResult, error)
+	RequestMagicLink(email string, nonce string, ip string) error
+	MagicLinkLogin(token string, nonce string, ip string, userAgent string) (*domain.LoginResult, error)
+	Reactivate(token string, ip string, userAgent string) (*domain.LoginResult, error)
+	Logout(jti string, sessionId string, userId primitive.ObjectID, expiresAt int64, refreshToken string) error
+	LogoutAll(userId primitive.ObjectID) error
+	GetSessions(userId primitive.ObjectID, currentSessionId string) (*[]domain.Session, error)
+	TerminateSession(id primitive.ObjectID, userId primitive.ObjectID) error
 	ResetPasswordQuery(email string) error
+	Unlock(token string) error
 	ResetPassword(token, password string) error
 	VerifyCode(code string) error
 }
@@ -17,12 +27,52 @@ type DefaultAuthService struct {
 	repo repo.AuthRepo
 }
 
-func (a DefaultAuthService) Login(username string, password string) (*domain.UserDto, string, error) {
-	u, token, err := a.repo.Login(username, password)
+func (a DefaultAuthService) Login(username string, password string, ip string, userAgent string) (*domain.LoginResult, error) {
+	result, err := a.repo.Login(username, password, ip, userAgent)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	return u, token, nil
+	return result, nil
+}
+
+func (a DefaultAuthService) RefreshToken(token string, ip string) (*domain.LoginResult, error) {
+	result, err := a.repo.RefreshToken(token, ip)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (a DefaultAuthService) Logout(jti string, sessionId string, userId primitive.ObjectID, expiresAt int64, refreshToken string) error {
+	err := a.repo.Logout(jti, sessionId, userId, expiresAt, refreshToken)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a DefaultAuthService) LogoutAll(userId primitive.ObjectID) error {
+	err := a.repo.LogoutAll(userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a DefaultAuthService) GetSessions(userId primitive.ObjectID, currentSessionId string) (*[]domain.Session, error) {
+	sessions, err := a.repo.GetSessions(userId, currentSessionId)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (a DefaultAuthService) TerminateSession(id primitive.ObjectID, userId primitive.ObjectID) error {
+	err := a.repo.TerminateSession(id, userId)
+	if err != nil {
+		return err
+	}
+	return nil
 }
 
 func (a DefaultAuthService) ResetPasswordQuery(email string) error {
@@ -33,9 +83,40 @@ func (a DefaultAuthService) ResetPasswordQuery(email string) error {
 	return nil
 }
 
+func (a DefaultAuthService) RequestMagicLink(email string, nonce string, ip string) error {
+	err := a.repo.RequestMagicLink(strings.ToLower(email), nonce, ip)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (a DefaultAuthService) MagicLinkLogin(token string, nonce string, ip string, userAgent string) (*domain.LoginResult, error) {
+	result, err := a.repo.MagicLinkLogin(token, nonce, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (a DefaultAuthService) Reactivate(token string, ip string, userAgent string) (*domain.LoginResult, error) {
+	result, err := a.repo.Reactivate(token, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (a DefaultAuthService) Unlock(token string) error {
+	err := a.repo.Unlock(token)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (a DefaultAuthService) ResetPassword(token, password string) error {
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	err := a.repo.ResetPassword(token, string(hashedPassword))
+	err := a.repo.ResetPassword(token, password)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+)
+
+type DataExportService interface {
+	Request(userId primitive.ObjectID) (*domain.DataExport, error)
+	FindById(id primitive.ObjectID, userId primitive.ObjectID) (*domain.DataExport, error)
+	Download(id primitive.ObjectID, expires string, sig string) (string, string, error)
+}
+
+type DefaultDataExportService struct {
+	repo repo.DataExportRepo
+}
+
+func (d DefaultDataExportService) Request(userId primitive.ObjectID) (*domain.DataExport, error) {
+	export, err := d.repo.Request(userId)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (d DefaultDataExportService) FindById(id primitive.ObjectID, userId primitive.ObjectID) (*domain.DataExport, error) {
+	export, err := d.repo.FindById(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (d DefaultDataExportService) Download(id primitive.ObjectID, expires string, sig string) (string, string, error) {
+	file, username, err := d.repo.Download(id, expires, sig)
+	if err != nil {
+		return "", "", err
+	}
+	return file, username, nil
+}
+
+func NewDataExportService(repository repo.DataExportRepo) DefaultDataExportService {
+	return DefaultDataExportService{repository}
+}
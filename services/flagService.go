@@ -0,0 +1,36 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+)
+
+type FlagService interface {
+	FindAll(status string, page string) (*domain.FlagList, error)
+	Review(id primitive.ObjectID, reviewerId primitive.ObjectID, review *domain.ReviewFlag) error
+}
+
+type DefaultFlagService struct {
+	repo repo.FlagRepo
+}
+
+func (f DefaultFlagService) FindAll(status string, page string) (*domain.FlagList, error) {
+	flags, err := f.repo.FindAll(status, page)
+	if err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+func (f DefaultFlagService) Review(id primitive.ObjectID, reviewerId primitive.ObjectID, review *domain.ReviewFlag) error {
+	err := f.repo.Review(id, reviewerId, review)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewFlagService(repository repo.FlagRepo) DefaultFlagService {
+	return DefaultFlagService{repository}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+	"strings"
+)
+
+type FollowService interface {
+	Follow(followerId primitive.ObjectID, username string) (string, error)
+	Unfollow(followerId primitive.ObjectID, username string) error
+	FindFollowers(username string, currentUsername string, page string) (*domain.FollowList, error)
+	FindFollowing(username string, currentUsername string, page string) (*domain.FollowList, error)
+	FindRequests(userId primitive.ObjectID, page string) (*domain.FollowList, error)
+	AcceptRequest(userId primitive.ObjectID, username string) error
+	DeclineRequest(userId primitive.ObjectID, username string) error
+}
+
+type DefaultFollowService struct {
+	repo repo.FollowRepo
+}
+
+func (f DefaultFollowService) Follow(followerId primitive.ObjectID, username string) (string, error) {
+	status, err := f.repo.Follow(followerId, strings.ToLower(username))
+	if err != nil {
+		return "", err
+	}
+	return status, nil
+}
+
+func (f DefaultFollowService) Unfollow(followerId primitive.ObjectID, username string) error {
+	err := f.repo.Unfollow(followerId, strings.ToLower(username))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f DefaultFollowService) FindFollowers(username string, currentUsername string, page string) (*domain.FollowList, error) {
+	followers, err := f.repo.FindFollowers(strings.ToLower(username), currentUsername, page)
+	if err != nil {
+		return nil, err
+	}
+	return followers, nil
+}
+
+func (f DefaultFollowService) FindFollowing(username string, currentUsername string, page string) (*domain.FollowList, error) {
+	following, err := f.repo.FindFollowing(strings.ToLower(username), currentUsername, page)
+	if err != nil {
+		return nil, err
+	}
+	return following, nil
+}
+
+func (f DefaultFollowService) FindRequests(userId primitive.ObjectID, page string) (*domain.FollowList, error) {
+	requests, err := f.repo.FindRequests(userId, page)
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (f DefaultFollowService) AcceptRequest(userId primitive.ObjectID, username string) error {
+	err := f.repo.AcceptRequest(userId, strings.ToLower(username))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (f DefaultFollowService) DeclineRequest(userId primitive.ObjectID, username string) error {
+	err := f.repo.DeclineRequest(userId, strings.ToLower(username))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewFollowService(repository repo.FollowRepo) DefaultFollowService {
+	return DefaultFollowService{repository}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+)
+
+type MfaService interface {
+	Enroll(id primitive.ObjectID) (*domain.MfaEnrollment, error)
+	Confirm(id primitive.ObjectID, code string) error
+	Disable(id primitive.ObjectID, code string) error
+	Verify(mfaToken string, code string, ip string, userAgent string) (*domain.LoginResult, error)
+}
+
+type DefaultMfaService struct {
+	repo repo.MfaRepo
+}
+
+func (m DefaultMfaService) Enroll(id primitive.ObjectID) (*domain.MfaEnrollment, error) {
+	enrollment, err := m.repo.Enroll(id)
+	if err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+func (m DefaultMfaService) Confirm(id primitive.ObjectID, code string) error {
+	err := m.repo.Confirm(id, code)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m DefaultMfaService) Disable(id primitive.ObjectID, code string) error {
+	err := m.repo.Disable(id, code)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (m DefaultMfaService) Verify(mfaToken string, code string, ip string, userAgent string) (*domain.LoginResult, error) {
+	result, err := m.repo.Verify(mfaToken, code, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func NewMfaService(repository repo.MfaRepo) DefaultMfaService {
+	return DefaultMfaService{repository}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+)
+
+type MuteService interface {
+	Create(userId primitive.ObjectID, mute *domain.CreateMute) (*domain.Mute, error)
+	FindAllByUserId(userId primitive.ObjectID) (*[]domain.Mute, error)
+	Delete(id primitive.ObjectID, userId primitive.ObjectID) error
+}
+
+type DefaultMuteService struct {
+	repo repo.MuteRepo
+}
+
+func (m DefaultMuteService) Create(userId primitive.ObjectID, mute *domain.CreateMute) (*domain.Mute, error) {
+	created, err := m.repo.Create(userId, mute)
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (m DefaultMuteService) FindAllByUserId(userId primitive.ObjectID) (*[]domain.Mute, error) {
+	mutes, err := m.repo.FindAllByUserId(userId)
+	if err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+func (m DefaultMuteService) Delete(id primitive.ObjectID, userId primitive.ObjectID) error {
+	err := m.repo.Delete(id, userId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewMuteService(repository repo.MuteRepo) DefaultMuteService {
+	return DefaultMuteService{repository}
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"story-app-monolith/domain"
+	"story-app-monolith/repo"
+	"strings"
+)
+
+type OidcService interface {
+	Begin(provider string) (authUrl string, state string, err error)
+	Callback(provider string, state string, code string, ip string, userAgent string) (*domain.OidcLoginResult, error)
+	Signup(signupToken string, username string, ip string, userAgent string) (*domain.LoginResult, error)
+}
+
+type DefaultOidcService struct {
+	repo repo.OidcRepo
+}
+
+func (o DefaultOidcService) Begin(provider string) (string, string, error) {
+	authUrl, state, err := o.repo.Begin(strings.ToLower(provider))
+	if err != nil {
+		return "", "", err
+	}
+	return authUrl, state, nil
+}
+
+func (o DefaultOidcService) Callback(provider string, state string, code string, ip string, userAgent string) (*domain.OidcLoginResult, error) {
+	result, err := o.repo.Callback(strings.ToLower(provider), state, code, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (o DefaultOidcService) Signup(signupToken string, username string, ip string, userAgent string) (*domain.LoginResult, error) {
+	result, err := o.repo.Signup(signupToken, strings.ToLower(username), ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func NewOidcService(repository repo.OidcRepo) DefaultOidcService {
+	return DefaultOidcService{repository}
+}
@@ -4,36 +4,50 @@ import (
 	"context"
 	"github.com/gofiber/fiber/v2/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 	"story-app-monolith/domain"
+	"story-app-monolith/keyring"
+	"story-app-monolith/mailer"
+	"story-app-monolith/passwords"
 	"story-app-monolith/repo"
 	"strings"
 	"time"
 )
 
 type UserService interface {
-	GetAllUsers(primitive.ObjectID, string, context.Context, string) (*domain.UserResponse, error)
+	GetAllUsers(primitive.ObjectID, string, string, context.Context, string) (*domain.UserResponse, error)
 	GetAllBlockedUsers(primitive.ObjectID,  context.Context, string) (*[]domain.UserDto, error)
 	CreateUser(*domain.User) error
 	GetUserByID(primitive.ObjectID, context.Context) (*domain.UserDto, error)
 	GetUserByUsername(string, context.Context) (*domain.UserDto, error)
-	UpdateProfileVisibility(primitive.ObjectID, *domain.UpdateProfileVisibility, context.Context) error
-	UpdateMessageAcceptance(primitive.ObjectID, *domain.UpdateMessageAcceptance, context.Context) error
 	UpdateCurrentBadge(primitive.ObjectID, *domain.UpdateCurrentBadge, context.Context) error
-	UpdateProfilePicture(primitive.ObjectID, *domain.UpdateProfilePicture, context.Context) error
-	UpdateProfileBackgroundPicture(primitive.ObjectID, *domain.UpdateProfileBackgroundPicture, context.Context) error
+	UploadProfilePicture(primitive.ObjectID, []byte) (*domain.Image, error)
+	UploadProfileBackgroundPicture(primitive.ObjectID, []byte) (*domain.Image, error)
 	UpdateCurrentTagline(primitive.ObjectID, *domain.UpdateCurrentTagline, context.Context)  error
-	UpdateDisplayFollowerCount(primitive.ObjectID, *domain.UpdateDisplayFollowerCount) error
+	GetPrivacySettings(primitive.ObjectID) (*domain.PrivacySettings, error)
+	UpdatePrivacySettings(primitive.ObjectID, *domain.UpdatePrivacySettings) (*domain.PrivacySettings, error)
+	UpdateMagicLink(primitive.ObjectID, *domain.UpdateMagicLink) error
 	UpdateVerification(primitive.ObjectID, *domain.UpdateVerification) error
 	UpdatePassword(primitive.ObjectID, string) error
+	UpdateRole(string, *domain.UpdateRole) error
+	RequestEmailChange(primitive.ObjectID, *domain.UpdateEmail) error
+	ConfirmEmailChange(string) error
+	CancelEmailChange(string) error
+	ChangeUsername(primitive.ObjectID, *domain.UpdateUsername, string, string) (*domain.LoginResult, error)
+	ResolveUsername(string, string) (string, error)
+	FindUsernameHistory(primitive.ObjectID) (*[]domain.UsernameChange, error)
 	UpdateFlagCount(*domain.Flag) error
-	FollowUser(username string, currentUser string) error
-	UnfollowUser(username string, currentUser string) error
 	BlockUser(primitive.ObjectID, string, context.Context, string) error
 	UnblockUser(primitive.ObjectID, string, context.Context, string) error
-	GetCurrentUserProfile(string) (*domain.CurrentUserProfile, error)
-	GetUserProfile(string, string) (*domain.ViewUserProfile, error)
+	Search(primitive.ObjectID, string, string) (*domain.UserSearchList, error)
+	SuggestAuthors(primitive.ObjectID) (*[]domain.UserSearchResult, error)
+	GetCurrentUserProfile(string, string) (*domain.CurrentUserProfile, error)
+	GetUserProfile(string, string, string) (*domain.ViewUserProfile, error)
+	FindReadActivity(string, string) (*domain.ReadActivity, error)
+	PinStory(primitive.ObjectID, string, primitive.ObjectID) error
+	UnpinStory(primitive.ObjectID, primitive.ObjectID) error
 	DeleteByID(primitive.ObjectID, context.Context, string) error
+	RestoreAccount(string) error
+	Deactivate(primitive.ObjectID, *domain.Deactivate) error
 }
 
 // DefaultUserService the service has a dependency of the repo
@@ -41,29 +55,69 @@ type DefaultUserService struct {
 	repo repo.UserRepo
 }
 
-func (s DefaultUserService) GetAllUsers(id primitive.ObjectID, page string, ctx context.Context, username string) (*domain.UserResponse, error) {
-	u, err := s.repo.FindAll(id, page, ctx, username)
+func (s DefaultUserService) GetAllUsers(id primitive.ObjectID, page string, sort string, ctx context.Context, username string) (*domain.UserResponse, error) {
+	u, err := s.repo.FindAll(id, page, sort, ctx, username)
 	if err != nil {
 		return nil, err
 	}
 	return  u, nil
 }
-func (s DefaultUserService) GetCurrentUserProfile(username string) (*domain.CurrentUserProfile, error) {
-	currentUser, err := s.repo.GetCurrentUserProfile(username)
+func (s DefaultUserService) Search(id primitive.ObjectID, query string, page string) (*domain.UserSearchList, error) {
+	users, err := s.repo.Search(id, query, page)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s DefaultUserService) SuggestAuthors(id primitive.ObjectID) (*[]domain.UserSearchResult, error) {
+	users, err := s.repo.SuggestAuthors(id)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s DefaultUserService) GetCurrentUserProfile(username string, page string) (*domain.CurrentUserProfile, error) {
+	currentUser, err := s.repo.GetCurrentUserProfile(username, page)
 	if err != nil {
 		return nil, err
 	}
 	return currentUser, nil
 }
 
-func (s DefaultUserService) GetUserProfile(username, currentUsername string) (*domain.ViewUserProfile, error) {
-	currentUser, err := s.repo.GetUserProfile(username, currentUsername)
+func (s DefaultUserService) GetUserProfile(username, currentUsername string, page string) (*domain.ViewUserProfile, error) {
+	currentUser, err := s.repo.GetUserProfile(strings.ToLower(username), currentUsername, page)
 	if err != nil {
 		return nil, err
 	}
 	return currentUser, nil
 }
 
+func (s DefaultUserService) FindReadActivity(username string, currentUsername string) (*domain.ReadActivity, error) {
+	activity, err := s.repo.FindReadActivity(strings.ToLower(username), currentUsername)
+	if err != nil {
+		return nil, err
+	}
+	return activity, nil
+}
+
+func (s DefaultUserService) PinStory(id primitive.ObjectID, username string, storyId primitive.ObjectID) error {
+	err := s.repo.PinStory(id, username, storyId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s DefaultUserService) UnpinStory(id primitive.ObjectID, storyId primitive.ObjectID) error {
+	err := s.repo.UnpinStory(id, storyId)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 func (s DefaultUserService) GetAllBlockedUsers(id primitive.ObjectID, ctx context.Context, username string) (*[]domain.UserDto, error) {
 	u, err := s.repo.FindAllBlockedUsers(id, ctx, username)
 	if err != nil {
@@ -75,11 +129,15 @@ func (s DefaultUserService) GetAllBlockedUsers(id primitive.ObjectID, ctx contex
 func (s DefaultUserService) CreateUser(user *domain.User) error {
 	user.Username = strings.ToLower(user.Username)
 	user.Email = strings.ToLower(user.Email)
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
-	user.Password = string(hashedPassword)
+	err := passwords.Validate(user.Password, user.Username, user.Email)
+
+	if err != nil {
+		return err
+	}
+
 	a := new(domain.Authentication)
 	h := utils.UUIDv4()
-	signedHash, err := a.SignToken([]byte(h))
+	signedHash, err := a.SignTokenFor(keyring.Verification, []byte(h))
 
 	if err != nil {
 		return err
@@ -92,6 +150,11 @@ func (s DefaultUserService) CreateUser(user *domain.User) error {
 	if err != nil {
 		return err
 	}
+
+	err = mailer.SendVerificationEmail(user.Email, user.Username, user.VerificationCode)
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -111,70 +174,105 @@ func (s DefaultUserService) GetUserByUsername(username string, ctx context.Conte
 	return u, nil
 }
 
-func (s DefaultUserService) UpdateProfileVisibility(id primitive.ObjectID, user *domain.UpdateProfileVisibility, ctx context.Context) error {
+func (s DefaultUserService) GetPrivacySettings(id primitive.ObjectID) (*domain.PrivacySettings, error) {
+	settings, err := s.repo.GetPrivacySettings(id)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s DefaultUserService) UpdatePrivacySettings(id primitive.ObjectID, update *domain.UpdatePrivacySettings) (*domain.PrivacySettings, error) {
+	settings, err := s.repo.UpdatePrivacySettings(id, update)
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (s DefaultUserService) UpdateMagicLink(id primitive.ObjectID, user *domain.UpdateMagicLink) error {
 	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateProfileVisibility(id, user, ctx)
+	err := s.repo.UpdateMagicLink(id, user)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UpdateDisplayFollowerCount(id primitive.ObjectID, user *domain.UpdateDisplayFollowerCount) error {
+func (s DefaultUserService) UpdateCurrentBadge(id primitive.ObjectID, user *domain.UpdateCurrentBadge, ctx context.Context) error {
 	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateDisplayFollowerCount(id, user)
+	err := s.repo.UpdateCurrentBadge(id, user, ctx)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UpdateMessageAcceptance(id primitive.ObjectID, user *domain.UpdateMessageAcceptance, ctx context.Context) error {
+func (s DefaultUserService) UploadProfilePicture(id primitive.ObjectID, data []byte) (*domain.Image, error) {
+	image, err := s.repo.UploadProfilePicture(id, data)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (s DefaultUserService) UploadProfileBackgroundPicture(id primitive.ObjectID, data []byte) (*domain.Image, error) {
+	image, err := s.repo.UploadProfileBackgroundPicture(id, data)
+	if err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (s DefaultUserService) UpdateCurrentTagline(id primitive.ObjectID, user *domain.UpdateCurrentTagline, ctx context.Context) error {
 	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateMessageAcceptance(id, user, ctx)
+	err := s.repo.UpdateCurrentTagline(id, user, ctx)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UpdateCurrentBadge(id primitive.ObjectID, user *domain.UpdateCurrentBadge, ctx context.Context) error {
-	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateCurrentBadge(id, user, ctx)
+func (s DefaultUserService) UpdatePassword(id primitive.ObjectID, password string) error {
+	err := s.repo.UpdatePassword(id, password)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UpdateProfilePicture(id primitive.ObjectID, user *domain.UpdateProfilePicture, ctx context.Context) error {
-	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateProfilePicture(id, user, ctx)
+func (s DefaultUserService) UpdateRole(username string, role *domain.UpdateRole) error {
+	role.UpdatedAt = time.Now()
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	err := s.repo.UpdateRole(username, role)
 	if err != nil {
 		return err
 	}
 	return nil
 }
-func (s DefaultUserService) UpdateProfileBackgroundPicture(id primitive.ObjectID, user *domain.UpdateProfileBackgroundPicture, ctx context.Context) error {
-	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateProfileBackgroundPicture(id, user, ctx)
+
+func (s DefaultUserService) RequestEmailChange(id primitive.ObjectID, email *domain.UpdateEmail) error {
+	email.Email = strings.ToLower(email.Email)
+	email.UpdatedAt = time.Now()
+	err := s.repo.RequestEmailChange(id, email)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UpdateCurrentTagline(id primitive.ObjectID, user *domain.UpdateCurrentTagline, ctx context.Context) error {
-	user.UpdatedAt = time.Now()
-	err := s.repo.UpdateCurrentTagline(id, user, ctx)
+func (s DefaultUserService) ConfirmEmailChange(token string) error {
+	err := s.repo.ConfirmEmailChange(token)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UpdatePassword(id primitive.ObjectID, password string) error {
-	err := s.repo.UpdatePassword(id, password)
+func (s DefaultUserService) CancelEmailChange(token string) error {
+	err := s.repo.CancelEmailChange(token)
 	if err != nil {
 		return err
 	}
@@ -206,16 +304,41 @@ func (s DefaultUserService) DeleteByID(id primitive.ObjectID, ctx context.Contex
 	return nil
 }
 
-func (s DefaultUserService) FollowUser(username string, currentUser string) error {
-	err := s.repo.FollowUser(username, currentUser)
+func (s DefaultUserService) ChangeUsername(id primitive.ObjectID, username *domain.UpdateUsername, ip string, userAgent string) (*domain.LoginResult, error) {
+	username.Username = strings.ToLower(username.Username)
+	result, err := s.repo.ChangeUsername(id, username, ip, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s DefaultUserService) ResolveUsername(username string, currentUsername string) (string, error) {
+	current, err := s.repo.ResolveUsername(strings.ToLower(username), currentUsername)
+	if err != nil {
+		return "", err
+	}
+	return current, nil
+}
+
+func (s DefaultUserService) FindUsernameHistory(id primitive.ObjectID) (*[]domain.UsernameChange, error) {
+	history, err := s.repo.FindUsernameHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (s DefaultUserService) Deactivate(id primitive.ObjectID, deactivate *domain.Deactivate) error {
+	err := s.repo.Deactivate(id, deactivate)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s DefaultUserService) UnfollowUser(username string, currentUser string) error {
-	err := s.repo.UnfollowUser(username, currentUser)
+func (s DefaultUserService) RestoreAccount(token string) error {
+	err := s.repo.RestoreAccount(token)
 	if err != nil {
 		return err
 	}
@@ -13,11 +13,16 @@ func CreateUser(createUserDto *domain.CreateUserDto) *domain.User {
 	user.Username = strings.ToLower(createUserDto.Username)
 	user.Email = strings.ToLower(createUserDto.Email)
 	user.Password = createUserDto.Password
+	user.Role = domain.RoleUser
+	user.Permissions = []string{}
 	user.IsVerified = false
 	user.IsLocked = false
-	user.ProfileIsViewable = true
-	user.AcceptMessages = true
+	user.Privacy = domain.DefaultPrivacySettings()
 	user.BlockList = []string{}
+	user.UnlockedTagLine = []string{}
+	user.UnlockedBadgesUrls = []string{}
+	user.Achievements = []string{}
+	user.AchievementsBackfilled = true
 	user.BlockByList = []string{}
 	user.FlagCount = []primitive.ObjectID{}
 	user.CreatedAt = time.Now()
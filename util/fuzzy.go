@@ -0,0 +1,62 @@
+package util
+
+// EditDistance counts the insertions, deletions, substitutions and swaps of adjacent letters between a and b
+func EditDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(s)][len(t)]
+}
+
+// IsSubsequence reports whether the letters of sub appear in s in order, e.g. "jdoe" in "john_doe"
+func IsSubsequence(sub, s string) bool {
+	r := []rune(sub)
+	if len(r) == 0 {
+		return true
+	}
+
+	i := 0
+	for _, c := range s {
+		if c == r[i] {
+			i++
+			if i == len(r) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func min(first int, rest ...int) int {
+	m := first
+	for _, v := range rest {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
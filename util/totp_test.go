@@ -0,0 +1,66 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestTOTPCodeRFC6238 uses the SHA1 vectors of RFC 6238 Appendix B, the codes are the last 6 of its 8 digits
+func TestTOTPCodeRFC6238(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := TOTPCode(rfc6238Secret, v.unix/totpPeriod)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != v.code {
+			t.Errorf("%v: expected %v, got %v", v.unix, v.code, code)
+		}
+
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0))
+
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("%v: expected the code to be accepted for step %v, got %v %v", v.unix, v.unix/totpPeriod, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	// 287082 is the code of step 1, 30 to 59 seconds
+	for _, test := range []struct {
+		unix int64
+		ok   bool
+	}{
+		{0, true},
+		{89, true},
+		{90, false},
+	} {
+		if _, ok := ValidateTOTP(rfc6238Secret, "287082", time.Unix(test.unix, 0)); ok != test.ok {
+			t.Errorf("%v: expected %v, got %v", test.unix, test.ok, ok)
+		}
+	}
+
+	if _, ok := ValidateTOTP(rfc6238Secret, "287 082", time.Unix(59, 0)); !ok {
+		t.Error("expected spaces in the code to be ignored")
+	}
+
+	if _, ok := ValidateTOTP(rfc6238Secret, "28708", time.Unix(59, 0)); ok {
+		t.Error("expected a short code to be rejected")
+	}
+}
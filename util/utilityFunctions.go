@@ -5,6 +5,8 @@ import (
 	"strings"
 )
 
+var usernameRegex = regexp.MustCompile("^[a-z0-9_]{2,30}$")
+
 var emailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 
 func GenerateNewBlockList(targetID string, blockList []string) ([]string, bool) {
@@ -32,6 +34,11 @@ func IsEmail(e string) bool {
 	return emailRegex.MatchString(e)
 }
 
+// IsUsername usernames are lowercase letters, digits and underscores
+func IsUsername(u string) bool {
+	return usernameRegex.MatchString(u)
+}
+
 func GenerateKey(value string, query string) string {
 	var key strings.Builder
 